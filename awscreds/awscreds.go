@@ -0,0 +1,208 @@
+// Package awscreds implements a clientcredentials.CredentialsProvider
+// loading client credentials from AWS Secrets Manager or SSM Parameter Store.
+package awscreds
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// SecretsManagerAPI is the subset of *secretsmanager.Client used by Provider.
+type SecretsManagerAPI interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput,
+		optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// SSMAPI is the subset of *ssm.Client used by Provider.
+type SSMAPI interface {
+	GetParameters(ctx context.Context, params *ssm.GetParametersInput,
+		optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error)
+}
+
+// Options define provider options. Exactly one of SecretsManager or SSM
+// must be defined.
+type Options struct {
+	// SecretsManager loads credentials from the JSON secret SecretID,
+	// e.g. {"client_id":"...","client_secret":"..."}.
+	SecretsManager SecretsManagerAPI
+
+	// SecretID is the secret name or ARN, required with SecretsManager.
+	SecretID string
+
+	// ClientIDField is the JSON secret field holding the client ID.
+	// If unspecified, defaults to "client_id".
+	ClientIDField string
+
+	// ClientSecretField is the JSON secret field holding the client secret.
+	// If unspecified, defaults to "client_secret".
+	ClientSecretField string
+
+	// SSM loads credentials from the parameters ClientIDParameter and
+	// ClientSecretParameter. SecureString parameters are decrypted.
+	SSM SSMAPI
+
+	// ClientIDParameter is the parameter holding the client ID,
+	// required with SSM.
+	ClientIDParameter string
+
+	// ClientSecretParameter is the parameter holding the client secret,
+	// required with SSM.
+	ClientSecretParameter string
+
+	// RefreshInterval is the period between loads.
+	// If unspecified, defaults to 5 minutes.
+	RefreshInterval time.Duration
+
+	// Logf provides logging function, if undefined defaults to log.Printf
+	Logf func(format string, v ...any)
+}
+
+// Provider loads client credentials from AWS, refreshing them lazily
+// after RefreshInterval. When the secret rotates, the new credentials
+// are returned, and clientcredentials evicts tokens cached for the
+// previous client secret once the token server accepts the new one.
+// It implements clientcredentials.CredentialsProvider.
+type Provider struct {
+	options Options
+
+	mutex        sync.Mutex
+	clientID     string
+	clientSecret string
+	loaded       bool
+	nextLoad     time.Time
+}
+
+// New creates an AWS credentials provider.
+func New(options Options) *Provider {
+	switch {
+	case options.SecretsManager != nil && options.SSM != nil:
+		panic("both secrets manager and ssm are defined")
+	case options.SecretsManager != nil:
+		if options.SecretID == "" {
+			panic("secret id is empty")
+		}
+	case options.SSM != nil:
+		if options.ClientIDParameter == "" || options.ClientSecretParameter == "" {
+			panic("ssm parameter names are empty")
+		}
+	default:
+		panic("neither secrets manager nor ssm is defined")
+	}
+	if options.ClientIDField == "" {
+		options.ClientIDField = "client_id"
+	}
+	if options.ClientSecretField == "" {
+		options.ClientSecretField = "client_secret"
+	}
+	if options.RefreshInterval <= 0 {
+		options.RefreshInterval = 5 * time.Minute
+	}
+	if options.Logf == nil {
+		options.Logf = log.Printf
+	}
+	return &Provider{options: options}
+}
+
+// Credentials returns the client credentials loaded from AWS. If a refresh
+// fails, the last credentials loaded are returned and the error is logged.
+// req is ignored.
+func (p *Provider) Credentials(ctx context.Context, _ *http.Request) (string, string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := time.Now()
+
+	if p.loaded && now.Before(p.nextLoad) {
+		return p.clientID, p.clientSecret, nil
+	}
+
+	clientID, clientSecret, errLoad := p.load(ctx)
+	if errLoad != nil {
+		if !p.loaded {
+			return "", "", errLoad
+		}
+		p.options.Logf("ERROR: awscreds: keeping previous credentials: %v", errLoad)
+		return p.clientID, p.clientSecret, nil
+	}
+
+	if p.loaded && clientSecret != p.clientSecret {
+		p.options.Logf("INFO: awscreds: client secret rotated: client_id=%s", clientID)
+	}
+
+	p.clientID = clientID
+	p.clientSecret = clientSecret
+	p.loaded = true
+	p.nextLoad = now.Add(p.options.RefreshInterval)
+
+	return clientID, clientSecret, nil
+}
+
+func (p *Provider) load(ctx context.Context) (string, string, error) {
+	if p.options.SecretsManager != nil {
+		return p.loadSecret(ctx)
+	}
+	return p.loadParameters(ctx)
+}
+
+func (p *Provider) loadSecret(ctx context.Context) (string, string, error) {
+	out, errGet := p.options.SecretsManager.GetSecretValue(ctx,
+		&secretsmanager.GetSecretValueInput{SecretId: aws.String(p.options.SecretID)})
+	if errGet != nil {
+		return "", "", fmt.Errorf("get secret %s: %w", p.options.SecretID, errGet)
+	}
+	if out.SecretString == nil {
+		return "", "", fmt.Errorf("secret %s: missing secret string", p.options.SecretID)
+	}
+
+	var fields map[string]any
+	if errJSON := json.Unmarshal([]byte(*out.SecretString), &fields); errJSON != nil {
+		return "", "", fmt.Errorf("secret %s: decode: %w", p.options.SecretID, errJSON)
+	}
+
+	clientID, _ := fields[p.options.ClientIDField].(string)
+	clientSecret, _ := fields[p.options.ClientSecretField].(string)
+	if clientID == "" || clientSecret == "" {
+		return "", "", fmt.Errorf("secret %s: missing fields %s or %s", p.options.SecretID,
+			p.options.ClientIDField, p.options.ClientSecretField)
+	}
+
+	return clientID, clientSecret, nil
+}
+
+func (p *Provider) loadParameters(ctx context.Context) (string, string, error) {
+	out, errGet := p.options.SSM.GetParameters(ctx, &ssm.GetParametersInput{
+		Names:          []string{p.options.ClientIDParameter, p.options.ClientSecretParameter},
+		WithDecryption: aws.Bool(true),
+	})
+	if errGet != nil {
+		return "", "", fmt.Errorf("get parameters: %w", errGet)
+	}
+	if len(out.InvalidParameters) > 0 {
+		return "", "", fmt.Errorf("invalid parameters: %v", out.InvalidParameters)
+	}
+
+	var clientID, clientSecret string
+	for _, param := range out.Parameters {
+		switch aws.ToString(param.Name) {
+		case p.options.ClientIDParameter:
+			clientID = aws.ToString(param.Value)
+		case p.options.ClientSecretParameter:
+			clientSecret = aws.ToString(param.Value)
+		}
+	}
+	if clientID == "" || clientSecret == "" {
+		return "", "", errors.New("empty client id or client secret parameter")
+	}
+
+	return clientID, clientSecret, nil
+}
@@ -0,0 +1,140 @@
+package awscreds
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// the SDK clients satisfy the interfaces
+var (
+	_ SecretsManagerAPI = (*secretsmanager.Client)(nil)
+	_ SSMAPI            = (*ssm.Client)(nil)
+)
+
+type fakeSecretsManager struct {
+	secret string
+	err    error
+	calls  int
+}
+
+func (f *fakeSecretsManager) GetSecretValue(_ context.Context, params *secretsmanager.GetSecretValueInput,
+	_ ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	if aws.ToString(params.SecretId) != "app/oauth2" {
+		return nil, errors.New("secret not found")
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(f.secret)}, nil
+}
+
+type fakeSSM struct {
+	params map[string]string
+}
+
+func (f *fakeSSM) GetParameters(_ context.Context, params *ssm.GetParametersInput,
+	_ ...func(*ssm.Options)) (*ssm.GetParametersOutput, error) {
+	if !aws.ToBool(params.WithDecryption) {
+		return nil, errors.New("expected decryption")
+	}
+	out := &ssm.GetParametersOutput{}
+	for _, name := range params.Names {
+		value, found := f.params[name]
+		if !found {
+			out.InvalidParameters = append(out.InvalidParameters, name)
+			continue
+		}
+		out.Parameters = append(out.Parameters, types.Parameter{Name: aws.String(name), Value: aws.String(value)})
+	}
+	return out, nil
+}
+
+func TestSecretsManager(t *testing.T) {
+
+	sm := &fakeSecretsManager{secret: `{"client_id":"app","client_secret":"s1"}`}
+
+	p := New(Options{
+		SecretsManager:  sm,
+		SecretID:        "app/oauth2",
+		RefreshInterval: 10 * time.Millisecond,
+	})
+
+	table := []struct {
+		name         string
+		secret       string
+		err          error
+		wait         time.Duration
+		expectSecret string
+		expectCalls  int
+	}{
+		{"first load", `{"client_id":"app","client_secret":"s1"}`, nil, 0, "s1", 1},
+		{"cached before refresh", `{"client_id":"app","client_secret":"s2"}`, nil, 0, "s1", 1},
+		{"rotated after refresh", `{"client_id":"app","client_secret":"s2"}`, nil, 20 * time.Millisecond, "s2", 2},
+		{"failure keeps previous", "", errors.New("throttled"), 20 * time.Millisecond, "s2", 3},
+	}
+
+	for _, data := range table {
+		sm.secret, sm.err = data.secret, data.err
+		time.Sleep(data.wait)
+		id, secret, errCreds := p.Credentials(context.TODO(), nil)
+		if errCreds != nil {
+			t.Fatalf("%s: credentials: %v", data.name, errCreds)
+		}
+		if id != "app" || secret != data.expectSecret {
+			t.Errorf("%s: unexpected credentials: %s/%s", data.name, id, secret)
+		}
+		if sm.calls != data.expectCalls {
+			t.Errorf("%s: expected %d calls, got %d", data.name, data.expectCalls, sm.calls)
+		}
+	}
+}
+
+func TestSSM(t *testing.T) {
+
+	f := &fakeSSM{params: map[string]string{
+		"/app/client_id":     "app",
+		"/app/client_secret": "s1",
+	}}
+
+	p := New(Options{
+		SSM:                   f,
+		ClientIDParameter:     "/app/client_id",
+		ClientSecretParameter: "/app/client_secret",
+	})
+
+	id, secret, errCreds := p.Credentials(context.TODO(), nil)
+	if errCreds != nil {
+		t.Fatalf("credentials: %v", errCreds)
+	}
+	if id != "app" || secret != "s1" {
+		t.Errorf("unexpected credentials: %s/%s", id, secret)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+
+	table := []struct {
+		name    string
+		options Options
+	}{
+		{"secret not found", Options{SecretsManager: &fakeSecretsManager{}, SecretID: "missing"}},
+		{"secret not json", Options{SecretsManager: &fakeSecretsManager{secret: "plain"}, SecretID: "app/oauth2"}},
+		{"secret missing fields", Options{SecretsManager: &fakeSecretsManager{secret: `{"id":"app"}`}, SecretID: "app/oauth2"}},
+		{"parameter not found", Options{SSM: &fakeSSM{}, ClientIDParameter: "a", ClientSecretParameter: "b"}},
+	}
+
+	for _, data := range table {
+		p := New(data.options)
+		if _, _, errCreds := p.Credentials(context.TODO(), nil); errCreds == nil {
+			t.Errorf("%s: expected error", data.name)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Package backoff implements exponential backoff with jitter.
+//
+// It is used by clientcredentials for retries and is exported so that
+// callers can align their own retry loops with the same policy.
+package backoff
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// Default values for unspecified Config fields.
+const (
+	DefaultInitial    = 100 * time.Millisecond
+	DefaultMax        = 10 * time.Second
+	DefaultMultiplier = 2.0
+)
+
+// Config defines the backoff policy.
+type Config struct {
+	// Initial is the delay before the first retry.
+	// If unspecified, defaults to DefaultInitial.
+	Initial time.Duration
+
+	// Max caps the delay.
+	// If unspecified, defaults to DefaultMax.
+	Max time.Duration
+
+	// Multiplier grows the delay for each attempt.
+	// If unspecified, defaults to DefaultMultiplier.
+	Multiplier float64
+
+	// Jitter is the fraction, from 0 to 1, of the delay that is randomized.
+	// Example: 0.5 gives a random delay between 50% and 100% of the computed value.
+	// 0 disables jitter, 1 is full jitter.
+	Jitter float64
+}
+
+// Delay returns the delay before the retry attempt,
+// where attempt 0 is the first retry.
+func (c Config) Delay(attempt int) time.Duration {
+	initial := c.Initial
+	if initial <= 0 {
+		initial = DefaultInitial
+	}
+	maxDelay := c.Max
+	if maxDelay <= 0 {
+		maxDelay = DefaultMax
+	}
+	multiplier := c.Multiplier
+	if multiplier <= 0 {
+		multiplier = DefaultMultiplier
+	}
+
+	d := float64(initial)
+	for i := 0; i < attempt && d < float64(maxDelay); i++ {
+		d *= multiplier
+	}
+	if d > float64(maxDelay) {
+		d = float64(maxDelay)
+	}
+
+	jitter := min(max(c.Jitter, 0), 1)
+	if jitter > 0 {
+		d -= d * jitter * rand.Float64()
+	}
+
+	return time.Duration(d)
+}
+
+// Sleep waits for the delay d, returning early with the context error
+// if the context is done first.
+func Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,50 @@
+package backoff
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type delayTestCase struct {
+	name    string
+	config  Config
+	attempt int
+	expect  time.Duration
+}
+
+var delayTestTable = []delayTestCase{
+	{"defaults first", Config{}, 0, DefaultInitial},
+	{"defaults second", Config{}, 1, 2 * DefaultInitial},
+	{"defaults third", Config{}, 2, 4 * DefaultInitial},
+	{"defaults capped", Config{}, 100, DefaultMax},
+	{"custom", Config{Initial: time.Second, Multiplier: 3}, 2, 9 * time.Second},
+	{"custom capped", Config{Initial: time.Second, Max: 5 * time.Second}, 3, 5 * time.Second},
+}
+
+func TestDelay(t *testing.T) {
+	for _, data := range delayTestTable {
+		d := data.config.Delay(data.attempt)
+		if d != data.expect {
+			t.Errorf("%s: expected=%v got=%v", data.name, data.expect, d)
+		}
+	}
+}
+
+func TestDelayJitter(t *testing.T) {
+	c := Config{Initial: time.Second, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		d := c.Delay(0)
+		if d < 500*time.Millisecond || d > time.Second {
+			t.Errorf("delay out of jitter range: %v", d)
+		}
+	}
+}
+
+func TestSleepCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Sleep(ctx, time.Hour); err == nil {
+		t.Errorf("expected error from canceled context")
+	}
+}
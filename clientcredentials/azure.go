@@ -0,0 +1,137 @@
+package clientcredentials
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Azure AD token endpoint versions for Options.AzureEndpointVersion.
+const (
+	// AzureEndpointAuto detects the version from TokenURL.
+	AzureEndpointAuto = ""
+
+	// AzureEndpointV1 is the Azure AD v1 endpoint, which takes a resource parameter.
+	AzureEndpointV1 = "v1"
+
+	// AzureEndpointV2 is the Azure AD v2 endpoint, which takes a scope ending with /.default.
+	AzureEndpointV2 = "v2"
+
+	// AzureEndpointNone disables Azure AD handling.
+	AzureEndpointNone = "none"
+)
+
+const azureDefaultScopeSuffix = "/.default"
+
+// azureDefaultLoginHost is the Azure AD login host for the public cloud.
+const azureDefaultLoginHost = "login.microsoftonline.com"
+
+// azureLoginHosts lists Azure AD login hosts for public and sovereign clouds.
+var azureLoginHosts = []string{
+	"login.microsoftonline.com",
+	"login.microsoftonline.us",
+	"login.chinacloudapi.cn",
+	"login.partner.microsoftonline.cn",
+}
+
+// detectAzureEndpointVersion finds the Azure AD endpoint version from the token URL.
+// It returns AzureEndpointNone for non-Azure URLs.
+func detectAzureEndpointVersion(tokenURL string) string {
+	u, errParse := url.Parse(tokenURL)
+	if errParse != nil {
+		return AzureEndpointNone
+	}
+
+	var azure bool
+	for _, h := range azureLoginHosts {
+		if strings.EqualFold(u.Hostname(), h) {
+			azure = true
+			break
+		}
+	}
+	if !azure {
+		return AzureEndpointNone
+	}
+
+	path := strings.TrimSuffix(u.Path, "/")
+
+	switch {
+	case strings.HasSuffix(path, "/oauth2/v2.0/token"):
+		return AzureEndpointV2
+	case strings.HasSuffix(path, "/oauth2/token"):
+		return AzureEndpointV1
+	}
+
+	return AzureEndpointNone
+}
+
+// azureAdjustOptions converts Scope/Audience/Resources into the form
+// expected by the Azure AD endpoint version.
+//
+// v1 expects a single resource parameter: it is taken from Audience,
+// Resources, or from Scope stripped of the /.default suffix.
+//
+// v2 expects scope=<resource>/.default: when Scope is empty, it is
+// derived from Audience or from the single resource.
+func azureAdjustOptions(options Options) Options {
+	version := options.AzureEndpointVersion
+	if version == AzureEndpointAuto {
+		version = detectAzureEndpointVersion(options.TokenURL)
+	}
+
+	switch version {
+	case AzureEndpointV1:
+		if len(options.Resources) == 0 {
+			resource := options.Audience
+			if resource == "" {
+				resource = strings.TrimSuffix(options.Scope, azureDefaultScopeSuffix)
+			}
+			if resource != "" {
+				options.Resources = []string{resource}
+			}
+		}
+		options.Audience = ""
+		options.Scope = ""
+	case AzureEndpointV2:
+		if options.Scope == "" {
+			resource := options.Audience
+			if resource == "" && len(options.Resources) == 1 {
+				resource = options.Resources[0]
+			}
+			if resource != "" {
+				options.Scope = strings.TrimSuffix(resource, "/") + azureDefaultScopeSuffix
+			}
+		}
+		options.Audience = ""
+		options.Resources = nil
+	}
+
+	return options
+}
+
+// AzureADOptions presets options for Azure AD tenantID.
+// If TokenURL is unspecified, it is built for the public cloud using
+// AzureEndpointVersion, defaulting to the v2 endpoint.
+// Expiration is taken from the JWT exp claim when the response lacks
+// expires_in, since Azure AD v1 may send only expires_on.
+func AzureADOptions(tenantID string, options Options) Options {
+	if options.TokenURL == "" {
+		if options.AzureEndpointVersion == AzureEndpointAuto {
+			options.AzureEndpointVersion = AzureEndpointV2
+		}
+		path := "oauth2/v2.0/token"
+		if options.AzureEndpointVersion == AzureEndpointV1 {
+			path = "oauth2/token"
+		}
+		options.TokenURL = fmt.Sprintf("https://%s/%s/%s",
+			azureDefaultLoginHost, url.PathEscape(tenantID), path)
+	}
+	options.ExpireFromJWT = true
+	return options
+}
+
+// NewAzureAD creates a client for Azure AD tenantID.
+// See AzureADOptions.
+func NewAzureAD(tenantID string, options Options) *Client {
+	return New(AzureADOptions(tenantID, options))
+}
@@ -0,0 +1,99 @@
+package clientcredentials
+
+import (
+	"strings"
+	"testing"
+)
+
+type azureTestCase struct {
+	name            string
+	options         Options
+	expectScope     string
+	expectAudience  string
+	expectResources string
+}
+
+var azureTestTable = []azureTestCase{
+	{
+		"not azure",
+		Options{TokenURL: "https://example.com/oauth2/token", Audience: "aud1", Scope: "s1"},
+		"s1", "aud1", "",
+	},
+	{
+		"v1 from audience",
+		Options{TokenURL: "https://login.microsoftonline.com/tenant/oauth2/token", Audience: "api://app1", Scope: "s1"},
+		"", "", "api://app1",
+	},
+	{
+		"v1 from scope",
+		Options{TokenURL: "https://login.microsoftonline.com/tenant/oauth2/token", Scope: "api://app1/.default"},
+		"", "", "api://app1",
+	},
+	{
+		"v2 from audience",
+		Options{TokenURL: "https://login.microsoftonline.com/tenant/oauth2/v2.0/token", Audience: "api://app1/"},
+		"api://app1/.default", "", "",
+	},
+	{
+		"v2 from resource",
+		Options{TokenURL: "https://login.microsoftonline.com/tenant/oauth2/v2.0/token", Resources: []string{"api://app1"}},
+		"api://app1/.default", "", "",
+	},
+	{
+		"v2 keep scope",
+		Options{TokenURL: "https://login.microsoftonline.com/tenant/oauth2/v2.0/token", Scope: "api://app2/.default", Audience: "api://app1"},
+		"api://app2/.default", "", "",
+	},
+	{
+		"explicit v2",
+		Options{TokenURL: "https://proxy.internal/token", AzureEndpointVersion: AzureEndpointV2, Audience: "api://app1"},
+		"api://app1/.default", "", "",
+	},
+	{
+		"explicit none",
+		Options{TokenURL: "https://login.microsoftonline.com/tenant/oauth2/token", AzureEndpointVersion: AzureEndpointNone, Audience: "aud1"},
+		"", "aud1", "",
+	},
+}
+
+func TestAzureAdjustOptions(t *testing.T) {
+	for _, data := range azureTestTable {
+		o := azureAdjustOptions(data.options)
+		if o.Scope != data.expectScope {
+			t.Errorf("%s: expectedScope=%q gotScope=%q", data.name, data.expectScope, o.Scope)
+		}
+		if o.Audience != data.expectAudience {
+			t.Errorf("%s: expectedAudience=%q gotAudience=%q", data.name, data.expectAudience, o.Audience)
+		}
+		if r := strings.Join(o.Resources, " "); r != data.expectResources {
+			t.Errorf("%s: expectedResources=%q gotResources=%q", data.name, data.expectResources, r)
+		}
+	}
+}
+
+func TestAzureADOptions(t *testing.T) {
+
+	o := AzureADOptions("tenant1", Options{Audience: "api://app1"})
+	if o.TokenURL != "https://login.microsoftonline.com/tenant1/oauth2/v2.0/token" {
+		t.Errorf("v2: unexpected token URL: %q", o.TokenURL)
+	}
+	if !o.ExpireFromJWT {
+		t.Errorf("v2: expected ExpireFromJWT")
+	}
+	if o = azureAdjustOptions(o); o.Scope != "api://app1/.default" {
+		t.Errorf("v2: unexpected scope: %q", o.Scope)
+	}
+
+	o = AzureADOptions("tenant1", Options{Audience: "api://app1", AzureEndpointVersion: AzureEndpointV1})
+	if o.TokenURL != "https://login.microsoftonline.com/tenant1/oauth2/token" {
+		t.Errorf("v1: unexpected token URL: %q", o.TokenURL)
+	}
+	if o = azureAdjustOptions(o); strings.Join(o.Resources, " ") != "api://app1" {
+		t.Errorf("v1: unexpected resources: %q", o.Resources)
+	}
+
+	o = AzureADOptions("tenant1", Options{TokenURL: "https://login.microsoftonline.us/tenant1/oauth2/token"})
+	if o.TokenURL != "https://login.microsoftonline.us/tenant1/oauth2/token" {
+		t.Errorf("custom: unexpected token URL: %q", o.TokenURL)
+	}
+}
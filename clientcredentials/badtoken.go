@@ -0,0 +1,52 @@
+package clientcredentials
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// isBadToken reports whether the target server rejected the token.
+func (c *Client) isBadToken(resp *http.Response) bool {
+	if c.options.IsBadTokenResponse != nil {
+		return c.options.IsBadTokenResponse(resp)
+	}
+	return resp.StatusCode == http.StatusUnauthorized
+}
+
+// IsInvalidTokenResponse reports responses with status 401, or carrying
+// the RFC 6750 WWW-Authenticate error="invalid_token", e.g. with status 403.
+// Useful as building block for Options.IsBadTokenResponse.
+func IsInvalidTokenResponse(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusUnauthorized {
+		return true
+	}
+	for _, h := range resp.Header.Values("WWW-Authenticate") {
+		if strings.Contains(h, `error="invalid_token"`) {
+			return true
+		}
+	}
+	return false
+}
+
+// PeekBody returns up to n bytes from the start of the response body,
+// restoring the body so it is still fully readable by the caller.
+// Useful for Options.IsBadTokenResponse to detect vendor-specific
+// token-expired payloads.
+func PeekBody(resp *http.Response, n int64) ([]byte, error) {
+	if resp.Body == nil || resp.Body == http.NoBody {
+		return nil, nil
+	}
+	buf, errRead := io.ReadAll(io.LimitReader(resp.Body, n))
+	resp.Body = &peekedBody{
+		Reader: io.MultiReader(bytes.NewReader(buf), resp.Body),
+		Closer: resp.Body,
+	}
+	return buf, errRead
+}
+
+type peekedBody struct {
+	io.Reader
+	io.Closer
+}
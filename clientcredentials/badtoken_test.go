@@ -0,0 +1,91 @@
+package clientcredentials
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+func TestIsBadTokenResponse(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+
+	expiredPayload := func(resp *http.Response) bool {
+		snippet, _ := PeekBody(resp, 64)
+		return bytes.Contains(snippet, []byte("token_expired"))
+	}
+
+	table := []struct {
+		name               string
+		isBadToken         func(resp *http.Response) bool
+		status             int
+		wwwAuthenticate    string
+		body               string
+		expectTokenFetches int
+	}{
+		{"default ignores 403", nil, 403, `Bearer error="invalid_token"`, `{}`, 1},
+		{"default evicts on 401", nil, 401, "", `{}`, 2},
+		{"invalid token on 403", IsInvalidTokenResponse, 403, `Bearer error="invalid_token"`, `{}`, 2},
+		{"insufficient scope on 403", IsInvalidTokenResponse, 403, `Bearer error="insufficient_scope"`, `{}`, 1},
+		{"vendor payload", expiredPayload, 400, "", `{"code":"token_expired"}`, 2},
+	}
+
+	for _, data := range table {
+
+		tokenServerStat := serverStat{}
+		ts := newTokenServer(&tokenServerStat, clientID, clientSecret, "abc", 60)
+
+		var requests int
+		var gotBody string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			requests++
+			if requests == 1 {
+				if data.wwwAuthenticate != "" {
+					w.Header().Set("WWW-Authenticate", data.wwwAuthenticate)
+				}
+				httpJSON(w, data.body, data.status)
+				return
+			}
+			httpJSON(w, `{"message":"ok"}`, http.StatusOK)
+		}))
+
+		client := New(Options{
+			TokenURL:            ts.URL,
+			ClientID:            clientID,
+			ClientSecret:        clientSecret,
+			IsBadTokenResponse:  data.isBadToken,
+			GroupcacheWorkspace: groupcache.NewWorkspace(),
+		})
+
+		for i := range 2 {
+			req, errReq := http.NewRequest("GET", srv.URL, nil)
+			if errReq != nil {
+				t.Fatalf("%s: request: %v", data.name, errReq)
+			}
+			resp, errDo := client.Do(req)
+			if errDo != nil {
+				t.Fatalf("%s: do %d: %v", data.name, i, errDo)
+			}
+			if i == 0 {
+				body, _ := io.ReadAll(resp.Body)
+				gotBody = string(bytes.TrimSpace(body))
+			}
+			resp.Body.Close()
+		}
+
+		if gotBody != data.body {
+			t.Errorf("%s: response body not preserved: %q", data.name, gotBody)
+		}
+		if tokenServerStat.count != data.expectTokenFetches {
+			t.Errorf("%s: expected %d token fetches, got %d", data.name, data.expectTokenFetches, tokenServerStat.count)
+		}
+
+		srv.Close()
+		ts.Close()
+	}
+}
@@ -3,23 +3,38 @@ package clientcredentials
 
 import (
 	"context"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/modernprogram/groupcache/v2"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/udhos/groupcache_exporter/groupcache/modernprogram"
+	"github.com/udhos/groupcache_oauth2/backoff"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // DefaultGroupCacheSizeBytes is default group cache size when unspecified.
 const DefaultGroupCacheSizeBytes = 10_000_000
 
+// GrantTypeJWTBearer is the RFC 7523 grant type used with Options.Assertion.
+const GrantTypeJWTBearer = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
 // HTTPClientDoer interface allows the caller to easily plug in a custom http client.
 type HTTPClientDoer interface {
 	Do(req *http.Request) (*http.Response, error)
@@ -31,19 +46,248 @@ type Options struct {
 	// URL. This is a constant specific to each server.
 	TokenURL string
 
+	// CredentialsProvider optionally supplies client credentials per
+	// request, overriding ClientID and ClientSecret, e.g. from database
+	// lookups or secret managers. Requests are served by clients derived
+	// with WithCredentials, sharing the cache.
+	// Credentials from ContextWithCredentials take precedence.
+	CredentialsProvider CredentialsProvider
+
+	// BasicAuthCredentials takes per-request client credentials from an
+	// incoming "Authorization: Basic" request header, for proxies and
+	// gateways forwarding calls on behalf of their callers. The header is
+	// consumed: it is not sent to the target server, and it does not
+	// trigger PreserveAuthorization. Requests are served by clients
+	// derived with WithCredentials, sharing the cache under keys bound to
+	// the presented secret, thus callers with a wrong secret are refused
+	// by the token server.
+	// Credentials from ContextWithCredentials take precedence, and
+	// CredentialsProvider is used for requests without the header.
+	// Distinct credentials are bounded by MaxIdentities.
+	BasicAuthCredentials bool
+
+	// ExtractCredentials optionally takes per-request client credentials
+	// from the request, e.g. from JWT claims, mTLS client certificates or
+	// cookies, for gateways. It reports ok=false for requests without
+	// credentials, which then fall back to BasicAuthCredentials and
+	// CredentialsProvider. Requests are served by clients derived with
+	// WithCredentials, sharing the cache under keys bound to the extracted
+	// secret, thus callers with a wrong secret are refused by the token
+	// server. The function must not modify
+	// the request. Credentials from ContextWithCredentials take precedence.
+	// Distinct credentials are bounded by MaxIdentities.
+	ExtractCredentials func(req *http.Request) (clientID, clientSecret string, ok bool)
+
+	// ForceRefreshHeader optionally names a request header, e.g.
+	// "oauth2-force-refresh", whose true value, see strconv.ParseBool,
+	// evicts the cached token and fetches a new one for that request,
+	// e.g. for incident response or upstreams rejecting replayed tokens.
+	// The header is not sent to the target server. See also
+	// ContextWithForceRefresh.
+	// If unspecified, refresh is not forced by request headers.
+	ForceRefreshHeader string
+
+	// TokenURLHeader optionally names a request header, e.g.
+	// "oauth2-token-url", selecting the token endpoint for that request,
+	// e.g. a per-tenant identity provider. Tokens from distinct endpoints
+	// are cached under distinct keys, see WithTokenURL. The header is not
+	// sent to the target server. Since client credentials are sent to the
+	// selected endpoint, it must be either TokenURL or listed in
+	// AllowedTokenURLs, otherwise the request fails with
+	// *TokenURLNotAllowedError. See also ContextWithTokenURL, which takes
+	// precedence over the header.
+	// If unspecified, the token endpoint is not taken from request headers.
+	TokenURLHeader string
+
+	// AllowedTokenURLs lists the token endpoints selectable with
+	// TokenURLHeader.
+	AllowedTokenURLs []string
+
+	// ScopeHeader optionally names a request header, e.g. "oauth2-scope",
+	// overriding Scope for that request. Tokens for distinct scopes are
+	// cached under distinct keys, see WithScope. The header is not sent
+	// to the target server. See also ContextWithScope, which takes
+	// precedence over the header. Distinct scopes are bounded by
+	// MaxIdentities.
+	// If unspecified, the scope is not taken from request headers.
+	ScopeHeader string
+
+	// FallbackClientSecrets optionally lists previous client secrets for
+	// zero-downtime secret rotation. When the token server rejects the
+	// secret in use as invalid_client, or with status 401, the next secret
+	// is tried, starting from ClientSecret. The secret that worked last is
+	// used first for subsequent fetches and for introspection.
+	// Moving to the next secret is reported as FallbackSecret.
+	FallbackClientSecrets []string
+
+	// TokenURLs optionally lists alternate token endpoints, e.g. for IdPs
+	// deployed in active/active regions. When the endpoint in use fails
+	// with a transient error (network error, HTTP 429 or 5xx), the next
+	// endpoint is tried, starting from TokenURL. The endpoint that answered
+	// last is used first for subsequent fetches. The cache key includes
+	// only TokenURL. Moving to the next endpoint is reported as
+	// FallbackTokenURL.
+	TokenURLs []string
+
+	// GrantType overrides the grant_type parameter sent to the token endpoint,
+	// for proprietary extension grants.
+	// If unspecified, defaults to client_credentials.
+	GrantType string
+
 	// ClientID is the application's ID.
 	ClientID string
 
+	// Assertion optionally provides a signed JWT for the RFC 7523
+	// jwt-bearer grant, called for every token request. When defined,
+	// the assertion parameter is sent instead of client_id and client_secret,
+	// and GrantType defaults to GrantTypeJWTBearer.
+	Assertion func() (string, error)
+
+	// ScopedAssertion is like Assertion, for assertions carrying the scope,
+	// e.g. Google service accounts. It is called with the scope of the
+	// requesting client, see WithScope, and the scope parameter is not sent.
+	// Takes precedence over Assertion.
+	ScopedAssertion func(scope string) (string, error)
+
 	// ClientSecret is the application's secret.
 	ClientSecret string
 
+	// ClientAuthBasic sends client_id and client_secret to the token
+	// server in the HTTP Basic authorization header (RFC 6749
+	// client_secret_basic) instead of the request body.
+	ClientAuthBasic bool
+
+	// ClientAuthBasicNoEncoding sends client credentials in HTTP Basic
+	// authorization headers as is, for servers failing on encoded values.
+	// By default, client_id and client_secret are form-encoded before
+	// Basic encoding, as required by RFC 6749 section 2.3.1, so secrets
+	// holding characters like '%', '+', ':' or non-ASCII characters are
+	// decoded correctly. Applies to ClientAuthBasic and introspection.
+	ClientAuthBasicNoEncoding bool
+
 	// Scope specifies optional space-separated requested permissions.
 	Scope string
 
+	// Audience optionally specifies the audience parameter sent to the
+	// token server. Tokens are cached separately for each audience.
+	Audience string
+
+	// Resources optionally specifies RFC 8707 resource indicators, each
+	// one sent as a resource parameter to the token server.
+	// Tokens are cached separately for each set of resources.
+	Resources []string
+
+	// CacheKeyFunc optionally builds the cache key from token parameters,
+	// e.g. to keep apart tokens for the same clientID requested with
+	// different scopes or token URLs. If unspecified, the key is the
+	// clientID, extended with audience and resources when defined.
+	CacheKeyFunc func(clientID, scope, tokenURL, audience string) string
+
+	// AzureEndpointVersion selects Azure AD token endpoint handling:
+	// AzureEndpointV1 sends the resource parameter, AzureEndpointV2 sends
+	// scope <resource>/.default. Scope, Audience and Resources are
+	// converted accordingly. If unspecified, the version is detected
+	// from TokenURL. Set to AzureEndpointNone to disable.
+	AzureEndpointVersion string
+
+	// DefaultTokenType is the Authorization header scheme used when the
+	// token response omits token_type. If unspecified, defaults to Bearer.
+	DefaultTokenType string
+
+	// AuthorizationHeader is the request header carrying the token,
+	// for APIs not accepting the standard header.
+	// If unspecified, defaults to Authorization.
+	AuthorizationHeader string
+
+	// AuthorizationScheme optionally replaces the token type as scheme
+	// of the authorization header value, e.g. "Token" for "Token <t>".
+	// Set to AuthorizationSchemeNone to send the raw token.
+	AuthorizationScheme string
+
+	// InjectToken optionally replaces the authorization header, delivering
+	// the access token to the target server, e.g. as query parameter, cookie
+	// or multiple headers for legacy backends. It receives a copy of the
+	// request, so the caller's request, including its URL, is not modified.
+	// AuthorizationHeader and AuthorizationScheme are then ignored.
+	InjectToken func(req *http.Request, token string)
+
+	// EndpointParams specifies additional parameters for requests to the token endpoint,
+	// for IdPs requiring vendor-specific fields such as tenant or api_version.
+	// Values replace any parameter with the same name set by the client.
+	EndpointParams url.Values
+
+	// ExpireFromJWT enables taking token expiration from the exp claim
+	// of a JWT access token when the token response carries neither
+	// expires_in nor expires_on.
+	ExpireFromJWT bool
+
+	// ParseTokenResponse optionally decodes the token server response body,
+	// for nonstandard token servers, e.g. XML bodies or wrapped JSON.
+	// If unspecified, the standard JSON response is parsed.
+	ParseTokenResponse func(body []byte) (TokenInfo, error)
+
+	// OnTokenResponse is optionally called for every token server response,
+	// exposing status, headers and sanitized body, e.g. for vendors sending
+	// rate-limit metadata in headers.
+	OnTokenResponse func(resp TokenResponse)
+
+	// RequireTLS rejects non-HTTPS token, introspection and target URLs
+	// with *InsecureURLError: New panics on insecure TokenURL or
+	// IntrospectionURL, and Do fails on insecure target URLs.
+	RequireTLS bool
+
+	// InsecureHostsAllowed lists hosts exempted from RequireTLS,
+	// e.g. localhost for development.
+	InsecureHostsAllowed []string
+
 	// HTTPClient provides the actual HTTP client to use.
-	// If unspecified, defaults to http.DefaultClient.
+	// If unspecified, defaults to http.DefaultClient, unless any Dial*
+	// option is set, in which case an internal client is constructed.
 	HTTPClient HTTPClientDoer
 
+	// Middlewares optionally wrap HTTPClient for requests to the target
+	// server, which carry the token. The first middleware is the outermost,
+	// thus the first to see the request. Token requests are not affected.
+	Middlewares []Middleware
+
+	// TokenHTTPClient optionally provides the HTTP client for requests to
+	// the token server and the introspection endpoint, e.g. with different
+	// proxy or TLS settings than the target server.
+	// If unspecified, defaults to HTTPClient.
+	TokenHTTPClient HTTPClientDoer
+
+	// TokenRequestTimeout optionally limits the time spent on each token
+	// request attempt, see TokenRetries.
+	// If unspecified, only the request context limits token requests.
+	TokenRequestTimeout time.Duration
+
+	// TokenWaitTimeout optionally limits the total time spent acquiring a
+	// token for a request, including peer fetches, waiting for concurrent
+	// fetches and retries, so slow token acquisition cannot consume the
+	// whole caller deadline before the request is sent. Stale tokens,
+	// see StaleTokenGracePeriod, are still served on timeout.
+	// If unspecified, only the request context limits token acquisition.
+	TokenWaitTimeout time.Duration
+
+	// DialTimeout limits the time spent establishing connections.
+	// Used only for the internally constructed HTTP client.
+	DialTimeout time.Duration
+
+	// DialResolver optionally provides a custom DNS resolver.
+	// Used only for the internally constructed HTTP client.
+	DialResolver *net.Resolver
+
+	// DialNetwork forces the IP family: "tcp4" or "tcp6".
+	// If unspecified, dual-stack "tcp" is used.
+	// Used only for the internally constructed HTTP client.
+	DialNetwork string
+
+	// DialFallbackDelay is the happy eyeballs (RFC 6555) delay before
+	// falling back from IPv6 to IPv4. 0 means Go default (300ms),
+	// negative disables fallback.
+	// Used only for the internally constructed HTTP client.
+	DialFallbackDelay time.Duration
+
 	// HTTPStatusOkMin is the minimum token server response status code accepted as Ok.
 	// If undefined, defaults to 200.
 	HTTPStatusOkMin int
@@ -66,10 +310,163 @@ type Options struct {
 	//
 	SoftExpireInSeconds int
 
-	// GroupcacheWorkspace is required groupcache workspace.
+	// MinTokenLifetime rejects tokens whose expires_in is below this value
+	// with *ShortLifetimeError, instead of caching them.
+	// Tokens with lifetime shorter than the soft expire period, that would
+	// be cached already expired, are instead cached for half their lifetime.
+	// Tokens with negative lifetime, e.g. a custom ParseTokenResponse
+	// returning an expiry in the past, are always rejected.
+	// If unspecified, any lifetime is accepted.
+	MinTokenLifetime time.Duration
+
+	// MaxTokenLifetime caps the token lifetime, for security policies
+	// requiring frequent re-authentication. Tokens are considered expired
+	// after this period even if the token server reports a longer lifetime,
+	// or no expiry at all.
+	// If unspecified, the lifetime reported by the token server is used.
+	MaxTokenLifetime time.Duration
+
+	// SoftExpireJitter adds a random extra soft expire period between 0 and
+	// this value, so replicas sharing a workspace do not all renew the token
+	// at the same time. Ignored when RefreshScheduler is defined.
+	SoftExpireJitter time.Duration
+
+	// RefreshAhead keeps serving cached tokens until hard expiration,
+	// renewing them in background once they are due for renewal,
+	// so request latency does not include the token fetch.
+	RefreshAhead bool
+
+	// RefreshScheduler optionally decides when cached tokens are renewed,
+	// for custom policies. If unspecified, tokens are renewed
+	// SoftExpireInSeconds before hard expiration.
+	RefreshScheduler RefreshScheduler
+
+	// CacheTTLPolicy optionally limits how long tokens are kept in cache,
+	// regardless of their validity. Expired cache entries are fetched again.
+	// If unspecified, tokens are cached until due for renewal, or until hard
+	// expiration with RefreshAhead.
+	CacheTTLPolicy CacheTTLPolicy
+
+	// TokenTTLFunc optionally overrides, per client, the time a token is
+	// cached before renewal, regardless of the expires_in reported by
+	// the token server, e.g. shorter for high-privilege clients.
+	// The TTL is capped at the token lifetime. Zero or negative keeps the
+	// default, see RefreshScheduler.
+	TokenTTLFunc func(clientID string, resp TokenResponse) time.Duration
+
+	// TokenRetries is the number of retries for token requests failing
+	// with transient errors: network errors, HTTP 429 and 5xx.
+	// The Retry-After header is honored up to TokenRetryBackoff.Max.
+	// If unspecified, token requests are not retried.
+	TokenRetries int
+
+	// TokenRetryBackoff defines the delay between token request retries.
+	// See backoff.Config for defaults.
+	TokenRetryBackoff backoff.Config
+
+	// TokenFetchRateLimit optionally bounds the number of token requests
+	// per clientID within TokenFetchRateInterval, protecting token servers
+	// that lock accounts after repeated failed attempts. Retries and
+	// attempts with FallbackClientSecrets or TokenURLs count as requests.
+	// Requests beyond the limit fail with *RateLimitError.
+	// If unspecified, the rate is unbounded.
+	TokenFetchRateLimit int
+
+	// TokenFetchRateInterval is the period for TokenFetchRateLimit.
+	// If unspecified, defaults to 1 minute.
+	TokenFetchRateInterval time.Duration
+
+	// MaxConcurrentFetches optionally bounds the number of token fetches
+	// in flight, shared by this client and clients derived from it, in
+	// order to protect the token server from bursts of distinct credentials.
+	// If unspecified, fetches are unbounded.
+	MaxConcurrentFetches int
+
+	// MaxConcurrentFetchesPerClient optionally bounds the number of
+	// token fetches in flight for each clientID.
+	// If unspecified, fetches are unbounded.
+	MaxConcurrentFetchesPerClient int
+
+	// MaxIdentities optionally bounds the number of clients derived with
+	// WithCredentials, WithScope or WithAudience, hence the number of
+	// distinct cached credentials, e.g. supplied by untrusted callers.
+	// IdentityOverflow decides what happens beyond the limit. See
+	// TokenFetchRateLimit to bound the token server load.
+	// If unspecified, identities are unbounded, unless taken from request
+	// headers with ScopeHeader, BasicAuthCredentials or
+	// ExtractCredentials, which default to DefaultMaxIdentities.
+	// Set to -1 for unbounded identities.
+	MaxIdentities int
+
+	// IdentityOverflow selects what happens to new identities beyond
+	// MaxIdentities. With IdentityOverflowEvict, the least recently used
+	// identities have their tokens evicted; clients derived before
+	// eviction keep working, fetching tokens again. With
+	// IdentityOverflowReject, clients derived beyond the limit fail
+	// with ErrTooManyIdentities, keeping tokens of known identities.
+	// If unspecified, defaults to IdentityOverflowEvict.
+	IdentityOverflow string
+
+	// LocalCache keeps decoded tokens in process memory until cache
+	// expiration, so cache hits skip the TokenCache, e.g. groupcache
+	// lookup and value decoding. Tokens evicted on other instances
+	// are kept locally until expiration, as in the groupcache hot cache.
+	LocalCache bool
+
+	// DisableCache bypasses the token cache, so every request fetches
+	// a fresh token from the token server. Useful in tests and when
+	// diagnosing token issues. The Client API is unchanged.
+	DisableCache bool
+
+	// TokenCache optionally replaces groupcache as token cache, e.g.
+	// NewMemoryTokenCache or a shared cache such as Redis.
+	// Groupcache options, SummaryInterval, consistency checks and
+	// MetricsExporter apply only to the default groupcache.
+	TokenCache TokenCache
+
+	// CacheEncryptionKey optionally enables AES-GCM encryption of cached
+	// values, so access tokens are never stored or sent to groupcache peers
+	// in plaintext. The key must be 16, 24 or 32 bytes long, for AES-128,
+	// AES-192 or AES-256, and shared by all peers. Each value is bound to
+	// its cache key, so a value stored under another key fails to decrypt.
+	CacheEncryptionKey []byte
+
+	// CacheKeyHMACKey optionally replaces cache keys with their
+	// hex-encoded HMAC-SHA256, so client identifiers are not exposed
+	// in cache dumps, logs, metrics or peer traffic. The key must be
+	// shared by all peers.
+	CacheKeyHMACKey []byte
+
+	// CacheKeySecret optionally keys the HMAC-SHA256 digest of client
+	// secrets added to cache keys of clients derived with WithCredentials,
+	// so tokens are served only to callers presenting the right secret.
+	// The key must be shared by instances sharing a TokenCache, e.g. Redis,
+	// in order to share tokens of derived clients.
+	// If unspecified, a random key is generated per process.
+	CacheKeySecret []byte
+
+	// PersistDir optionally enables persisting cached tokens as files
+	// in this directory, so restarted instances reuse still-valid tokens
+	// instead of fetching new ones. Files hold access tokens and are
+	// created readable only by the owner.
+	PersistDir string
+
+	// GroupcacheWorkspace is required groupcache workspace,
+	// unless TokenCache or GroupcacheGroup is defined.
 	GroupcacheWorkspace *groupcache.Workspace
 
-	// GroupcacheName gives a unique cache name. If unspecified, defaults to oauth2.
+	// GroupcacheGroup optionally provides a group built and managed
+	// by the application, instead of creating one. The group getter must
+	// delegate token loads to Client.Getter. Other Groupcache options
+	// are ignored.
+	GroupcacheGroup *groupcache.Group
+
+	// GroupcacheName gives the cache name. If unspecified, defaults to oauth2.
+	// Clients created with the same workspace and name share a single
+	// group and its metrics, until the last client is closed. Cache keys
+	// include TokenURL and Scope, so tokens of clients sharing the group
+	// are kept apart, and every peer computes the same key for a client
+	// regardless of the order clients are created.
 	GroupcacheName string
 
 	// GroupcacheSizeBytes limits the cache size. If unspecified, defaults to 10MB.
@@ -78,9 +475,37 @@ type Options struct {
 	// Logf provides logging function, if undefined defaults to log.Printf
 	Logf func(format string, v ...any)
 
-	// Debug enables debug logging.
+	// Logger optionally emits structured logs at proper levels, with
+	// client_id and token_url attributes, plus cache_event and latency
+	// for cache and token fetch events. Logf is ignored when Logger
+	// is defined.
+	Logger *slog.Logger
+
+	// Debug enables debug logging. With Logger, debug records are
+	// emitted at slog.LevelDebug, subject to the handler level.
 	Debug bool
 
+	// RequestIDFunc optionally extracts the caller's request ID from the
+	// request context, added to log records from Do, DoWithOutput, Token
+	// and token fetches, for multi-tenant debugging.
+	// If unspecified, the trace ID is taken from the W3C traceparent
+	// request header, or from the OpenTelemetry span context.
+	RequestIDFunc func(ctx context.Context) string
+
+	// UnsafeDebugSecrets logs token responses verbatim in debug output,
+	// including access tokens, for local debugging only. By default,
+	// secret fields are redacted from debug output.
+	UnsafeDebugSecrets bool
+
+	// DumpTokenExchange logs the full token request and response, like
+	// httputil.DumpRequestOut and httputil.DumpResponse, to diagnose token
+	// server integration problems. Client secrets, assertions and
+	// Authorization headers are masked; token response secret fields are
+	// redacted unless UnsafeDebugSecrets. Dumps are logged at
+	// slog.LevelDebug, subject to the Logger handler level, and do not
+	// require Debug.
+	DumpTokenExchange bool
+
 	// DisablePurgeExpired disables removing all expired items when the oldest item is removed.
 	DisablePurgeExpired bool
 
@@ -89,22 +514,213 @@ type Options struct {
 
 	// GroupcacheHotCacheWeight defaults to 1 if unspecified.
 	GroupcacheHotCacheWeight int64
+
+	// IsBadTokenResponse optionally detects target server responses
+	// rejecting the token, which is then evicted from the cache, e.g.
+	// 403 responses or vendor-specific token-expired payloads.
+	// See IsInvalidTokenResponse and PeekBody.
+	// If unspecified, only responses with status 401 reject the token.
+	IsBadTokenResponse func(resp *http.Response) bool
+
+	// RetryOnUnauthorized sends the request once more with a fresh token
+	// when the target server rejects the token, see IsBadTokenResponse,
+	// returning the second response.
+	// Requests of any method are retried, since the target server did not
+	// process the rejected request. The request body is rewound with
+	// req.GetBody; requests with a body but without GetBody fail with
+	// ErrBodyNotReplayable. Not applied when introspection reports the
+	// rejected token as still active.
+	RetryOnUnauthorized bool
+
+	// PreserveAuthorization skips token injection for requests already
+	// carrying the authorization header, see AuthorizationHeader, which are
+	// sent as is. See also WithPreserveAuthorization.
+	PreserveAuthorization bool
+
+	// OutputHeaders lists target response headers to be copied into
+	// Output.Headers by DoWithOutput, e.g. rate-limit headers or request IDs.
+	OutputHeaders []string
+
+	// StaleTokenGracePeriod enables offline operation: if the token server
+	// is unreachable (network error, 5xx status, or token load failure
+	// relayed by the groupcache owner peer) and the last good token
+	// is hard-expired by less than this period, the stale token is still used.
+	// Each such usage is logged as warning and counted in metrics.
+	// If unspecified, stale tokens are never used.
+	StaleTokenGracePeriod time.Duration
+
+	// StaleWhileRevalidate enables serving a token for this period after
+	// its cache expiration, while a background fetch renews it, protecting
+	// request latency and availability during brief token server outages.
+	// Tokens are never served beyond hard expiration, thus the effective
+	// period is limited by SoftExpireInSeconds.
+	// If unspecified, expired tokens are renewed synchronously.
+	StaleWhileRevalidate time.Duration
+
+	// IntrospectionURL enables RFC 7662 token introspection. Tokens
+	// rejected by the target server, see IsBadTokenResponse, are checked
+	// against this endpoint and evicted only when inactive, or when
+	// introspection fails.
+	// The client authenticates to the endpoint with ClientID and ClientSecret.
+	IntrospectionURL string
+
+	// IntrospectionInterval enables periodic introspection of cached
+	// tokens, evicting inactive ones. Requires IntrospectionURL.
+	// Call Close to stop periodic introspection. See also Runner.
+	// If unspecified, tokens are introspected only when rejected.
+	IntrospectionInterval time.Duration
+
+	// SummaryInterval enables a periodic INFO log with cache size, hit
+	// ratio, token fetch and failure counts since the last summary,
+	// for environments without metrics scraping.
+	// Call Close to stop the summary. See also Runner.
+	// If unspecified, no summary is logged.
+	SummaryInterval time.Duration
+
+	// ConsistencyCheckInterval enables periodic consistency checks, see
+	// CheckConsistency. Requires ConsistencyPeers.
+	// Call Close to stop the checks. See also Runner.
+	// If unspecified, checks run only on demand.
+	ConsistencyCheckInterval time.Duration
+
+	// ConsistencyPeers locates key owner peers for periodic consistency
+	// checks, usually the *groupcache.HTTPPool.
+	ConsistencyPeers groupcache.PeerPicker
+
+	// Runner optionally runs the periodic background tasks enabled by
+	// IntrospectionInterval, SummaryInterval and ConsistencyCheckInterval,
+	// and can be shared by many clients. If unspecified, a private runner
+	// is created when needed.
+	Runner *Runner
+
+	// OnFallback is optionally called whenever the client degrades
+	// operation, e.g. serving a stale token, so silent degradations
+	// can be alerted on. See FallbackEvent. Every fallback is also
+	// counted in metrics by reason.
+	OnFallback func(event FallbackEvent)
+
+	// OnInvalidCredentials is optionally called whenever the token server
+	// refuses client credentials as invalid_client, or with status 401,
+	// with the credential source, so gateways taking credentials from
+	// callers can block or throttle repeated offenders. Refusals are also
+	// counted in metrics by client_id and source.
+	OnInvalidCredentials func(event InvalidCredentialsEvent)
+
+	// SecurityEvents optionally receives authentication security events:
+	// token issued, token rejected by the target server, and client
+	// credentials refused by the token server. See NewJSONSecuritySink.
+	SecurityEvents SecuritySink
+
+	// SecurityAppID optionally identifies the application in security events.
+	SecurityAppID string
+
+	// ExpvarName optionally publishes client and cache counters with
+	// expvar, under this name, for services relying on /debug/vars
+	// instead of Prometheus. The name must be unique in the process.
+	// Cache counters are available only for the default groupcache
+	// TokenCache. If unspecified, counters are not published.
+	ExpvarName string
+
+	// MetricsRegisterer optionally registers client metrics.
+	// Clients registering into the same MetricsRegisterer, with the same
+	// MetricsNamespace and cache name, share metrics.
+	// If unspecified, metrics are not registered.
+	MetricsRegisterer prometheus.Registerer
+
+	// MetricsNamespace optionally prefixes metric names.
+	MetricsNamespace string
+
+	// TracerProvider optionally emits OpenTelemetry spans for Do and
+	// DoWithOutput, with the oauth2.cache_hit attribute, and for token
+	// requests, with the token URL and response status, so token
+	// acquisition shows up in distributed traces.
+	// If unspecified, no spans are emitted.
+	TracerProvider trace.TracerProvider
+
+	// MeterProvider optionally exports client metrics to OpenTelemetry,
+	// e.g. for OTLP, in addition to MetricsRegisterer. Instruments are
+	// named after the Prometheus metrics, without the _total suffix for
+	// counters, and labels are recorded as attributes.
+	// If unspecified, metrics are not exported to OpenTelemetry.
+	MeterProvider metric.MeterProvider
+
+	// MetricsClientIDLabel labels token fetch, lookup and rejection
+	// metrics with the client_id, e.g. to tell tenants apart. See
+	// MetricsMaxClientIDs.
+	// If unspecified, the client_id label is empty.
+	MetricsClientIDLabel bool
+
+	// MetricsMaxClientIDs caps the number of distinct client_id label
+	// values, protecting metrics cardinality from derived clients with
+	// untrusted credentials. Client IDs beyond the cap are labeled "other".
+	// If unspecified, defaults to 100.
+	MetricsMaxClientIDs int
 }
 
 // Client is context for invokations with client-credentials flow.
 type Client struct {
-	options Options
-	group   *groupcache.Group
+	options    Options
+	key        string         // cache key
+	doer       HTTPClientDoer // Options.HTTPClient wrapped by Options.Middlewares
+	cache      TokenCache
+	group      *groupcache.Group // nil unless using default groupcache
+	derived    bool              // derived with WithCredentials, WithScope, etc
+	persist    *persistStore     // nil unless Options.PersistDir
+	aead       cipher.AEAD       // nil unless Options.CacheEncryptionKey
+	limiter    *fetchLimiter     // nil unless Options.MaxConcurrentFetches*
+	rate       *fetchRateLimiter // nil unless Options.TokenFetchRateLimit
+	endpoints  *tokenEndpoints   // nil unless Options.TokenURLs
+	secrets    *clientSecrets    // nil unless Options.FallbackClientSecrets
+	tracer     trace.Tracer      // nil unless Options.TracerProvider
+	identities *identityLRU      // nil unless Options.MaxIdentities
+	rejected   error             // ErrTooManyIdentities beyond Options.MaxIdentities
+	tokens     *tokenStore
+	renewing   sync.Map  // keys being renewed by refresh-ahead
+	decoded    *sync.Map // key => *decodedToken
+	local      *sync.Map // key => *storedToken, with Options.LocalCache
+	metrics    *metrics
+	runner     *Runner
+	ownRunner  bool
+	tasks      []*runnerTask
+	leave      func() // leaves the shared group, see joinGroup
+
+	// derivedCache caches tokens for derived clients: the TokenCache,
+	// or a process-local cache with groupcache, see derive.
+	derivedCache TokenCache
+
+	// owners maps cache keys to the root or derived client loading them,
+	// shared among clients derived with WithScope or WithAudience.
+	owners        *sync.Map
+	scopeInKey    bool
+	tokenURLInKey bool // see WithTokenURL
+	secretInKey   bool // see WithCredentials
+	namespaced    bool // key includes TokenURL and Scope, see GroupcacheName
+
+	// rotations maps identity keys of clients derived with WithCredentials,
+	// see identityKey, to the key of the secret accepted last, shared by
+	// the family, see evictRotated.
+	rotations   *sync.Map
+	rotationKey string // hashed identityKey, with secretInKey
 }
 
 // New creates a client.
 func New(options Options) *Client {
-	if options.GroupcacheWorkspace == nil {
+	if options.TokenCache == nil && options.GroupcacheGroup == nil && options.GroupcacheWorkspace == nil {
 		panic("groupcache workspace is nil")
 	}
 
+	options = azureAdjustOptions(options)
+
 	if options.HTTPClient == nil {
-		options.HTTPClient = http.DefaultClient
+		if needCustomTransport(options) {
+			options.HTTPClient = newHTTPClient(options)
+		} else {
+			options.HTTPClient = http.DefaultClient
+		}
+	}
+
+	if options.TokenHTTPClient == nil {
+		options.TokenHTTPClient = options.HTTPClient
 	}
 
 	switch options.SoftExpireInSeconds {
@@ -114,6 +730,49 @@ func New(options Options) *Client {
 		options.SoftExpireInSeconds = 0
 	}
 
+	if options.GrantType == "" {
+		if options.Assertion != nil || options.ScopedAssertion != nil {
+			options.GrantType = GrantTypeJWTBearer
+		} else {
+			options.GrantType = "client_credentials"
+		}
+	}
+
+	if options.RefreshScheduler == nil {
+		options.RefreshScheduler = softExpireScheduler{
+			softExpire: time.Duration(options.SoftExpireInSeconds) * time.Second,
+			jitter:     options.SoftExpireJitter,
+		}
+	}
+
+	if options.DefaultTokenType == "" {
+		options.DefaultTokenType = "Bearer"
+	}
+
+	if options.AuthorizationHeader == "" {
+		options.AuthorizationHeader = "Authorization"
+	}
+	options.AuthorizationHeader = http.CanonicalHeaderKey(options.AuthorizationHeader)
+	options.ScopeHeader = http.CanonicalHeaderKey(options.ScopeHeader)
+	options.TokenURLHeader = http.CanonicalHeaderKey(options.TokenURLHeader)
+	options.ForceRefreshHeader = http.CanonicalHeaderKey(options.ForceRefreshHeader)
+
+	if options.MaxIdentities == 0 && headerIdentities(options) {
+		options.MaxIdentities = DefaultMaxIdentities
+	}
+
+	switch options.IdentityOverflow {
+	case "":
+		options.IdentityOverflow = IdentityOverflowEvict
+	case IdentityOverflowEvict, IdentityOverflowReject:
+	default:
+		panic(fmt.Sprintf("unknown identity overflow: %q", options.IdentityOverflow))
+	}
+
+	if options.MetricsMaxClientIDs < 1 {
+		options.MetricsMaxClientIDs = 100
+	}
+
 	if options.HTTPStatusOkMin == 0 {
 		options.HTTPStatusOkMin = 200
 	}
@@ -126,12 +785,38 @@ func New(options Options) *Client {
 	}
 
 	c := &Client{
-		options: options,
+		options:   options,
+		doer:      chain(options.HTTPClient, options.Middlewares),
+		tokens:    newTokenStore(),
+		owners:    &sync.Map{},
+		rotations: &sync.Map{},
+		decoded:   &sync.Map{},
+		local:     &sync.Map{},
+		limiter: newFetchLimiter(options.MaxConcurrentFetches,
+			options.MaxConcurrentFetchesPerClient),
+		rate: newFetchRateLimiter(options.TokenFetchRateLimit,
+			options.TokenFetchRateInterval),
+		identities: newIdentityLRU(options.MaxIdentities, options.IdentityOverflow == IdentityOverflowReject),
+		endpoints:  newTokenEndpoints(options.TokenURL, options.TokenURLs),
+		secrets:    newClientSecrets(options.ClientSecret, options.FallbackClientSecrets),
+		tracer:     newTracer(options.TracerProvider),
 	}
 
-	cacheSizeBytes := options.GroupcacheSizeBytes
-	if cacheSizeBytes == 0 {
-		cacheSizeBytes = DefaultGroupCacheSizeBytes
+	for _, u := range append([]string{options.TokenURL}, options.TokenURLs...) {
+		if errTLS := c.checkTLSString("token", u); errTLS != nil {
+			panic(errTLS)
+		}
+	}
+	if errTLS := c.checkTLSString("introspection", options.IntrospectionURL); errTLS != nil {
+		panic(errTLS)
+	}
+
+	if len(options.CacheEncryptionKey) > 0 {
+		aead, errCipher := newCacheCipher(options.CacheEncryptionKey)
+		if errCipher != nil {
+			panic(errCipher)
+		}
+		c.aead = aead
 	}
 
 	cacheName := options.GroupcacheName
@@ -139,150 +824,1132 @@ func New(options Options) *Client {
 		cacheName = "oauth2"
 	}
 
-	o := groupcache.Options{
-		Workspace:    options.GroupcacheWorkspace,
-		Name:         cacheName,
-		PurgeExpired: !options.DisablePurgeExpired,
-		CacheBytes:   cacheSizeBytes,
-		Getter: groupcache.GetterFunc(
-			func(ctx context.Context, _ /*key*/ string, dest groupcache.Sink) error {
+	if options.PersistDir != "" {
+		p, errPersist := newPersistStore(options.PersistDir)
+		if errPersist != nil {
+			c.errorf("persist dir: %v", errPersist)
+		} else {
+			c.persist = p
+		}
+	}
 
-				info, errTok := c.fetchToken(ctx)
-				if errTok != nil {
-					return errTok
-				}
+	switch {
+	case options.TokenCache != nil:
+		c.metrics = sharedMetrics(options, cacheName)
+		c.cache = options.TokenCache
+		c.derivedCache = options.TokenCache
+	case options.GroupcacheGroup != nil:
+		c.metrics = sharedMetrics(options, options.GroupcacheGroup.Name())
+		c.cache = &groupcacheTokenCache{group: options.GroupcacheGroup}
+		c.group = options.GroupcacheGroup
+		c.derivedCache = NewMemoryTokenCache()
+	default:
+		shared := joinGroup(options.GroupcacheWorkspace, cacheName, func() *sharedGroup {
+			return &sharedGroup{
+				cache:        newGroupcacheTokenCache(options, cacheName, c.loadKey),
+				derivedCache: NewMemoryTokenCache(),
+				owners:       c.owners,
+				metrics:      sharedMetrics(options, cacheName),
+			}
+		})
+		c.cache = shared.cache
+		c.derivedCache = shared.derivedCache
+		c.group = shared.cache.group
+		c.owners = shared.owners
+		c.metrics = shared.metrics
+		c.namespaced = true
+		c.leave = func() { leaveGroup(options.GroupcacheWorkspace, cacheName) }
+	}
 
-				softExpire := time.Duration(options.SoftExpireInSeconds) * time.Second
+	c.key = c.buildCacheKey()
+	c.owners.Store(c.key, c)
 
-				expire := time.Now().Add(info.expiresIn - softExpire)
+	if options.IntrospectionURL != "" && options.IntrospectionInterval > 0 {
+		c.addTask(options.IntrospectionInterval, c.introspectAll)
+	}
 
-				return dest.SetString(info.accessToken, expire)
-			}),
-		MainCacheWeight: options.GroupcacheMainCacheWeight,
-		HotCacheWeight:  options.GroupcacheHotCacheWeight,
+	if options.ConsistencyCheckInterval > 0 && options.ConsistencyPeers != nil && c.group != nil {
+		c.addTask(options.ConsistencyCheckInterval, func() {
+			c.CheckConsistency(context.Background(), options.ConsistencyPeers)
+		})
 	}
 
-	group := groupcache.NewGroupWithWorkspace(o)
+	if options.SummaryInterval > 0 && c.group == nil {
+		c.warnf("SummaryInterval requires the default groupcache TokenCache, summary disabled")
+	}
 
-	c.group = group
+	if options.SummaryInterval > 0 && c.group != nil {
+		last := c.readCacheCounters()
+		c.addTask(options.SummaryInterval, func() { last = c.logSummary(last) })
+	}
+
+	if options.ExpvarName != "" {
+		c.publishExpvar()
+	}
 
 	return c
 }
 
+// addTask schedules a periodic background task, creating a private
+// runner if Options.Runner is unspecified.
+func (c *Client) addTask(interval time.Duration, run func()) {
+	if c.runner == nil {
+		c.runner = c.options.Runner
+		if c.runner == nil {
+			c.runner = NewRunner()
+			c.ownRunner = true
+		}
+	}
+	c.tasks = append(c.tasks, c.runner.add(interval, run))
+}
+
+// Close stops background tasks. The client must not be used after Close.
+// A shared Options.Runner is not closed. The group created by New is
+// removed from the workspace when its last client is closed.
+func (c *Client) Close() {
+	for _, t := range c.tasks {
+		c.runner.remove(t)
+	}
+	c.tasks = nil
+	if c.ownRunner {
+		c.runner.Close()
+	}
+	if c.leave != nil {
+		c.leave()
+		c.leave = nil
+	}
+}
+
 func (c *Client) errorf(format string, v ...any) {
-	c.options.Logf("ERROR: "+format, v...)
+	c.errorfCtx(context.Background(), format, v...)
+}
+
+func (c *Client) infof(format string, v ...any) {
+	c.infofCtx(context.Background(), format, v...)
+}
+
+func (c *Client) warnf(format string, v ...any) {
+	c.warnfCtx(context.Background(), format, v...)
 }
 
 func (c *Client) debugf(format string, v ...any) {
-	if c.options.Debug {
-		c.options.Logf("DEBUG: "+format, v...)
-	}
+	c.debugfCtx(context.Background(), format, v...)
 }
 
 // Do sends an HTTP request and returns an HTTP response.
 // The actual HTTPClient provided in the Options is used to make the requests
-// and also to retrieve the required client_credentials token.
+// and, unless TokenHTTPClient is provided, also to retrieve the required
+// client_credentials token.
 // Do retrieves the token and renews it as necessary for making the request.
+// The request is sent at most once, unless Options.RetryOnUnauthorized
+// is set, in which case the body is resent with req.GetBody, see
+// ErrBodyNotReplayable. Do does not modify req: the Authorization header
+// is set on a copy, so callers may reuse or retry their requests.
 func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	out, err := c.DoWithOutput(req)
+	return out.Response, err
+}
+
+// Output holds results from DoWithOutput.
+type Output struct {
+	// Response is the HTTP response from the target server.
+	Response *http.Response
+
+	// Headers holds the target response headers listed in Options.OutputHeaders.
+	// Headers missing from the response are absent from the map.
+	Headers http.Header
+
+	// Trace records the token decision path when WithTrace is used.
+	Trace []TraceEvent
+
+	// Scope is the scope granted by the token server, which may be narrower
+	// than the requested scope. Empty if the token response omits scope.
+	Scope string
+
+	// TokenType is the Authorization header scheme used for the request.
+	TokenType string
+
+	// TokenExpire is the token hard expiration time.
+	// Zero if the token response carries no expiry.
+	TokenExpire time.Time
+
+	// TokenIssuedAt is the iat claim of JWT access tokens, for
+	// cross-referencing with token server logs. Zero if unavailable.
+	TokenIssuedAt time.Time
+
+	// TokenID is the jti claim of JWT access tokens.
+	// Empty if unavailable.
+	TokenID string
+
+	// ClientID is the client the token was issued to, e.g. the tenant
+	// of clients derived with WithCredentials. Empty if no token was used.
+	ClientID string
+
+	// TokenObtainedAt is the time the token was fetched from the
+	// token server. Zero for tokens cached by older versions.
+	TokenObtainedAt time.Time
+
+	// TokenFetched reports this request fetched the token from the token
+	// server, rather than finding it in the cache or sharing a fetch by
+	// a concurrent request or a groupcache peer.
+	TokenFetched bool
+
+	// TokenFetchLatency is the time spent fetching the token from the
+	// token server, including retries, whenever it was fetched.
+	// Zero for tokens cached by older versions.
+	TokenFetchLatency time.Duration
+
+	// CacheKey is the cache key of the token, see Options.CacheKeyFunc.
+	CacheKey string
+}
+
+// DoWithOutput is like Do, but returns additional information in Output.
+// Request options customize the call, e.g. WithTrace.
+// Per-request credentials are taken from the request context, see
+// ContextWithCredentials, or from Options.CredentialsProvider.
+func (c *Client) DoWithOutput(req *http.Request, opts ...RequestOption) (Output, error) {
+
+	var ro requestOptions
+	for _, o := range opts {
+		o(&ro)
+	}
+
+	var tr *tracer
+	if ro.trace {
+		tr = &tracer{}
+		req = req.WithContext(withTracer(req.Context(), tr))
+	}
+
+	if ctx := withTraceparent(req.Context(), req); ctx != req.Context() {
+		req = req.WithContext(ctx)
+	}
+
+	client, source, errCreds := c.forRequest(req.Context(), req)
+	if errCreds != nil {
+		return Output{Trace: tr.list()}, errCreds
+	}
+
+	out, err := client.doWithSpan(req, func(req *http.Request) (Output, error) {
+		return client.doWithOutput(req, ro, tr)
+	})
+	if err != nil {
+		client.invalidCredentials(source, err)
+	}
+
+	out.Trace = tr.list()
+
+	return out, err
+}
+
+func (c *Client) doWithOutput(req *http.Request, ro requestOptions, tr *tracer) (Output, error) {
+
+	var out Output
+
+	if req.URL != nil {
+		if errTLS := c.checkTLS("target", req.URL); errTLS != nil {
+			return out, errTLS
+		}
+	}
+
+	if (ro.preserveAuthorization || c.options.PreserveAuthorization) && req.Header.Get(c.options.AuthorizationHeader) != "" &&
+		!c.hasBasicAuthCredentials(req) {
+		tr.add(TracePreservedAuthorization, "")
+		resp, errResp := c.do(req)
+		out.Response = resp
+		if errResp == nil {
+			out.Headers = c.outputHeaders(resp)
+		}
+		return out, errResp
+	}
 
 	ctx := req.Context()
 
-	accessToken, errToken := c.getToken(ctx)
+	key := c.cacheKey()
+
+	if c.forceRefresh(ctx, req) {
+		tr.add(TraceForceRefresh, "")
+		c.evict(ctx, key)
+	}
+
+	tok, errToken := c.getToken(ctx, key)
 	if errToken != nil {
-		return nil, errToken
+		return out, errToken
 	}
 
-	resp, errResp := c.send(req, accessToken)
+	out.setToken(c.options.ClientID, key, tok)
+
+	resp, errResp := c.send(req, tok)
+	out.Response = resp
 	if errResp != nil {
-		return resp, errResp
+		return out, errResp
 	}
 
-	if resp.StatusCode == 401 {
+	out.Headers = c.outputHeaders(resp)
+
+	if c.isBadToken(resp) {
 		//
 		// the server refused our token, so we expire it in order to
 		// renew it at the next invokation.
 		//
-		if errRemove := c.group.Remove(ctx, c.options.ClientID); errRemove != nil {
-			c.errorf("cache remove error: %v", errRemove)
+		tr.add(TraceTokenRejected, fmt.Sprintf("status=%d", resp.StatusCode))
+		c.securityEvent(SecurityTokenRejected, resp.StatusCode,
+			"target server rejected token: %s %s", req.Method, req.URL.Host)
+		c.metrics.observeRejected(c.options.ClientID)
+		evicted := true
+		if c.options.IntrospectionURL != "" {
+			evicted = c.introspectAndEvict(ctx, key, tok.accessToken, true)
+		} else {
+			c.evict(ctx, key)
+		}
+		if evicted && c.options.RetryOnUnauthorized {
+			return c.retry(req, out, tr)
+		}
+	}
+
+	return out, errResp
+}
+
+// ErrBodyNotReplayable reports a request rejected with Options.RetryOnUnauthorized
+// that could not be sent again, since its body cannot be rewound:
+// it has a body but no GetBody.
+var ErrBodyNotReplayable = errors.New("request body not replayable")
+
+// retry sends the request again with a fresh token, after the previous
+// token was rejected and evicted, thus the request was not processed.
+// Each attempt is sent with its own clone of req, see send.
+func (c *Client) retry(req *http.Request, prev Output, tr *tracer) (Output, error) {
+	ctx := req.Context()
+
+	var body io.ReadCloser
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			drainBody(prev.Response)
+			return Output{}, ErrBodyNotReplayable
+		}
+		b, errBody := req.GetBody()
+		if errBody != nil {
+			drainBody(prev.Response)
+			return Output{}, fmt.Errorf("retry: rewind request body: %w", errBody)
+		}
+		body = b
+	}
+
+	// the first response is discarded
+	drainBody(prev.Response)
+
+	tr.add(TraceRequestRetry, "")
+
+	retryReq := req.Clone(ctx)
+	if body != nil {
+		retryReq.Body = body
+	}
+
+	key := c.cacheKey()
+
+	out := Output{}
+
+	tok, errToken := c.getToken(ctx, key)
+	if errToken != nil {
+		return out, errToken
+	}
+
+	out.setToken(c.options.ClientID, key, tok)
+
+	resp, errResp := c.send(retryReq, tok)
+	out.Response = resp
+	if errResp != nil {
+		return out, errResp
+	}
+
+	out.Headers = c.outputHeaders(resp)
+
+	if c.isBadToken(resp) {
+		// no further retries, but the fresh token is evicted as well.
+		tr.add(TraceTokenRejected, fmt.Sprintf("status=%d", resp.StatusCode))
+		c.securityEvent(SecurityTokenRejected, resp.StatusCode,
+			"target server rejected fresh token: %s %s", req.Method, req.URL.Host)
+		c.metrics.observeRejected(c.options.ClientID)
+		if c.options.IntrospectionURL != "" {
+			c.introspectAndEvict(ctx, key, tok.accessToken, true)
+		} else {
+			c.evict(ctx, key)
+		}
+	}
+
+	return out, nil
+}
+
+// drainBody discards the response.
+func drainBody(resp *http.Response) {
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+// setToken records token metadata.
+func (out *Output) setToken(clientID, key string, tok storedToken) {
+	out.ClientID = clientID
+	out.CacheKey = key
+	out.TokenFetched = tok.fetched
+	out.TokenFetchLatency = tok.fetchLatency
+	out.Scope = tok.scope
+	out.TokenType = tok.tokenType
+	out.TokenExpire = tok.hardExpire
+	out.TokenIssuedAt = tok.issuedAt
+	out.TokenObtainedAt = tok.obtainedAt
+	out.TokenID = tok.tokenID
+}
+
+// outputHeaders copies response headers listed in Options.OutputHeaders.
+func (c *Client) outputHeaders(resp *http.Response) http.Header {
+	if len(c.options.OutputHeaders) == 0 {
+		return nil
+	}
+	h := http.Header{}
+	for _, name := range c.options.OutputHeaders {
+		if values := resp.Header.Values(name); len(values) > 0 {
+			h[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
 		}
 	}
+	return h
+}
 
-	return resp, errResp
+// send sends the request with the token, on a shallow copy of req
+// with cloned headers, leaving the caller's request untouched.
+func (c *Client) send(req *http.Request, tok storedToken) (*http.Response, error) {
+	r := new(http.Request)
+	*r = *req
+	r.Header = req.Header.Clone()
+	if r.Header == nil {
+		r.Header = http.Header{}
+	}
+	if c.options.ScopeHeader != "" {
+		r.Header.Del(c.options.ScopeHeader)
+	}
+	if c.hasBasicAuthCredentials(req) {
+		r.Header.Del("Authorization")
+	}
+	if c.options.TokenURLHeader != "" {
+		r.Header.Del(c.options.TokenURLHeader)
+	}
+	if c.options.ForceRefreshHeader != "" {
+		r.Header.Del(c.options.ForceRefreshHeader)
+	}
+	if c.options.InjectToken != nil {
+		if req.URL != nil {
+			u := *req.URL
+			r.URL = &u
+		}
+		c.options.InjectToken(r, tok.accessToken)
+	} else {
+		c.setAuthorization(r.Header, tok)
+	}
+	return c.do(r)
 }
 
-func (c *Client) send(req *http.Request, accessToken string) (*http.Response, error) {
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
-	return c.options.HTTPClient.Do(req)
+// AuthorizationSchemeNone sends the raw token as authorization header value,
+// see Options.AuthorizationScheme.
+const AuthorizationSchemeNone = "none"
+
+// setAuthorization sets the authorization header for the token.
+func (c *Client) setAuthorization(h http.Header, tok storedToken) {
+	switch c.options.AuthorizationScheme {
+	case "":
+		// precomputed value for the token type, in a slice owned by
+		// the request, since callers may modify the header
+		h[c.options.AuthorizationHeader] = []string{tok.authorization}
+	case AuthorizationSchemeNone:
+		h[c.options.AuthorizationHeader] = []string{tok.accessToken}
+	default:
+		h[c.options.AuthorizationHeader] = []string{c.options.AuthorizationScheme + " " + tok.accessToken}
+	}
+}
+
+// do sends the request to the target server.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	c.metrics.requestsInFlight.Inc()
+	begin := time.Now()
+	defer func() {
+		c.metrics.requestSeconds.Observe(time.Since(begin).Seconds())
+		c.metrics.requestsInFlight.Dec()
+	}()
+
+	return c.doer.Do(req)
 }
 
-func (c *Client) getToken(ctx context.Context) (string, error) {
-	var accessToken string
-	errGet := c.group.Get(ctx, c.options.ClientID, groupcache.StringSink(&accessToken))
-	return accessToken, errGet
+// authToken is the token used in the Authorization header,
+// with metadata from the token response.
+type authToken struct {
+	tokenType   string
+	accessToken string
+	scope       string
+
+	// issuedAt and tokenID are the iat and jti claims of JWT access tokens.
+	issuedAt time.Time
+	tokenID  string
+
+	// obtainedAt is the token fetch time.
+	obtainedAt time.Time
+
+	// fetchLatency is the time spent fetching the token.
+	fetchLatency time.Duration
+
+	// authorization is the precomputed Authorization header value.
+	authorization string
+}
+
+// cachedTokenVersion is the cachedToken format version. Fields may be
+// added without changing the version; incompatible changes bump it.
+// Older releases cached the bare access token, decoded as a Bearer
+// token, see decodeToken.
+const cachedTokenVersion = 1
+
+// cachedToken is the cached value.
+type cachedToken struct {
+	Version     int    `json:"v,omitempty"`
+	TokenType   string `json:"t"`
+	AccessToken string `json:"a"`
+	Scope       string `json:"s,omitempty"`
+	Expire      int64  `json:"e,omitempty"` // hard expiration, unix milliseconds
+	RefreshAt   int64  `json:"r,omitempty"` // refresh-ahead time, unix milliseconds
+	ObtainedAt  int64  `json:"o,omitempty"` // fetch time, unix milliseconds
+	Latency     int64  `json:"l,omitempty"` // fetch latency, microseconds
+}
+
+func encodeToken(t storedToken) (string, error) {
+	ct := cachedToken{
+		Version:     cachedTokenVersion,
+		TokenType:   t.tokenType,
+		AccessToken: t.accessToken,
+		Scope:       t.scope,
+	}
+	if !t.obtainedAt.IsZero() {
+		ct.ObtainedAt = t.obtainedAt.UnixMilli()
+	}
+	ct.Latency = t.fetchLatency.Microseconds()
+	if !t.hardExpire.IsZero() {
+		ct.Expire = t.hardExpire.UnixMilli()
+	}
+	if !t.refreshAt.IsZero() {
+		ct.RefreshAt = t.refreshAt.UnixMilli()
+	}
+	buf, errJSON := json.Marshal(ct)
+	return string(buf), errJSON
+}
+
+func decodeToken(buf []byte) (storedToken, error) {
+	var ct cachedToken
+	if len(buf) > 0 && buf[0] != '{' {
+		// bare access token cached by older releases
+		ct = cachedToken{TokenType: "Bearer", AccessToken: string(buf)}
+	} else if errJSON := json.Unmarshal(buf, &ct); errJSON != nil {
+		return storedToken{}, fmt.Errorf("decode cached token: %v", errJSON)
+	}
+	if ct.Version > cachedTokenVersion {
+		return storedToken{}, fmt.Errorf("decode cached token: unsupported version: %d", ct.Version)
+	}
+	t := storedToken{
+		authToken: authToken{
+			tokenType:     ct.TokenType,
+			accessToken:   ct.AccessToken,
+			scope:         ct.Scope,
+			authorization: ct.TokenType + " " + ct.AccessToken,
+		},
+	}
+	if claims, errClaims := parseJWTClaims(ct.AccessToken); errClaims == nil {
+		if claims.Iat != nil {
+			t.issuedAt = time.Unix(int64(*claims.Iat), 0)
+		}
+		t.tokenID = claims.Jti
+	}
+	if ct.Expire != 0 {
+		t.hardExpire = time.UnixMilli(ct.Expire)
+	}
+	if ct.RefreshAt != 0 {
+		t.refreshAt = time.UnixMilli(ct.RefreshAt)
+	}
+	if ct.ObtainedAt != 0 {
+		t.obtainedAt = time.UnixMilli(ct.ObtainedAt)
+	}
+	t.fetchLatency = time.Duration(ct.Latency) * time.Microsecond
+	return t, nil
+}
+
+// decodedToken memoizes the last decoded cache value for a key.
+type decodedToken struct {
+	raw string
+	tok storedToken
+}
+
+// decodeValue decodes the cached value, reusing the previous result
+// while the cached value is unchanged, which is the common case.
+func (c *Client) decodeValue(key, value string, cacheExpire time.Time) (storedToken, error) {
+	if v, found := c.decoded.Load(key); found {
+		if d := v.(*decodedToken); value == d.raw {
+			tok := d.tok
+			tok.cacheExpire = cacheExpire
+			return tok, nil
+		}
+	}
+
+	plain, errOpen := c.openValue(key, value)
+	if errOpen != nil {
+		return storedToken{}, errOpen
+	}
+
+	tok, errDecode := decodeToken([]byte(plain))
+	if errDecode != nil {
+		return storedToken{}, errDecode
+	}
+	c.decoded.Store(key, &decodedToken{raw: value, tok: tok})
+
+	tok.cacheExpire = cacheExpire
+	return tok, nil
+}
+
+func (c *Client) getToken(ctx context.Context, key string) (storedToken, error) {
+	if c.rejected != nil {
+		return storedToken{}, c.rejected
+	}
+
+	tr := tracerFrom(ctx)
+	if tr != nil {
+		tr.add(TraceCacheGet, "key="+key)
+	}
+
+	if c.options.DisableCache {
+		waitCtx, cancel := c.withTokenWaitTimeout(ctx)
+		defer cancel()
+		tok, errFetch := c.fetchUncached(waitCtx)
+		if errFetch != nil {
+			c.metrics.observeLookup(c.options.ClientID, "error")
+		} else {
+			c.metrics.observeLookup(c.options.ClientID, "miss")
+		}
+		return tok, errFetch
+	}
+
+	if tok, found := c.getLocal(key); found {
+		if tr != nil {
+			tr.add(TraceLocalCacheHit, fmt.Sprintf("expire=%v", tok.cacheExpire))
+		}
+		c.checkRefreshAhead(tr, key, tok)
+		c.metrics.observeLookup(c.options.ClientID, "hit")
+		return tok, nil
+	}
+
+	if tok, found := c.getStaleWhileRevalidate(key); found {
+		tr.add(TraceStaleWhileRevalidate, fmt.Sprintf("cache_expire=%v", tok.cacheExpire))
+		c.metrics.observeLookup(c.options.ClientID, "hit")
+		return tok, nil
+	}
+
+	c.metrics.tokenWaiting.Inc()
+	begin := time.Now()
+	mark := &fetchMark{}
+	waitCtx, cancel := c.withTokenWaitTimeout(ctx)
+	value, cacheExpire, errGet := c.cache.Get(withFetchMark(waitCtx, mark), key, c.loadValue)
+	cancel()
+	c.metrics.tokenWaitSeconds.Observe(time.Since(begin).Seconds())
+	c.metrics.tokenWaiting.Dec()
+
+	if errGet != nil {
+		tr.add(TraceTokenFetchError, errGet.Error())
+		c.metrics.observeLookup(c.options.ClientID, "error")
+		if tok, found := c.getStale(ctx, key, errGet); found {
+			tr.add(TraceStaleToken, "")
+			return tok, nil
+		}
+		return storedToken{}, newTokenError(errGet)
+	}
+
+	if tr != nil && !tr.has(TraceTokenFetch) {
+		tr.add(TraceCacheHit, fmt.Sprintf("expire=%v", cacheExpire))
+	}
+
+	tok, errDecode := c.decodeValue(key, value, cacheExpire)
+	if errDecode != nil {
+		c.metrics.observeLookup(c.options.ClientID, "error")
+		return storedToken{}, errDecode
+	}
+
+	c.rememberToken(key, tok)
+	c.putLocal(key, tok)
+
+	c.checkRefreshAhead(tr, key, tok)
+
+	tok.fetched = mark.fetched
+
+	if tok.fetched {
+		c.metrics.observeLookup(c.options.ClientID, "miss")
+	} else {
+		c.metrics.observeLookup(c.options.ClientID, "hit")
+	}
+
+	return tok, nil
+}
+
+// setClientBasicAuth sets the Basic authorization header with the client
+// credentials, form-encoded as required by RFC 6749 section 2.3.1, unless
+// Options.ClientAuthBasicNoEncoding.
+func (c *Client) setClientBasicAuth(req *http.Request, clientSecret string) {
+	clientID := c.options.ClientID
+	if !c.options.ClientAuthBasicNoEncoding {
+		clientID = url.QueryEscape(clientID)
+		clientSecret = url.QueryEscape(clientSecret)
+	}
+	req.SetBasicAuth(clientID, clientSecret)
+}
+
+// withTokenWaitTimeout applies Options.TokenWaitTimeout to token acquisition.
+func (c *Client) withTokenWaitTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.options.TokenWaitTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.options.TokenWaitTimeout)
+}
+
+// fetchUncached fetches a fresh token bypassing the cache,
+// with Options.DisableCache.
+func (c *Client) fetchUncached(ctx context.Context) (storedToken, error) {
+	value, cacheExpire, errFetch := c.fetchValue(ctx)
+	if errFetch != nil {
+		tracerFrom(ctx).add(TraceTokenFetchError, errFetch.Error())
+		return storedToken{}, newTokenError(errFetch)
+	}
+
+	plain, errOpen := c.openValue(c.cacheKey(), value)
+	if errOpen != nil {
+		return storedToken{}, errOpen
+	}
+
+	tok, errDecode := decodeToken([]byte(plain))
+	if errDecode != nil {
+		return storedToken{}, errDecode
+	}
+
+	tok.cacheExpire = cacheExpire
+	tok.fetched = true
+	return tok, nil
+}
+
+// checkRefreshAhead starts background renewal if the token is due.
+func (c *Client) checkRefreshAhead(tr *tracer, key string, tok storedToken) {
+	if !tok.refreshAt.IsZero() && time.Now().After(tok.refreshAt) {
+		tr.add(TraceRefreshAhead, fmt.Sprintf("refresh_at=%v", tok.refreshAt))
+		c.refreshAhead(key)
+	}
+}
+
+// getLocal returns the token from the in-process cache, if enabled
+// and not expired.
+func (c *Client) getLocal(key string) (storedToken, bool) {
+	if !c.options.LocalCache {
+		return storedToken{}, false
+	}
+	v, found := c.local.Load(key)
+	if !found {
+		return storedToken{}, false
+	}
+	tok := v.(*storedToken)
+	if !tok.cacheExpire.IsZero() && !time.Now().Before(tok.cacheExpire) {
+		return storedToken{}, false
+	}
+	return *tok, true
+}
+
+func (c *Client) putLocal(key string, tok storedToken) {
+	if !c.options.LocalCache {
+		return
+	}
+	local := tok // copy only when enabled, since it escapes
+	c.local.Store(key, &local)
+}
+
+// cacheKey returns the cache key.
+func (c *Client) cacheKey() string {
+	return c.key
+}
+
+// buildCacheKey builds the cache key. The key is the plain clientID
+// unless audience or resources are defined, in order to keep tokens
+// for different audiences apart. Clients derived with WithScope also
+// add the scope, clients derived with WithTokenURL add TokenURL,
+// and clients using the group created by New add TokenURL and scope,
+// so keys do not depend on which clients share the group.
+// Options.CacheKeyFunc overrides it.
+// Clients derived with WithCredentials add a digest of the client secret,
+// even with CacheKeyFunc. Options.CacheKeyHMACKey hashes the result.
+func (c *Client) buildCacheKey() string {
+	key := c.identityKey()
+	if c.secretInKey {
+		key += "|secret=" + c.secretDigest()
+	}
+	return c.hashCacheKey(key)
+}
+
+// identityKey is the cache key without the client secret digest.
+func (c *Client) identityKey() string {
+	if c.options.CacheKeyFunc != nil {
+		return c.options.CacheKeyFunc(c.options.ClientID, c.options.Scope,
+			c.options.TokenURL, c.options.Audience)
+	}
+	return c.defaultCacheKey()
+}
+
+// hashCacheKey applies Options.CacheKeyHMACKey.
+func (c *Client) hashCacheKey(key string) string {
+	if len(c.options.CacheKeyHMACKey) == 0 {
+		return key
+	}
+	mac := hmac.New(sha256.New, c.options.CacheKeyHMACKey)
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (c *Client) defaultCacheKey() string {
+	key := c.options.ClientID
+	if c.options.Audience != "" {
+		key += "|audience=" + c.options.Audience
+	}
+	if len(c.options.Resources) > 0 {
+		key += "|resource=" + strings.Join(c.options.Resources, " ")
+	}
+	if c.tokenURLInKey || c.namespaced {
+		key += "|token_url=" + c.options.TokenURL
+	}
+	if c.scopeInKey || c.namespaced {
+		key += "|scope=" + c.options.Scope
+	}
+	return key
+}
+
+// fetchValue retrieves a token and builds the cached value and its
+// cache expiration.
+func (c *Client) fetchValue(ctx context.Context) (string, time.Time, error) {
+	begin := time.Now()
+	info, resp, errTok := c.fetchToken(ctx)
+	if errTok != nil {
+		return "", time.Time{}, errTok
+	}
+
+	tracerFrom(ctx).add(TraceTokenFetch,
+		fmt.Sprintf("expires_in=%v", info.ExpiresIn))
+	markFetched(ctx)
+
+	c.securityEvent(SecurityTokenIssued, 0, "token issued: expires_in=%v scope=%q",
+		info.ExpiresIn, info.Scope)
+
+	c.evictRotated()
+
+	if info.ExpiresIn < 0 || (info.ExpiresIn > 0 && info.ExpiresIn < c.options.MinTokenLifetime) {
+		return "", time.Time{}, &ShortLifetimeError{
+			ExpiresIn:        info.ExpiresIn,
+			MinTokenLifetime: c.options.MinTokenLifetime,
+		}
+	}
+
+	if maxLifetime := c.options.MaxTokenLifetime; maxLifetime > 0 && (info.ExpiresIn == 0 || info.ExpiresIn > maxLifetime) {
+		info.ExpiresIn = maxLifetime
+	}
+
+	now := time.Now()
+
+	expire := c.refreshAt(now, info)
+
+	if c.options.TokenTTLFunc != nil {
+		if ttl := c.options.TokenTTLFunc(c.options.ClientID, resp); ttl > 0 {
+			expire = now.Add(ttl)
+			if info.ExpiresIn > 0 && ttl > info.ExpiresIn {
+				expire = now.Add(info.ExpiresIn) // never cache expired tokens
+			}
+		}
+	}
+
+	if info.ExpiresIn > 0 && !expire.After(now) {
+		// lifetime shorter than soft expire: cache for half the lifetime
+		// instead of caching an already expired token.
+		expire = now.Add(info.ExpiresIn / 2)
+		c.warnfCtx(ctx, "token lifetime %v shorter than soft expire, caching for %v",
+			info.ExpiresIn, info.ExpiresIn/2)
+		c.fallback(FallbackShortLifetime, c.cacheKey(), nil)
+	}
+
+	tokenType := info.TokenType
+	if tokenType == "" {
+		tokenType = c.options.DefaultTokenType
+	}
+
+	var hardExpire time.Time
+	if info.ExpiresIn > 0 {
+		hardExpire = now.Add(info.ExpiresIn)
+	}
+
+	t := storedToken{
+		authToken: authToken{
+			tokenType:    tokenType,
+			accessToken:  info.AccessToken,
+			scope:        info.Scope,
+			obtainedAt:   now,
+			fetchLatency: now.Sub(begin),
+		},
+		hardExpire: hardExpire,
+	}
+
+	if c.options.RefreshAhead && !hardExpire.IsZero() {
+		// keep the token cached until hard expiration,
+		// getToken renews it in background after refreshAt.
+		t.refreshAt = expire
+		expire = hardExpire
+	}
+
+	expire = c.limitCacheTTL(now, info, expire)
+
+	plain, errEncode := encodeToken(t)
+	if errEncode != nil {
+		return "", time.Time{}, errEncode
+	}
+
+	value, errSeal := c.sealValue(c.cacheKey(), plain)
+	if errSeal != nil {
+		return "", time.Time{}, errSeal
+	}
+
+	return value, expire, nil
 }
 
 // fetchToken actually retrieves token from token server.
-func (c *Client) fetchToken(ctx context.Context) (tokenInfo, error) {
+// The TokenResponse is returned only when required by Options hooks.
+func (c *Client) fetchToken(ctx context.Context) (TokenInfo, TokenResponse, error) {
+	begin := time.Now()
+	ti, tr, errTok := c.fetchTokenRetry(ctx)
+	c.metrics.observeFetch(c.options.ClientID, time.Since(begin), errTok)
+	return ti, tr, errTok
+}
 
-	const me = "fetchToken"
+// fetchTokenRetry retries token requests, see Options.TokenRetries.
+func (c *Client) fetchTokenRetry(ctx context.Context) (TokenInfo, TokenResponse, error) {
+	c.metrics.tokenFetchQueued.Inc()
+	release, errSlot := c.limiter.acquire(ctx, c.options.ClientID)
+	c.metrics.tokenFetchQueued.Dec()
+	if errSlot != nil {
+		return TokenInfo{}, TokenResponse{}, errSlot
+	}
+	defer release()
+
+	for attempt := 0; ; attempt++ {
+		ti, tr, errTok := c.requestToken(ctx)
+		if errTok == nil || attempt >= c.options.TokenRetries || !isTransient(ctx, errTok) {
+			return ti, tr, errTok
+		}
+
+		delay := c.retryDelay(attempt, errTok)
+
+		c.warnfCtx(ctx, "fetchToken: attempt %d/%d failed, retrying in %v: %v",
+			attempt+1, c.options.TokenRetries+1, delay, errTok)
+		c.metrics.tokenFetchRetries.Inc()
+
+		if errSleep := backoff.Sleep(ctx, delay); errSleep != nil {
+			return ti, tr, errTok
+		}
+	}
+}
+
+// sendTokenRequest performs a single token request to tokenURL.
+func (c *Client) sendTokenRequest(ctx context.Context, tokenURL, clientSecret string) (TokenInfo, TokenResponse, error) {
+
+	const me = "sendTokenRequest"
+
+	if errRate := c.rate.allow(c.options.ClientID, time.Now()); errRate != nil {
+		c.warnfCtx(ctx, "%s: %v", me, errRate)
+		return TokenInfo{}, TokenResponse{}, errRate
+	}
+
+	c.metrics.tokenFetchInFlight.Inc()
+	defer c.metrics.tokenFetchInFlight.Dec()
 
 	begin := time.Now()
 
 	form := url.Values{}
-	form.Add("grant_type", "client_credentials")
-	form.Add("client_id", c.options.ClientID)
-	form.Add("client_secret", c.options.ClientSecret)
-	if c.options.Scope != "" {
+	form.Add("grant_type", c.options.GrantType)
+	if c.hasAssertion() {
+		assertion, errAssertion := c.assertion()
+		if errAssertion != nil {
+			return TokenInfo{}, TokenResponse{}, fmt.Errorf("assertion: %v", errAssertion)
+		}
+		form.Add("assertion", assertion)
+	} else if !c.options.ClientAuthBasic {
+		form.Add("client_id", c.options.ClientID)
+		form.Add("client_secret", clientSecret)
+	}
+	if c.options.Scope != "" && c.options.ScopedAssertion == nil {
 		form.Add("scope", c.options.Scope)
 	}
+	if c.options.Audience != "" {
+		form.Add("audience", c.options.Audience)
+	}
+	for _, r := range c.options.Resources {
+		form.Add("resource", r)
+	}
+	for k, v := range c.options.EndpointParams {
+		form[k] = append([]string(nil), v...)
+	}
+
+	var ti TokenInfo
+	var tr TokenResponse
 
-	var ti tokenInfo
+	if c.options.TokenRequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.options.TokenRequestTimeout)
+		defer cancel()
+	}
 
-	req, errReq := http.NewRequestWithContext(ctx, "POST", c.options.TokenURL,
+	req, errReq := http.NewRequestWithContext(ctx, "POST", tokenURL,
 		strings.NewReader(form.Encode()))
 	if errReq != nil {
-		return ti, errReq
+		return ti, tr, errReq
 	}
 
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	if c.options.ClientAuthBasic && !c.hasAssertion() {
+		c.setClientBasicAuth(req, clientSecret)
+	}
+
+	c.dumpTokenRequest(ctx, req)
 
-	resp, errDo := c.options.HTTPClient.Do(req)
+	resp, errDo := c.options.TokenHTTPClient.Do(req)
 	if errDo != nil {
-		return ti, errDo
+		return ti, tr, errDo
 	}
 	defer resp.Body.Close()
 
+	c.spanStatus(ctx, resp.StatusCode)
+
 	body, errBody := io.ReadAll(resp.Body)
 	if errBody != nil {
-		return ti, errBody
+		return ti, tr, errBody
 	}
 
+	c.dumpTokenResponse(ctx, resp, body)
+
 	elap := time.Since(begin)
 
-	c.debugf("%s: elapsed:%v token: %s", me, elap, string(body))
+	if c.options.Debug {
+		c.debugfCtx(ctx, "%s: elapsed:%v token: %s", me, elap, c.debugTokenBody(resp.StatusCode, body))
+	}
+	c.logEvent(ctx, slog.LevelDebug, "token_fetch", "token response",
+		slog.Int("status", resp.StatusCode), slog.Duration("latency", elap))
+
+	tr = c.notifyTokenResponse(resp, body, elap)
 
 	if resp.StatusCode < c.options.HTTPStatusOkMin || resp.StatusCode > c.options.HTTPStatusOkMax {
-		return ti, fmt.Errorf("bad token server response http status: status:%d body:%v", resp.StatusCode, string(body))
+		if isCredentialInvalid(resp.StatusCode) {
+			c.securityEvent(SecurityCredentialInvalid, resp.StatusCode,
+				"token server refused client credentials")
+		}
+		return ti, tr, &StatusError{
+			StatusCode: resp.StatusCode,
+			Body:       string(body),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+			OAuth:      parseOAuthError(body),
+		}
 	}
 
 	{
 		var errParse error
-		ti, errParse = parseToken(body, c.debugf)
+		if c.options.ParseTokenResponse != nil {
+			ti, errParse = c.options.ParseTokenResponse(body)
+			switch {
+			case errParse != nil:
+			case ti.AccessToken == "":
+				errParse = fmt.Errorf("empty access token")
+			case strings.ContainsAny(ti.TokenType, " \t"):
+				errParse = fmt.Errorf("invalid token type: '%s'", ti.TokenType)
+			}
+		} else {
+			ti, errParse = parseToken(body, c.debugf)
+		}
 		if errParse != nil {
-			return ti, fmt.Errorf("parse token: %v", errParse)
+			return ti, tr, fmt.Errorf("parse token: %v", errParse)
 		}
 	}
 
-	return ti, nil
+	if ti.ExpiresIn == 0 && c.options.ExpireFromJWT {
+		exp, errExp := jwtExpire(ti.AccessToken)
+		if errExp != nil {
+			c.debugfCtx(ctx, "%s: no expiry in token response, jwt exp: %v", me, errExp)
+		} else {
+			ti.ExpiresIn = time.Until(exp)
+			if ti.ExpiresIn <= 0 {
+				// never mistake an expired token for one without expiry
+				return ti, tr, fmt.Errorf("parse token: jwt exp %v in the past", exp)
+			}
+		}
+	}
+
+	if ti.ExpiresIn == 0 {
+		c.warnfCtx(ctx, "%s: token response carries no expiry", me)
+	}
+
+	return ti, tr, nil
 }
 
-type tokenInfo struct {
-	accessToken string
-	expiresIn   time.Duration
+// hasAssertion reports whether the jwt-bearer assertion replaces
+// the client credentials.
+func (c *Client) hasAssertion() bool {
+	return c.options.Assertion != nil || c.options.ScopedAssertion != nil
 }
 
-func parseToken(buf []byte, debugf func(format string, v ...any)) (tokenInfo, error) {
-	var info tokenInfo
+// assertion returns the jwt-bearer assertion, see Options.ScopedAssertion.
+func (c *Client) assertion() (string, error) {
+	if c.options.ScopedAssertion != nil {
+		return c.options.ScopedAssertion(c.options.Scope)
+	}
+	return c.options.Assertion()
+}
+
+// StatusError reports a token server response with bad HTTP status.
+type StatusError struct {
+	StatusCode int
+	Body       string
+
+	// RetryAfter is the delay requested by the Retry-After header.
+	// Zero if absent.
+	RetryAfter time.Duration
+
+	// OAuth is the RFC 6749 error parsed from Body, nil if absent.
+	// Also available with errors.As and errors.Is, see OAuthError.
+	OAuth *OAuthError
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("bad token server response http status: status:%d body:%v", e.StatusCode, e.Body)
+}
+
+func (e *StatusError) Unwrap() error {
+	if e.OAuth == nil {
+		return nil
+	}
+	return e.OAuth
+}
+
+// TokenInfo holds the fields extracted from a token response.
+type TokenInfo struct {
+	// AccessToken is required.
+	AccessToken string
+
+	// TokenType is the Authorization header scheme.
+	// If empty, Options.DefaultTokenType is used.
+	TokenType string
+
+	// ExpiresIn is the token lifetime.
+	ExpiresIn time.Duration
+
+	// Scope is the granted scope, if reported by the token server.
+	Scope string
+}
+
+func parseToken(buf []byte, debugf func(format string, v ...any)) (TokenInfo, error) {
+	var info TokenInfo
 
 	var data map[string]interface{}
 
@@ -305,24 +1972,52 @@ func parseToken(buf []byte, debugf func(format string, v ...any)) (tokenInfo, er
 		return info, fmt.Errorf("empty access_token in token response")
 	}
 
-	info.accessToken = tokenStr
+	info.AccessToken = tokenStr
+
+	if tokenType, isStr := data["token_type"].(string); isStr && tokenType != "" {
+		if strings.ContainsAny(tokenType, " \t") {
+			return info, fmt.Errorf("invalid token_type in token response: '%s'", tokenType)
+		}
+		if strings.EqualFold(tokenType, "bearer") {
+			tokenType = "Bearer" // canonical case, some servers send lowercase
+		}
+		info.TokenType = tokenType
+	}
+
+	if scope, isStr := data["scope"].(string); isStr {
+		info.Scope = scope
+	}
 
 	expire, foundExpire := data["expires_in"]
 	if foundExpire {
 		switch expireVal := expire.(type) {
 		case float64:
 			debugf("found expires_in field with %f seconds", expireVal)
-			info.expiresIn = time.Second * time.Duration(expireVal)
+			info.ExpiresIn = time.Second * time.Duration(expireVal)
 		case string:
 			debugf("found expires_in field with %s seconds", expireVal)
 			exp, errConv := strconv.Atoi(expireVal)
 			if errConv != nil {
 				return info, fmt.Errorf("error converting expires_in field from string='%s' to int: %v", expireVal, errConv)
 			}
-			info.expiresIn = time.Second * time.Duration(exp)
+			info.ExpiresIn = time.Second * time.Duration(exp)
 		default:
 			return info, fmt.Errorf("unexpected type %T for expires_in field in token response", expire)
 		}
+		return info, nil
+	}
+
+	expiresOn, foundExpiresOn := data["expires_on"]
+	if foundExpiresOn {
+		on, errOn := parseExpiresOn(expiresOn)
+		if errOn != nil {
+			return info, errOn
+		}
+		debugf("found expires_on field with %v", on)
+		info.ExpiresIn = time.Until(on)
+		if info.ExpiresIn <= 0 {
+			return info, fmt.Errorf("expires_on field %v in the past", on)
+		}
 	}
 
 	return info, nil
@@ -330,6 +2025,7 @@ func parseToken(buf []byte, debugf func(format string, v ...any)) (tokenInfo, er
 
 /*
 MetricsExporter creates a metrics exporter for Prometheus.
+It returns nil when Options.TokenCache is defined.
 
 Usage example
 
@@ -346,6 +2042,9 @@ Usage example
 	}()
 */
 func (c *Client) MetricsExporter() *modernprogram.Group {
+	if c.group == nil {
+		return nil
+	}
 	exporter := modernprogram.New(c.group)
 	return exporter
 }
@@ -2,12 +2,16 @@ package clientcredentials
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -63,13 +67,13 @@ func TestParseToken(t *testing.T) {
 
 		var errored bool
 
-		if info.accessToken != data.expectAcessToken {
-			t.Errorf("%s: expectedAccessToken=%s gotAccessToken=%s", data.name, data.expectAcessToken, info.accessToken)
+		if info.AccessToken != data.expectAcessToken {
+			t.Errorf("%s: expectedAccessToken=%s gotAccessToken=%s", data.name, data.expectAcessToken, info.AccessToken)
 			errored = true
 		}
 
-		if info.expiresIn != data.expectExpire {
-			t.Errorf("%s: expectedExpire=%v gotExpire=%v", data.name, data.expectExpire, info.expiresIn)
+		if info.ExpiresIn != data.expectExpire {
+			t.Errorf("%s: expectedExpire=%v gotExpire=%v", data.name, data.expectExpire, info.ExpiresIn)
 			errored = true
 		}
 
@@ -602,3 +606,1150 @@ func newClient(tokenURL, clientID, clientSecret string, softExpire int) *Client
 
 	return client
 }
+
+// newPeers creates n groupcache workspaces peered over HTTP,
+// for multi-peer tests.
+func newPeers(t *testing.T, n int) []*groupcache.Workspace {
+	var workspaces []*groupcache.Workspace
+	var pools []*groupcache.HTTPPool
+	var urls []string
+	for i := 0; i < n; i++ {
+		ws := groupcache.NewWorkspace()
+		var pool *groupcache.HTTPPool
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pool.ServeHTTP(w, r)
+		}))
+		t.Cleanup(srv.Close)
+		pool = groupcache.NewHTTPPoolOptsWithWorkspace(ws, srv.URL, &groupcache.HTTPPoolOptions{})
+		workspaces = append(workspaces, ws)
+		pools = append(pools, pool)
+		urls = append(urls, srv.URL)
+	}
+	for _, p := range pools {
+		p.Set(urls...)
+	}
+	return workspaces
+}
+
+func TestTokenRequestParams(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+
+	var gotAudience string
+	var gotResources []string
+	var gotTenant string
+	var gotGrantType string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		gotAudience = formParam(r, "audience")
+		gotResources = r.Form["resource"]
+		gotTenant = formParam(r, "tenant")
+		gotGrantType = formParam(r, "grant_type")
+		httpJSON(w, `{"access_token":"abc","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	serverStat := serverStat{}
+	srv := newServer(&serverStat, func(t string) bool { return t == "abc" })
+	defer srv.Close()
+
+	options := Options{
+		TokenURL:            ts.URL,
+		ClientID:            clientID,
+		ClientSecret:        clientSecret,
+		Audience:            "aud1",
+		Resources:           []string{"https://api1", "https://api2"},
+		EndpointParams:      url.Values{"tenant": []string{"tenant1"}},
+		GrantType:           "urn:example:grant",
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	}
+
+	client := New(options)
+
+	if _, errSend := send(client, srv.URL); errSend != nil {
+		t.Errorf("send: %v", errSend)
+	}
+
+	if gotAudience != "aud1" {
+		t.Errorf("unexpected audience: %q", gotAudience)
+	}
+	if len(gotResources) != 2 || gotResources[0] != "https://api1" || gotResources[1] != "https://api2" {
+		t.Errorf("unexpected resources: %q", gotResources)
+	}
+
+	if gotTenant != "tenant1" {
+		t.Errorf("unexpected tenant: %q", gotTenant)
+	}
+
+	if gotGrantType != "urn:example:grant" {
+		t.Errorf("unexpected grant_type: %q", gotGrantType)
+	}
+
+	if key := client.cacheKey(); key != "clientID|audience=aud1|resource=https://api1 https://api2|token_url="+ts.URL+"|scope=" {
+		t.Errorf("unexpected cache key: %q", key)
+	}
+}
+
+func TestCacheKeyFunc(t *testing.T) {
+
+	options := Options{
+		TokenURL:            "http://token",
+		ClientID:            "clientID",
+		ClientSecret:        "clientSecret",
+		Scope:               "read write",
+		Audience:            "aud1",
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+		CacheKeyFunc: func(clientID, scope, tokenURL, audience string) string {
+			return strings.Join([]string{clientID, scope, tokenURL, audience}, "|")
+		},
+	}
+
+	client := New(options)
+
+	if key := client.cacheKey(); key != "clientID|read write|http://token|aud1" {
+		t.Errorf("unexpected cache key: %q", key)
+	}
+}
+
+func TestCacheKeyHMAC(t *testing.T) {
+
+	options := Options{
+		TokenURL:            "http://token",
+		ClientID:            "clientID",
+		ClientSecret:        "clientSecret",
+		CacheKeyHMACKey:     []byte("secret"),
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	}
+
+	client := New(options)
+
+	// echo -n 'clientID|token_url=http://token|scope=' | openssl dgst -sha256 -hmac secret
+	const expect = "a20b0c1b0de572a0891191b8d935536cc48248f97384d8e6fd21fe9a5f6a4998"
+
+	if key := client.cacheKey(); key != expect {
+		t.Errorf("unexpected cache key: %q", key)
+	}
+}
+
+func TestLocalCache(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "abc"
+
+	tokenServerStat := serverStat{}
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, token, 60)
+	defer ts.Close()
+
+	reject := false
+	serverStat := serverStat{}
+	srv := newServer(&serverStat, func(t string) bool { return !reject && t == token })
+	defer srv.Close()
+
+	client := New(Options{
+		TokenURL:            ts.URL,
+		ClientID:            clientID,
+		ClientSecret:        clientSecret,
+		LocalCache:          true,
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+
+	lastStep := func() string {
+		t.Helper()
+		req, errReq := http.NewRequestWithContext(context.TODO(), "GET", srv.URL, nil)
+		if errReq != nil {
+			t.Fatalf("request: %v", errReq)
+		}
+		out, errDo := client.DoWithOutput(req, WithTrace())
+		if errDo != nil {
+			t.Fatalf("do: %v", errDo)
+		}
+		out.Response.Body.Close()
+		return out.Trace[1].Step
+	}
+
+	table := []struct {
+		name   string
+		reject bool
+		expect string
+	}{
+		{"first request fetches", false, TraceTokenFetch},
+		{"second request hits local cache", false, TraceLocalCacheHit},
+		{"rejected token is evicted", true, TraceLocalCacheHit},
+		{"evicted token is fetched again", false, TraceTokenFetch},
+	}
+
+	for _, data := range table {
+		reject = data.reject
+		if step := lastStep(); step != data.expect {
+			t.Errorf("%s: expected step %s, got %s", data.name, data.expect, step)
+		}
+	}
+
+	if tokenServerStat.count != 2 {
+		t.Errorf("expected 2 token fetches, got %d", tokenServerStat.count)
+	}
+}
+
+func TestDisableCache(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "abc"
+
+	tokenServerStat := serverStat{}
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, token, 60)
+	defer ts.Close()
+
+	serverStat := serverStat{}
+	srv := newServer(&serverStat, func(t string) bool { return t == token })
+	defer srv.Close()
+
+	client := New(Options{
+		TokenURL:            ts.URL,
+		ClientID:            clientID,
+		ClientSecret:        clientSecret,
+		DisableCache:        true,
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+
+	const requests = 3
+
+	for i := range requests {
+		_, errSend := send(client, srv.URL)
+		if errSend != nil {
+			t.Fatalf("send %d: %v", i, errSend)
+		}
+	}
+
+	if tokenServerStat.count != requests {
+		t.Errorf("expected %d token fetches, got %d", requests, tokenServerStat.count)
+	}
+	if serverStat.count != requests {
+		t.Errorf("expected %d server requests, got %d", requests, serverStat.count)
+	}
+}
+
+func TestRetryOnUnauthorized(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+
+	table := []struct {
+		name           string
+		method         string
+		retry          bool
+		rewindable     bool
+		expectStatus   int
+		expectError    error
+		expectRequests int
+	}{
+		{"retry disabled", "POST", false, true, 401, nil, 1},
+		{"retry enabled", "POST", true, true, 200, nil, 2},
+		{"non-idempotent method", "PATCH", true, true, 200, nil, 2},
+		{"body not rewindable", "POST", true, false, 0, ErrBodyNotReplayable, 1},
+	}
+
+	for _, data := range table {
+
+		tokenServerStat := serverStat{}
+		ts := newTokenServer(&tokenServerStat, clientID, clientSecret, "abc", 60)
+
+		var requests int
+		var lastBody string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			b, _ := io.ReadAll(r.Body)
+			lastBody = string(b)
+			if requests == 1 {
+				httpJSON(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+				return
+			}
+			httpJSON(w, `{"message":"ok"}`, http.StatusOK)
+		}))
+
+		client := New(Options{
+			TokenURL:            ts.URL,
+			ClientID:            clientID,
+			ClientSecret:        clientSecret,
+			RetryOnUnauthorized: data.retry,
+			GroupcacheWorkspace: groupcache.NewWorkspace(),
+		})
+
+		var body io.Reader = strings.NewReader("payload")
+		if !data.rewindable {
+			body = io.NopCloser(body)
+		}
+
+		req, errReq := http.NewRequestWithContext(context.TODO(), data.method, srv.URL, body)
+		if errReq != nil {
+			t.Fatalf("%s: request: %v", data.name, errReq)
+		}
+
+		resp, errDo := client.Do(req)
+		if !errors.Is(errDo, data.expectError) {
+			t.Fatalf("%s: expected error %v, got: %v", data.name, data.expectError, errDo)
+		}
+		if errDo == nil {
+			resp.Body.Close()
+			if resp.StatusCode != data.expectStatus {
+				t.Errorf("%s: expected status %d, got %d", data.name, data.expectStatus, resp.StatusCode)
+			}
+		}
+		if requests != data.expectRequests {
+			t.Errorf("%s: expected %d server requests, got %d", data.name, data.expectRequests, requests)
+		}
+		if lastBody != "payload" {
+			t.Errorf("%s: unexpected body: %q", data.name, lastBody)
+		}
+		if tokenServerStat.count != data.expectRequests {
+			t.Errorf("%s: expected %d token fetches, got %d", data.name, data.expectRequests, tokenServerStat.count)
+		}
+
+		srv.Close()
+		ts.Close()
+	}
+}
+
+func TestRetryOnUnauthorizedConcurrent(t *testing.T) {
+
+	var tokens atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		httpJSON(w, fmt.Sprintf(`{"access_token":"t%d","expires_in":60}`, tokens.Add(1)), http.StatusOK)
+	}))
+	defer ts.Close()
+
+	// the first token is rejected, requests using it are retried
+	srv := newServer(&serverStat{}, func(t string) bool { return t != "t1" })
+	defer srv.Close()
+
+	client := New(Options{
+		TokenURL:            ts.URL,
+		ClientID:            "clientID",
+		ClientSecret:        "clientSecret",
+		RetryOnUnauthorized: true,
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+	defer client.Close()
+
+	for _, status := range doConcurrent(t, client, srv.URL) {
+		if status != http.StatusOK {
+			t.Errorf("unexpected status: %d", status)
+		}
+	}
+}
+
+// doConcurrent sends one request from concurrent goroutines, for the race
+// detector, checking the request is never modified. It returns the
+// response statuses.
+func doConcurrent(t *testing.T, client *Client, serverURL string) []int {
+	t.Helper()
+
+	req, errReq := http.NewRequestWithContext(context.TODO(), "GET", serverURL, nil)
+	if errReq != nil {
+		t.Fatalf("request: %v", errReq)
+	}
+
+	const n = 8
+	statuses := make([]int, n)
+
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, errDo := client.Do(req)
+			if errDo != nil {
+				t.Errorf("do %d: %v", i, errDo)
+				return
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			statuses[i] = resp.StatusCode
+		}()
+	}
+	wg.Wait()
+
+	if len(req.Header) != 0 {
+		t.Errorf("request modified: %v", req.Header)
+	}
+
+	return statuses
+}
+
+func TestRequestNotModified(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+
+	tokenServerStat := serverStat{}
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, "abc", 60)
+	defer ts.Close()
+
+	serverStat := serverStat{}
+	srv := newServer(&serverStat, func(t string) bool { return t == "abc" })
+	defer srv.Close()
+
+	client := newClient(ts.URL, clientID, clientSecret, 0)
+
+	req, errReq := http.NewRequestWithContext(context.TODO(), "GET", srv.URL, nil)
+	if errReq != nil {
+		t.Fatalf("request: %v", errReq)
+	}
+	req.Header.Set("X-Custom", "value")
+
+	for i := range 2 {
+		resp, errDo := client.Do(req)
+		if errDo != nil {
+			t.Fatalf("do %d: %v", i, errDo)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != 200 {
+			t.Errorf("do %d: unexpected status: %d", i, resp.StatusCode)
+		}
+		if auth := req.Header.Get("Authorization"); auth != "" {
+			t.Errorf("do %d: request modified: Authorization=%q", i, auth)
+		}
+		if len(req.Header) != 1 || req.Header.Get("X-Custom") != "value" {
+			t.Errorf("do %d: request headers modified: %v", i, req.Header)
+		}
+	}
+}
+
+type countingDoer struct {
+	count int
+}
+
+func (d *countingDoer) Do(req *http.Request) (*http.Response, error) {
+	d.count++
+	return http.DefaultClient.Do(req)
+}
+
+func TestTokenHTTPClient(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+
+	tokenServerStat := serverStat{}
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, "abc", 60)
+	defer ts.Close()
+
+	serverStat := serverStat{}
+	srv := newServer(&serverStat, func(t string) bool { return t == "abc" })
+	defer srv.Close()
+
+	targetClient := &countingDoer{}
+	tokenClient := &countingDoer{}
+
+	client := New(Options{
+		TokenURL:            ts.URL,
+		ClientID:            clientID,
+		ClientSecret:        clientSecret,
+		HTTPClient:          targetClient,
+		TokenHTTPClient:     tokenClient,
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+
+	for i := range 2 {
+		if _, errSend := send(client, srv.URL); errSend != nil {
+			t.Fatalf("send %d: %v", i, errSend)
+		}
+	}
+
+	if tokenClient.count != 1 {
+		t.Errorf("expected 1 token request on token client, got %d", tokenClient.count)
+	}
+	if targetClient.count != 2 {
+		t.Errorf("expected 2 target requests on target client, got %d", targetClient.count)
+	}
+}
+
+func TestTokenRequestTimeout(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(200 * time.Millisecond):
+		}
+		httpJSON(w, `{"access_token":"abc","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	serverStat := serverStat{}
+	srv := newServer(&serverStat, func(t string) bool { return t == "abc" })
+	defer srv.Close()
+
+	client := New(Options{
+		TokenURL:            ts.URL,
+		ClientID:            "clientID",
+		ClientSecret:        "clientSecret",
+		TokenRequestTimeout: 20 * time.Millisecond,
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+
+	req, errReq := http.NewRequestWithContext(context.TODO(), "GET", srv.URL, nil)
+	if errReq != nil {
+		t.Fatalf("request: %v", errReq)
+	}
+
+	begin := time.Now()
+	_, errDo := client.Do(req)
+	elap := time.Since(begin)
+
+	var tokenErr *TokenError
+	if !errors.As(errDo, &tokenErr) {
+		t.Fatalf("expected token error, got: %v", errDo)
+	}
+	if tokenErr.SuggestedStatus != http.StatusGatewayTimeout {
+		t.Errorf("expected suggested status 504, got %d", tokenErr.SuggestedStatus)
+	}
+	if elap > 150*time.Millisecond {
+		t.Errorf("token request not timed out: elapsed %v", elap)
+	}
+}
+
+func TestTokenWaitTimeout(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(200 * time.Millisecond):
+		}
+		httpJSON(w, `{"access_token":"abc","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	serverStat := serverStat{}
+	srv := newServer(&serverStat, func(t string) bool { return t == "abc" })
+	defer srv.Close()
+
+	// retries would exceed the wait timeout
+	client := New(Options{
+		TokenURL:            ts.URL,
+		ClientID:            "clientID",
+		ClientSecret:        "clientSecret",
+		TokenRequestTimeout: 20 * time.Millisecond,
+		TokenRetries:        10,
+		TokenWaitTimeout:    50 * time.Millisecond,
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+
+	req, errReq := http.NewRequestWithContext(context.TODO(), "GET", srv.URL, nil)
+	if errReq != nil {
+		t.Fatalf("request: %v", errReq)
+	}
+
+	begin := time.Now()
+	_, errDo := client.Do(req)
+	elap := time.Since(begin)
+
+	var tokenErr *TokenError
+	if !errors.As(errDo, &tokenErr) {
+		t.Fatalf("expected token error, got: %v", errDo)
+	}
+	if elap > 150*time.Millisecond {
+		t.Errorf("token acquisition not timed out: elapsed %v", elap)
+	}
+	if serverStat.count != 0 {
+		t.Errorf("request should not be sent, got %d", serverStat.count)
+	}
+}
+
+func TestClientAuthEncoding(t *testing.T) {
+
+	const clientID = "client id+1"
+	const clientSecret = "p%ss+w:rd é"
+
+	table := []struct {
+		name       string
+		basic      bool
+		noEncoding bool
+		expectID   string
+		expectSec  string
+	}{
+		{"form body", false, false, clientID, clientSecret},
+		{"basic encoded", true, false, url.QueryEscape(clientID), url.QueryEscape(clientSecret)},
+		{"basic raw", true, true, clientID, clientSecret},
+	}
+
+	for _, data := range table {
+		var gotID, gotSecret string
+		var gotBasic bool
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			if id, secret, ok := r.BasicAuth(); ok {
+				gotBasic = true
+				gotID, gotSecret = id, secret
+			} else {
+				gotID, gotSecret = formParam(r, "client_id"), formParam(r, "client_secret")
+			}
+			httpJSON(w, `{"access_token":"abc","expires_in":60}`, http.StatusOK)
+		}))
+
+		client := New(Options{
+			TokenURL:                  ts.URL,
+			ClientID:                  clientID,
+			ClientSecret:              clientSecret,
+			ClientAuthBasic:           data.basic,
+			ClientAuthBasicNoEncoding: data.noEncoding,
+			GroupcacheWorkspace:       groupcache.NewWorkspace(),
+		})
+
+		if _, errToken := client.Token(context.TODO()); errToken != nil {
+			t.Errorf("%s: token: %v", data.name, errToken)
+		}
+		client.Close()
+		ts.Close()
+
+		if gotBasic != data.basic {
+			t.Errorf("%s: expected basic auth=%v, got %v", data.name, data.basic, gotBasic)
+		}
+		if gotID != data.expectID || gotSecret != data.expectSec {
+			t.Errorf("%s: expected credentials %q:%q, got %q:%q",
+				data.name, data.expectID, data.expectSec, gotID, gotSecret)
+		}
+		if data.basic && !data.noEncoding {
+			id, _ := url.QueryUnescape(gotID)
+			secret, _ := url.QueryUnescape(gotSecret)
+			if id != clientID || secret != clientSecret {
+				t.Errorf("%s: decoded credentials mismatch: %q:%q", data.name, id, secret)
+			}
+		}
+	}
+}
+
+func TestAuthorizationHeader(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+
+	tokenServerStat := serverStat{}
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, "abc", 60)
+	defer ts.Close()
+
+	var gotHeader http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Clone()
+		httpJSON(w, `{"message":"ok"}`, http.StatusOK)
+	}))
+	defer srv.Close()
+
+	table := []struct {
+		name         string
+		header       string
+		scheme       string
+		expectHeader string
+		expectValue  string
+	}{
+		{"default", "", "", "Authorization", "Bearer abc"},
+		{"custom scheme", "", "Token", "Authorization", "Token abc"},
+		{"custom header", "x-api-authorization", "Token", "X-Api-Authorization", "Token abc"},
+		{"raw token", "X-Api-Key", AuthorizationSchemeNone, "X-Api-Key", "abc"},
+	}
+
+	for _, data := range table {
+		client := New(Options{
+			TokenURL:            ts.URL,
+			ClientID:            clientID,
+			ClientSecret:        clientSecret,
+			AuthorizationHeader: data.header,
+			AuthorizationScheme: data.scheme,
+			GroupcacheWorkspace: groupcache.NewWorkspace(),
+		})
+
+		if _, errSend := send(client, srv.URL); errSend != nil {
+			t.Fatalf("%s: send: %v", data.name, errSend)
+		}
+
+		if got := gotHeader.Get(data.expectHeader); got != data.expectValue {
+			t.Errorf("%s: expected %s=%q, got %q", data.name, data.expectHeader, data.expectValue, got)
+		}
+		if data.expectHeader != "Authorization" && gotHeader.Get("Authorization") != "" {
+			t.Errorf("%s: unexpected Authorization header", data.name)
+		}
+	}
+}
+
+func TestInjectToken(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+
+	tokenServerStat := serverStat{}
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, "abc", 60)
+	defer ts.Close()
+
+	var gotQuery, gotCookie, gotAuthorization string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.Query().Get("access_token")
+		if c, errCookie := r.Cookie("token"); errCookie == nil {
+			gotCookie = c.Value
+		}
+		gotAuthorization = r.Header.Get("Authorization")
+		httpJSON(w, `{"message":"ok"}`, http.StatusOK)
+	}))
+	defer srv.Close()
+
+	client := New(Options{
+		TokenURL:     ts.URL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		InjectToken: func(req *http.Request, token string) {
+			q := req.URL.Query()
+			q.Set("access_token", token)
+			req.URL.RawQuery = q.Encode()
+			req.AddCookie(&http.Cookie{Name: "token", Value: token})
+		},
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+
+	req, errReq := http.NewRequestWithContext(context.TODO(), "GET", srv.URL+"/path?a=b", nil)
+	if errReq != nil {
+		t.Fatalf("request: %v", errReq)
+	}
+
+	resp, errDo := client.Do(req)
+	if errDo != nil {
+		t.Fatalf("do: %v", errDo)
+	}
+	resp.Body.Close()
+
+	if gotQuery != "abc" {
+		t.Errorf("expected query token abc, got %q", gotQuery)
+	}
+	if gotCookie != "abc" {
+		t.Errorf("expected cookie token abc, got %q", gotCookie)
+	}
+	if gotAuthorization != "" {
+		t.Errorf("unexpected Authorization header: %q", gotAuthorization)
+	}
+	if req.URL.RawQuery != "a=b" {
+		t.Errorf("request URL modified: %s", req.URL)
+	}
+	if len(req.Header) != 0 {
+		t.Errorf("request headers modified: %v", req.Header)
+	}
+}
+
+func TestCachedTokenFormat(t *testing.T) {
+
+	now := time.UnixMilli(time.Now().UnixMilli())
+
+	tok := storedToken{
+		authToken: authToken{
+			tokenType:   "Bearer",
+			accessToken: "abc",
+			scope:       "read",
+			obtainedAt:  now,
+		},
+		hardExpire: now.Add(time.Minute),
+	}
+
+	value, errEncode := encodeToken(tok)
+	if errEncode != nil {
+		t.Fatalf("encode: %v", errEncode)
+	}
+
+	table := []struct {
+		name         string
+		value        string
+		expectError  bool
+		expectScope  string
+		expectObtain time.Time
+	}{
+		{"round trip", value, false, "read", now},
+		{"legacy bare access token", "abc", false, "", time.Time{}},
+		{"future version", `{"v":2,"t":"Bearer","a":"abc"}`, true, "", time.Time{}},
+		{"empty", "", true, "", time.Time{}},
+	}
+
+	for _, data := range table {
+		got, errDecode := decodeToken([]byte(data.value))
+		if gotError := errDecode != nil; gotError != data.expectError {
+			t.Errorf("%s: expected error=%t, got: %v", data.name, data.expectError, errDecode)
+			continue
+		}
+		if errDecode != nil {
+			continue
+		}
+		if got.accessToken != "abc" || got.tokenType != "Bearer" || got.scope != data.expectScope {
+			t.Errorf("%s: unexpected token: %+v", data.name, got.authToken)
+		}
+		if got.authorization != "Bearer abc" {
+			t.Errorf("%s: unexpected authorization: %q", data.name, got.authorization)
+		}
+		if !got.obtainedAt.Equal(data.expectObtain) {
+			t.Errorf("%s: expected obtained at %v, got %v", data.name, data.expectObtain, got.obtainedAt)
+		}
+	}
+}
+
+func TestOutputHeaders(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "abc"
+	expireIn := 60
+
+	tokenServerStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, token, expireIn)
+	defer ts.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ /*r*/ *http.Request) {
+		w.Header().Set("X-Request-Id", "req1")
+		w.Header().Add("X-Ratelimit-Remaining", "10")
+		httpJSON(w, `{"message":"ok"}`, http.StatusOK)
+	}))
+	defer srv.Close()
+
+	options := Options{
+		TokenURL:            ts.URL,
+		ClientID:            clientID,
+		ClientSecret:        clientSecret,
+		OutputHeaders:       []string{"x-request-id", "X-RateLimit-Remaining", "X-Missing"},
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	}
+
+	client := New(options)
+
+	req, errReq := http.NewRequestWithContext(context.TODO(), "GET", srv.URL, nil)
+	if errReq != nil {
+		t.Fatalf("request: %v", errReq)
+	}
+
+	out, errDo := client.DoWithOutput(req)
+	if errDo != nil {
+		t.Fatalf("do: %v", errDo)
+	}
+	out.Response.Body.Close()
+
+	if got := out.Headers.Get("X-Request-Id"); got != "req1" {
+		t.Errorf("unexpected X-Request-Id: %q", got)
+	}
+	if got := out.Headers.Get("X-Ratelimit-Remaining"); got != "10" {
+		t.Errorf("unexpected X-Ratelimit-Remaining: %q", got)
+	}
+	if _, found := out.Headers["X-Missing"]; found {
+		t.Errorf("unexpected X-Missing header")
+	}
+}
+
+func TestTrace(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "abc"
+	expireIn := 60
+	softExpire := 0
+
+	tokenServerStat := serverStat{}
+	serverStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, token, expireIn)
+	defer ts.Close()
+
+	validToken := func(t string) bool { return t == token }
+
+	srv := newServer(&serverStat, validToken)
+	defer srv.Close()
+
+	client := newClient(ts.URL, clientID, clientSecret, softExpire)
+
+	traceSteps := func() []string {
+		req, errReq := http.NewRequestWithContext(context.TODO(), "GET", srv.URL, nil)
+		if errReq != nil {
+			t.Fatalf("request: %v", errReq)
+		}
+		out, errDo := client.DoWithOutput(req, WithTrace())
+		if errDo != nil {
+			t.Fatalf("do: %v", errDo)
+		}
+		out.Response.Body.Close()
+		var steps []string
+		for _, e := range out.Trace {
+			steps = append(steps, e.Step)
+		}
+		return steps
+	}
+
+	// send 1: fetch
+
+	if steps := strings.Join(traceSteps(), " "); steps != "cache_get token_fetch" {
+		t.Errorf("send 1: unexpected trace: %s", steps)
+	}
+
+	// send 2: cache hit
+
+	if steps := strings.Join(traceSteps(), " "); steps != "cache_get cache_hit" {
+		t.Errorf("send 2: unexpected trace: %s", steps)
+	}
+
+	// send 3: rejected
+
+	token = "broken"
+
+	if steps := strings.Join(traceSteps(), " "); steps != "cache_get cache_hit token_rejected" {
+		t.Errorf("send 3: unexpected trace: %s", steps)
+	}
+}
+
+func TestTokenType(t *testing.T) {
+
+	table := []struct {
+		name             string
+		tokenResponse    string
+		defaultTokenType string
+		expectHeader     string
+	}{
+		{"missing token_type", `{"access_token":"abc","expires_in":60}`, "", "Bearer abc"},
+		{"lowercase bearer", `{"access_token":"abc","expires_in":60,"token_type":"bearer"}`, "", "Bearer abc"},
+		{"custom token_type", `{"access_token":"abc","expires_in":60,"token_type":"DPoP"}`, "", "DPoP abc"},
+		{"custom default", `{"access_token":"abc","expires_in":60}`, "MAC", "MAC abc"},
+	}
+
+	for _, data := range table {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ /*r*/ *http.Request) {
+			httpJSON(w, data.tokenResponse, http.StatusOK)
+		}))
+
+		var gotHeader string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotHeader = r.Header.Get("Authorization")
+			httpJSON(w, `{"message":"ok"}`, http.StatusOK)
+		}))
+
+		options := Options{
+			TokenURL:            ts.URL,
+			ClientID:            "clientID",
+			ClientSecret:        "clientSecret",
+			DefaultTokenType:    data.defaultTokenType,
+			GroupcacheWorkspace: groupcache.NewWorkspace(),
+		}
+
+		client := New(options)
+
+		if _, errSend := send(client, srv.URL); errSend != nil {
+			t.Errorf("%s: send: %v", data.name, errSend)
+		}
+
+		if gotHeader != data.expectHeader {
+			t.Errorf("%s: expected Authorization=%q got=%q", data.name, data.expectHeader, gotHeader)
+		}
+
+		ts.Close()
+		srv.Close()
+	}
+}
+
+func TestParseTokenResponse(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ /*r*/ *http.Request) {
+		httpJSON(w, `{"result":{"accessToken":"abc","expiresIn":60}}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	serverStat := serverStat{}
+	srv := newServer(&serverStat, func(t string) bool { return t == "abc" })
+	defer srv.Close()
+
+	parse := func(body []byte) (TokenInfo, error) {
+		var data struct {
+			Result struct {
+				AccessToken string `json:"accessToken"`
+				ExpiresIn   int    `json:"expiresIn"`
+			} `json:"result"`
+		}
+		errJSON := json.Unmarshal(body, &data)
+		return TokenInfo{
+			AccessToken: data.Result.AccessToken,
+			ExpiresIn:   time.Duration(data.Result.ExpiresIn) * time.Second,
+		}, errJSON
+	}
+
+	options := Options{
+		TokenURL:            ts.URL,
+		ClientID:            "clientID",
+		ClientSecret:        "clientSecret",
+		ParseTokenResponse:  parse,
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	}
+
+	client := New(options)
+
+	if _, errSend := send(client, srv.URL); errSend != nil {
+		t.Errorf("send: %v", errSend)
+	}
+}
+
+func TestOutputTokenMetadata(t *testing.T) {
+
+	const fetchDelay = 5 * time.Millisecond
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ /*r*/ *http.Request) {
+		time.Sleep(fetchDelay)
+		httpJSON(w, `{"access_token":"abc","expires_in":60,"token_type":"bearer","scope":"scope1"}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	serverStat := serverStat{}
+	srv := newServer(&serverStat, func(t string) bool { return t == "abc" })
+	defer srv.Close()
+
+	client := newClient(ts.URL, "clientID", "clientSecret", 0)
+
+	for i := range 2 {
+		req, errReq := http.NewRequestWithContext(context.TODO(), "GET", srv.URL, nil)
+		if errReq != nil {
+			t.Fatalf("request: %v", errReq)
+		}
+
+		begin := time.Now()
+
+		out, errDo := client.DoWithOutput(req)
+		if errDo != nil {
+			t.Fatalf("do %d: %v", i, errDo)
+		}
+		out.Response.Body.Close()
+
+		if out.Scope != "scope1" {
+			t.Errorf("do %d: unexpected scope: %q", i, out.Scope)
+		}
+		if out.TokenType != "Bearer" {
+			t.Errorf("do %d: unexpected token type: %q", i, out.TokenType)
+		}
+		if out.TokenExpire.Before(begin.Add(59*time.Second)) || out.TokenExpire.After(time.Now().Add(61*time.Second)) {
+			t.Errorf("do %d: unexpected token expire: %v", i, out.TokenExpire)
+		}
+		if expectFetched := i == 0; out.TokenFetched != expectFetched {
+			t.Errorf("do %d: expected token fetched=%t, got %t", i, expectFetched, out.TokenFetched)
+		}
+		if out.TokenFetchLatency < fetchDelay {
+			t.Errorf("do %d: unexpected token fetch latency: %v", i, out.TokenFetchLatency)
+		}
+		if out.CacheKey != client.cacheKey() {
+			t.Errorf("do %d: unexpected cache key: %q", i, out.CacheKey)
+		}
+	}
+}
+
+func TestPreserveAuthorization(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "abc"
+	expireIn := 60
+
+	tokenServerStat := serverStat{}
+	serverStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, token, expireIn)
+	defer ts.Close()
+
+	srv := newServer(&serverStat, func(t string) bool { return t == token || t == "own" })
+	defer srv.Close()
+
+	client := newClient(ts.URL, clientID, clientSecret, 0)
+
+	doOwn := func(opts ...RequestOption) {
+		t.Helper()
+		req, errReq := http.NewRequestWithContext(context.TODO(), "GET", srv.URL, nil)
+		if errReq != nil {
+			t.Fatalf("request: %v", errReq)
+		}
+		req.Header.Set("Authorization", "Bearer own")
+		out, errDo := client.DoWithOutput(req, opts...)
+		if errDo != nil {
+			t.Fatalf("do: %v", errDo)
+		}
+		out.Response.Body.Close()
+	}
+
+	// preserved: no token fetch
+
+	doOwn(WithPreserveAuthorization())
+	if tokenServerStat.count != 0 {
+		t.Errorf("preserved: unexpected token server access count: %d", tokenServerStat.count)
+	}
+
+	// not preserved: token injected
+
+	doOwn()
+	if tokenServerStat.count != 1 {
+		t.Errorf("injected: unexpected token server access count: %d", tokenServerStat.count)
+	}
+}
+
+func BenchmarkDoCached(b *testing.B) {
+	benchmarkDo(b, false)
+}
+
+func BenchmarkDoLocalCache(b *testing.B) {
+	benchmarkDo(b, true)
+}
+
+func benchmarkDo(b *testing.B, localCache bool) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "abc"
+
+	tokenServerStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, token, 3600)
+	defer ts.Close()
+
+	var nop nopDoer
+
+	client := New(Options{
+		TokenURL:            ts.URL,
+		ClientID:            clientID,
+		ClientSecret:        clientSecret,
+		HTTPClient:          &tokenOnlyDoer{target: &nop},
+		LocalCache:          localCache,
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+
+	req, errReq := http.NewRequestWithContext(context.TODO(), "GET", "http://target/", nil)
+	if errReq != nil {
+		b.Fatalf("request: %v", errReq)
+	}
+
+	if _, errDo := client.Do(req); errDo != nil {
+		b.Fatalf("do: %v", errDo)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for range b.N {
+		if _, errDo := client.Do(req); errDo != nil {
+			b.Fatalf("do: %v", errDo)
+		}
+	}
+}
+
+// nopDoer answers every request with an empty 200 response.
+type nopDoer struct {
+	resp http.Response
+}
+
+func (d *nopDoer) Do(_ *http.Request) (*http.Response, error) {
+	d.resp.StatusCode = 200
+	return &d.resp, nil
+}
+
+// tokenOnlyDoer sends token requests over the network and target
+// requests to target.
+type tokenOnlyDoer struct {
+	target HTTPClientDoer
+}
+
+func (d *tokenOnlyDoer) Do(req *http.Request) (*http.Response, error) {
+	if req.Method == "POST" {
+		return http.DefaultClient.Do(req)
+	}
+	return d.target.Do(req)
+}
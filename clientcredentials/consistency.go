@@ -0,0 +1,91 @@
+package clientcredentials
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/modernprogram/groupcache/v2"
+	pb "github.com/modernprogram/groupcache/v2/groupcachepb"
+)
+
+// ConsistencyReport summarizes a cache consistency check.
+type ConsistencyReport struct {
+	// Checked counts keys compared against their owner peer.
+	Checked int
+
+	// Diverged lists keys whose local copy differs from the owner copy.
+	Diverged []string
+
+	// Errors counts keys whose owner peer could not be queried.
+	Errors int
+}
+
+// CheckConsistency compares fingerprints of the tokens last used by this
+// client, and clients derived from it, against the copies held by the
+// owner peers, as located by peers, e.g. the *groupcache.HTTPPool.
+// Persistent divergence reveals peers disagreeing on key ownership,
+// e.g. due to misconfigured peer lists, or clock problems; transient
+// divergence is expected right after token renewals.
+// Keys owned by this instance are skipped.
+// Requires the default groupcache TokenCache.
+func (c *Client) CheckConsistency(ctx context.Context, peers groupcache.PeerPicker) ConsistencyReport {
+	var report ConsistencyReport
+
+	if c.group == nil {
+		return report
+	}
+
+	groupName := c.group.Name()
+
+	c.owners.Range(func(_, owner any) bool {
+		o := owner.(*Client)
+		if o.derived {
+			return true // derived clients are kept off the peer ring
+		}
+		o.decoded.Range(func(k, v any) bool {
+			key := k.(string)
+			if owner, found := c.owners.Load(key); !found || owner.(*Client).derived {
+				return true // decoded is shared with derived clients
+			}
+			peer, remote := peers.PickPeer(key)
+			if !remote {
+				return true
+			}
+
+			var resp pb.GetResponse
+			req := pb.GetRequest{Group: &groupName, Key: &key}
+			if errGet := peer.Get(ctx, &req, &resp); errGet != nil {
+				report.Errors++
+				c.metrics.consistency.WithLabelValues("error").Inc()
+				c.errorf("consistency check: key=%s peer=%s: %v", key, peer.GetURL(), errGet)
+				return true
+			}
+
+			report.Checked++
+
+			local := fingerprint([]byte(v.(*decodedToken).raw))
+			remoteFP := fingerprint(resp.Value)
+			if local == remoteFP {
+				c.metrics.consistency.WithLabelValues("consistent").Inc()
+				return true
+			}
+
+			report.Diverged = append(report.Diverged, key)
+			c.metrics.consistency.WithLabelValues("diverged").Inc()
+			c.warnf("consistency check: key=%s peer=%s: local=%s owner=%s",
+				key, peer.GetURL(), local, remoteFP)
+
+			return true
+		})
+		return true
+	})
+
+	return report
+}
+
+// fingerprint identifies a cached value without exposing it.
+func fingerprint(value []byte) string {
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,82 @@
+package clientcredentials
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/modernprogram/groupcache/v2"
+	pb "github.com/modernprogram/groupcache/v2/groupcachepb"
+)
+
+type fakePeer struct {
+	value []byte
+	err   error
+}
+
+func (p *fakePeer) Get(_ context.Context, _ *pb.GetRequest, out *pb.GetResponse) error {
+	out.Value = p.value
+	return p.err
+}
+
+func (p *fakePeer) Remove(context.Context, *pb.GetRequest) error { return nil }
+func (p *fakePeer) Set(context.Context, *pb.SetRequest) error    { return nil }
+func (p *fakePeer) GetURL() string                               { return "http://peer" }
+
+type fakePicker struct {
+	peer *fakePeer // nil means self is owner
+}
+
+func (p fakePicker) PickPeer(string) (groupcache.ProtoGetter, bool) {
+	if p.peer == nil {
+		return nil, false
+	}
+	return p.peer, true
+}
+
+func (p fakePicker) GetAll() []groupcache.ProtoGetter { return nil }
+
+func TestCheckConsistency(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+
+	tokenServerStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, "abc", 60)
+	defer ts.Close()
+
+	client := newClient(ts.URL, clientID, clientSecret, 0)
+
+	if _, errTok := client.Token(context.TODO()); errTok != nil {
+		t.Fatalf("token: %v", errTok)
+	}
+
+	// derived clients are kept off the peer ring, hence not checked
+	if _, errTok := client.WithScope("other").Token(context.TODO()); errTok != nil {
+		t.Fatalf("derived token: %v", errTok)
+	}
+
+	v, _ := client.decoded.Load(client.cacheKey())
+	local := []byte(v.(*decodedToken).raw)
+
+	table := []struct {
+		name   string
+		picker fakePicker
+		expect ConsistencyReport
+	}{
+		{"self owner", fakePicker{}, ConsistencyReport{}},
+		{"consistent", fakePicker{&fakePeer{value: local}}, ConsistencyReport{Checked: 1}},
+		{"diverged", fakePicker{&fakePeer{value: []byte("other")}},
+			ConsistencyReport{Checked: 1, Diverged: []string{client.cacheKey()}}},
+		{"peer error", fakePicker{&fakePeer{err: errors.New("down")}}, ConsistencyReport{Errors: 1}},
+	}
+
+	for _, data := range table {
+		report := client.CheckConsistency(context.TODO(), data.picker)
+		if report.Checked != data.expect.Checked || report.Errors != data.expect.Errors ||
+			len(report.Diverged) != len(data.expect.Diverged) {
+			t.Errorf("%s: expected %+v, got %+v", data.name, data.expect, report)
+		}
+	}
+}
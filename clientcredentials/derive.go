@@ -0,0 +1,195 @@
+package clientcredentials
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// WithScope returns a client requesting tokens with the given scope,
+// sharing cache, HTTP client, metrics and background tasks with c.
+// Tokens are cached under a key distinct from c.
+// The derived client must not be closed; close the root client instead.
+func (c *Client) WithScope(scope string) *Client {
+	d := c.derive()
+	d.options.Scope = scope
+	d.scopeInKey = true
+	return d.register()
+}
+
+// WithAudience returns a client requesting tokens for the given audience,
+// sharing cache, HTTP client, metrics and background tasks with c.
+// Tokens are cached under a key distinct from c.
+// The derived client must not be closed; close the root client instead.
+func (c *Client) WithAudience(audience string) *Client {
+	d := c.derive()
+	d.options.Audience = audience
+	return d.register()
+}
+
+// WithCredentials returns a client for another tenant, requesting tokens
+// with the given client credentials, sharing cache, HTTP client, metrics
+// and background tasks with c. Tokens are cached under a key built
+// from clientID and a digest of clientSecret, see Options.CacheKeySecret,
+// so callers presenting a known clientID with another secret never
+// obtain the cached token. Once the token server accepts a new secret
+// for the same clientID, the client and token of the previous secret
+// are evicted, see evictRotated. With groupcache, tokens of derived
+// clients are cached in process memory, since peers cannot load them,
+// see derive.
+// The derived client must not be closed; close the root client instead.
+func (c *Client) WithCredentials(clientID, clientSecret string) *Client {
+	d := c.derive()
+	d.options.ClientID = clientID
+	d.options.ClientSecret = clientSecret
+	d.options.CredentialsProvider = nil // explicit credentials
+	d.options.FallbackClientSecrets = nil
+	d.secrets = nil
+	d.secretInKey = true
+	return d.register()
+}
+
+// derive copies c into a derived client. With groupcache, derived
+// clients cache tokens in a process-local cache shared by the family,
+// instead of the group: the owner peer of a derived key would not know
+// the derived client, hence could not load its token.
+func (c *Client) derive() *Client {
+	return &Client{
+		derived:       true,
+		options:       c.options,
+		doer:          c.doer,
+		cache:         c.derivedCache,
+		derivedCache:  c.derivedCache,
+		group:         c.group,
+		persist:       c.persist,
+		aead:          c.aead,
+		tokens:        c.tokens,
+		limiter:       c.limiter,
+		rate:          c.rate,
+		endpoints:     c.endpoints,
+		secrets:       c.secrets,
+		tracer:        c.tracer,
+		identities:    c.identities,
+		rejected:      c.rejected,
+		metrics:       c.metrics,
+		owners:        c.owners,
+		rotations:     c.rotations,
+		decoded:       c.decoded,
+		local:         c.local,
+		scopeInKey:    c.scopeInKey,
+		tokenURLInKey: c.tokenURLInKey,
+		secretInKey:   c.secretInKey,
+		namespaced:    c.namespaced,
+	}
+}
+
+// register records c as the loader for its cache key. Deriving twice
+// with the same parameters returns the client registered first.
+// Clients with distinct secrets have distinct keys, thus registering
+// a rotated secret, e.g. from a CredentialsProvider, neither replaces
+// the registered client nor evicts its token: the previous secret is
+// evicted once the token server accepts the new one, see evictRotated.
+// Clients rejected by Options.IdentityOverflow are not registered.
+func (c *Client) register() *Client {
+	c.key = c.buildCacheKey()
+	if c.secretInKey {
+		c.rotationKey = c.hashCacheKey(c.identityKey())
+	}
+	if c.rejected != nil {
+		return c
+	}
+	if !c.trackIdentity() {
+		c.rejected = ErrTooManyIdentities
+		return c
+	}
+	owner, _ := c.owners.LoadOrStore(c.key, c)
+	return owner.(*Client)
+}
+
+// evictRotated evicts the client and token of the previous secret for
+// the identity of c, a client derived with WithCredentials, after the
+// token server accepted the secret of c. Callers presenting a wrong
+// secret are refused by the token server, hence never evict the token
+// of the legitimate secret.
+func (c *Client) evictRotated() {
+	if !c.secretInKey {
+		return
+	}
+	prev, found := c.rotations.Swap(c.rotationKey, c.key)
+	if !found || prev.(string) == c.key {
+		return
+	}
+	key := prev.(string)
+	if owner, found := c.owners.LoadAndDelete(key); found {
+		owner.(*Client).evict(context.Background(), key)
+	}
+	c.identities.remove(key)
+	c.infof("client secret rotated: client_id=%s: evicted previous secret", c.options.ClientID)
+}
+
+// processCacheKeySecret keys client secret digests in cache keys when
+// Options.CacheKeySecret is unspecified.
+var processCacheKeySecret = func() []byte {
+	key := make([]byte, 32)
+	if _, errRand := rand.Read(key); errRand != nil {
+		panic(errRand)
+	}
+	return key
+}()
+
+// secretDigest identifies the client secret in cache keys of clients
+// derived with WithCredentials, without exposing it.
+func (c *Client) secretDigest() string {
+	key := c.options.CacheKeySecret
+	if len(key) == 0 {
+		key = processCacheKeySecret
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(c.options.ClientSecret))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// loadKey is the groupcache load function, dispatching to the client
+// owning the key. Only keys of clients created with New are loaded:
+// derived clients are kept off the peer ring, since peers cannot
+// rebuild them from the key, see derive. Keys unknown to this process
+// fail, and the requesting peer receives the error.
+func (c *Client) loadKey(ctx context.Context, key string) (string, time.Time, error) {
+	owner, found := c.owners.Load(key)
+	if !found || owner.(*Client).derived {
+		return "", time.Time{}, fmt.Errorf("unknown cache key: %s", key)
+	}
+	return owner.(*Client).loadValue(ctx)
+}
+
+type credentialsKey struct{}
+
+type contextCredentials struct {
+	clientID     string
+	clientSecret string
+}
+
+// ContextWithCredentials returns a context carrying per-request client
+// credentials, so internal services can pass per-tenant credentials to Do,
+// DoWithOutput and Token without putting secrets into HTTP headers.
+// The request is served by the client derived with WithCredentials, whose
+// cache key is bound to the secret: a wrong secret is sent to the token
+// server, never served the cached token.
+func ContextWithCredentials(ctx context.Context, clientID, clientSecret string) context.Context {
+	return context.WithValue(ctx, credentialsKey{},
+		contextCredentials{clientID: clientID, clientSecret: clientSecret})
+}
+
+type scopeKey struct{}
+
+// ContextWithScope returns a context carrying a per-request scope,
+// overriding Options.Scope for Do, DoWithOutput and Token.
+// The request is served by the client derived with WithScope, thus
+// tokens for distinct scopes are cached under distinct keys.
+func ContextWithScope(ctx context.Context, scope string) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope)
+}
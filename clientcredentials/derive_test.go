@@ -0,0 +1,518 @@
+package clientcredentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+func TestDerivedClients(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		token := "scope=" + formParam(r, "scope") + ",audience=" + formParam(r, "audience")
+		httpJSON(w, `{"access_token":"`+token+`","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	var gotToken string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotToken = r.Header.Get("Authorization")
+		httpJSON(w, `{"message":"ok"}`, http.StatusOK)
+	}))
+	defer srv.Close()
+
+	root := New(Options{
+		TokenURL:            ts.URL,
+		ClientID:            "clientID",
+		ClientSecret:        "clientSecret",
+		Scope:               "read",
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+	defer root.Close()
+
+	writer := root.WithScope("write")
+	other := writer.WithAudience("other")
+
+	if writer.group != root.group || other.group != root.group {
+		t.Errorf("derived clients should share the root group")
+	}
+
+	if again := root.WithScope("write"); again != writer {
+		t.Errorf("expected same derived client for same scope")
+	}
+
+	table := []struct {
+		name   string
+		client *Client
+		expect string
+	}{
+		{"root", root, "Bearer scope=read,audience="},
+		{"scope", writer, "Bearer scope=write,audience="},
+		{"scope and audience", other, "Bearer scope=write,audience=other"},
+		{"root again", root, "Bearer scope=read,audience="},
+	}
+
+	for _, data := range table {
+		if _, errSend := send(data.client, srv.URL); errSend != nil {
+			t.Errorf("%s: send: %v", data.name, errSend)
+		}
+		if gotToken != data.expect {
+			t.Errorf("%s: expected token %q, got %q", data.name, data.expect, gotToken)
+		}
+	}
+}
+
+func TestDerivedCredentialsEviction(t *testing.T) {
+
+	var fetches []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		clientID := formParam(r, "client_id")
+		fetches = append(fetches, clientID)
+		httpJSON(w, `{"access_token":"`+clientID+`","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	// the server rejects tenant2 tokens
+	srv := newServer(&serverStat{}, func(t string) bool { return t != "tenant2" })
+	defer srv.Close()
+
+	root := New(Options{
+		TokenURL:            ts.URL,
+		ClientID:            "root",
+		ClientSecret:        "rootSecret",
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+	defer root.Close()
+
+	tenant1 := root.WithCredentials("tenant1", "secret1")
+	tenant2 := root.WithCredentials("tenant2", "secret2")
+
+	table := []struct {
+		name           string
+		client         *Client
+		expectClientID string
+		expectStatus   int
+	}{
+		{"root", root, "root", 200},
+		{"tenant1", tenant1, "tenant1", 200},
+		{"tenant2 rejected", tenant2, "tenant2", 401},
+		{"root cached", root, "root", 200},
+		{"tenant1 cached", tenant1, "tenant1", 200},
+		{"tenant2 fetched again", tenant2, "tenant2", 401},
+	}
+
+	for _, data := range table {
+		req, errReq := http.NewRequest("GET", srv.URL, nil)
+		if errReq != nil {
+			t.Fatalf("%s: request: %v", data.name, errReq)
+		}
+		out, errDo := data.client.DoWithOutput(req)
+		if errDo != nil {
+			t.Fatalf("%s: do: %v", data.name, errDo)
+		}
+		out.Response.Body.Close()
+		if out.ClientID != data.expectClientID {
+			t.Errorf("%s: expected client id %s, got %s", data.name, data.expectClientID, out.ClientID)
+		}
+		if out.Response.StatusCode != data.expectStatus {
+			t.Errorf("%s: expected status %d, got %d", data.name, data.expectStatus, out.Response.StatusCode)
+		}
+	}
+
+	// only the rejected tenant token is evicted and fetched again
+	expect := "root,tenant1,tenant2,tenant2"
+	if got := strings.Join(fetches, ","); got != expect {
+		t.Errorf("expected fetches %s, got %s", expect, got)
+	}
+}
+
+func TestContextWithCredentials(t *testing.T) {
+
+	var fetches []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		clientID := formParam(r, "client_id")
+		fetches = append(fetches, clientID+":"+formParam(r, "client_secret"))
+		httpJSON(w, `{"access_token":"`+clientID+`","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	var gotToken string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotToken = r.Header.Get("Authorization")
+		httpJSON(w, `{"message":"ok"}`, http.StatusOK)
+	}))
+	defer srv.Close()
+
+	root := New(Options{
+		TokenURL:            ts.URL,
+		ClientID:            "root",
+		ClientSecret:        "rootSecret",
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+	defer root.Close()
+
+	table := []struct {
+		name   string
+		ctx    context.Context
+		expect string
+	}{
+		{"no credentials", context.TODO(), "Bearer root"},
+		{"tenant1", ContextWithCredentials(context.TODO(), "tenant1", "secret1"), "Bearer tenant1"},
+		{"tenant2", ContextWithCredentials(context.TODO(), "tenant2", "secret2"), "Bearer tenant2"},
+		{"tenant1 cached", ContextWithCredentials(context.TODO(), "tenant1", "secret1"), "Bearer tenant1"},
+		{"root credentials", ContextWithCredentials(context.TODO(), "root", "rootSecret"), "Bearer root"},
+		{"tenant1 secret rotated", ContextWithCredentials(context.TODO(), "tenant1", "rotated"), "Bearer tenant1"},
+		{"tenant1 rotated cached", ContextWithCredentials(context.TODO(), "tenant1", "rotated"), "Bearer tenant1"},
+	}
+
+	for _, data := range table {
+		req, errReq := http.NewRequestWithContext(data.ctx, "GET", srv.URL, nil)
+		if errReq != nil {
+			t.Fatalf("%s: request: %v", data.name, errReq)
+		}
+		resp, errDo := root.Do(req)
+		if errDo != nil {
+			t.Fatalf("%s: do: %v", data.name, errDo)
+		}
+		resp.Body.Close()
+		if gotToken != data.expect {
+			t.Errorf("%s: expected token %q, got %q", data.name, data.expect, gotToken)
+		}
+	}
+
+	tok, errToken := root.Token(ContextWithCredentials(context.TODO(), "tenant2", "secret2"))
+	if errToken != nil {
+		t.Fatalf("token: %v", errToken)
+	}
+	if tok.AccessToken != "tenant2" || tok.ClientID != "tenant2" {
+		t.Errorf("unexpected token: %+v", tok)
+	}
+
+	// the rotated secret is cached under its own key, fetching a new token
+	expect := "root:rootSecret,tenant1:secret1,tenant2:secret2,tenant1:rotated"
+	if got := strings.Join(fetches, ","); got != expect {
+		t.Errorf("expected fetches %s, got %s", expect, got)
+	}
+}
+
+func TestRequestScope(t *testing.T) {
+
+	var fetches []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		scope := formParam(r, "scope")
+		fetches = append(fetches, scope)
+		httpJSON(w, `{"access_token":"`+scope+`","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	var gotToken, gotScopeHeader string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotToken = r.Header.Get("Authorization")
+		gotScopeHeader = r.Header.Get("oauth2-scope")
+		httpJSON(w, `{"message":"ok"}`, http.StatusOK)
+	}))
+	defer srv.Close()
+
+	root := New(Options{
+		TokenURL:            ts.URL,
+		ClientID:            "clientID",
+		ClientSecret:        "clientSecret",
+		Scope:               "read",
+		ScopeHeader:         "oauth2-scope",
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+	defer root.Close()
+
+	table := []struct {
+		name   string
+		ctx    context.Context
+		header string
+		expect string
+	}{
+		{"default scope", context.TODO(), "", "Bearer read"},
+		{"header scope", context.TODO(), "write", "Bearer write"},
+		{"context scope", ContextWithScope(context.TODO(), "admin"), "", "Bearer admin"},
+		{"context over header", ContextWithScope(context.TODO(), "admin"), "write", "Bearer admin"},
+		{"header scope cached", context.TODO(), "write", "Bearer write"},
+		{"default scope cached", context.TODO(), "", "Bearer read"},
+		{"header default scope", context.TODO(), "read", "Bearer read"},
+	}
+
+	for _, data := range table {
+		req, errReq := http.NewRequestWithContext(data.ctx, "GET", srv.URL, nil)
+		if errReq != nil {
+			t.Fatalf("%s: request: %v", data.name, errReq)
+		}
+		if data.header != "" {
+			req.Header.Set("oauth2-scope", data.header)
+		}
+		resp, errDo := root.Do(req)
+		if errDo != nil {
+			t.Fatalf("%s: do: %v", data.name, errDo)
+		}
+		resp.Body.Close()
+		if gotToken != data.expect {
+			t.Errorf("%s: expected token %q, got %q", data.name, data.expect, gotToken)
+		}
+		if gotScopeHeader != "" {
+			t.Errorf("%s: scope header forwarded: %q", data.name, gotScopeHeader)
+		}
+		if data.header != "" && req.Header.Get("oauth2-scope") != data.header {
+			t.Errorf("%s: request header modified", data.name)
+		}
+	}
+
+	tok, errToken := root.Token(ContextWithScope(context.TODO(), "write"))
+	if errToken != nil {
+		t.Fatalf("token: %v", errToken)
+	}
+	if tok.AccessToken != "write" {
+		t.Errorf("unexpected token: %+v", tok)
+	}
+
+	expect := "read,write,admin"
+	if got := strings.Join(fetches, ","); got != expect {
+		t.Errorf("expected fetches %s, got %s", expect, got)
+	}
+}
+
+func TestDerivedClientsMultiPeer(t *testing.T) {
+
+	var fetches sync.Map // client_id => count
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		clientID := formParam(r, "client_id")
+		if formParam(r, "client_secret") != "secret-"+clientID {
+			httpJSON(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		n, _ := fetches.LoadOrStore(clientID, new(atomic.Int32))
+		n.(*atomic.Int32).Add(1)
+		httpJSON(w, `{"access_token":"`+clientID+`","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	var roots []*Client
+	for _, ws := range newPeers(t, 2) {
+		root := New(Options{
+			TokenURL:            ts.URL,
+			ClientID:            "root",
+			ClientSecret:        "secret-root",
+			GroupcacheWorkspace: ws,
+		})
+		defer root.Close()
+		roots = append(roots, root)
+	}
+
+	// each tenant is derived on a single peer, thus the other peer,
+	// possibly owning the key, does not know the tenant.
+	for i := 0; i < 20; i++ {
+		tenant := fmt.Sprintf("tenant%d", i)
+		root := roots[i%len(roots)]
+		tok, errTok := root.WithCredentials(tenant, "secret-"+tenant).Token(context.TODO())
+		if errTok != nil {
+			t.Errorf("%s: token: %v", tenant, errTok)
+			continue
+		}
+		if tok.AccessToken != tenant {
+			t.Errorf("%s: unexpected token: %s", tenant, tok.AccessToken)
+		}
+	}
+
+	// root tokens are still shared by peers
+	for i, root := range roots {
+		tok, errTok := root.Token(context.TODO())
+		if errTok != nil {
+			t.Fatalf("root %d: token: %v", i, errTok)
+		}
+		if tok.AccessToken != "root" {
+			t.Errorf("root %d: unexpected token: %s", i, tok.AccessToken)
+		}
+	}
+	if n, _ := fetches.Load("root"); n.(*atomic.Int32).Load() != 1 {
+		t.Errorf("expected single root token fetch, got %d", n.(*atomic.Int32).Load())
+	}
+}
+
+func TestDerivedCredentialsSecretInKey(t *testing.T) {
+
+	var fetches []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		clientID := formParam(r, "client_id")
+		fetches = append(fetches, clientID)
+		if formParam(r, "client_secret") != "secret-"+clientID {
+			httpJSON(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		httpJSON(w, `{"access_token":"`+clientID+`","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	// two instances sharing a TokenCache, e.g. Redis
+	cache := NewMemoryTokenCache()
+	newInstance := func() *Client {
+		return New(Options{
+			TokenURL:       ts.URL,
+			ClientID:       "root",
+			ClientSecret:   "secret-root",
+			TokenCache:     cache,
+			CacheKeySecret: []byte("shared"),
+		})
+	}
+	instance1 := newInstance()
+	defer instance1.Close()
+	instance2 := newInstance()
+	defer instance2.Close()
+
+	table := []struct {
+		name        string
+		client      *Client
+		secret      string
+		expectError bool
+	}{
+		{"tenant", instance1, "secret-tenant", false},
+		{"wrong secret", instance1, "wrong", true},
+		{"wrong secret other instance", instance2, "wrong", true},
+		{"tenant cached other instance", instance2, "secret-tenant", false},
+		{"tenant cached", instance1, "secret-tenant", false},
+	}
+
+	for _, data := range table {
+		tok, errTok := data.client.WithCredentials("tenant", data.secret).Token(context.TODO())
+		if data.expectError {
+			var errStatus *StatusError
+			if !errors.As(errTok, &errStatus) || errStatus.StatusCode != http.StatusUnauthorized {
+				t.Errorf("%s: expected token server 401, got token=%v error: %v", data.name, tok.AccessToken, errTok)
+			}
+			continue
+		}
+		if errTok != nil {
+			t.Errorf("%s: token: %v", data.name, errTok)
+			continue
+		}
+		if tok.AccessToken != "tenant" {
+			t.Errorf("%s: unexpected token: %s", data.name, tok.AccessToken)
+		}
+	}
+
+	// wrong secrets neither hit the cache nor evict the cached token
+	expect := "tenant,tenant,tenant"
+	if got := strings.Join(fetches, ","); got != expect {
+		t.Errorf("expected fetches %s, got %s", expect, got)
+	}
+}
+
+func TestContextWithCredentialsWrongSecret(t *testing.T) {
+
+	var fetches []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		clientID := formParam(r, "client_id")
+		fetches = append(fetches, clientID+":"+formParam(r, "client_secret"))
+		if formParam(r, "client_secret") != "secret-"+clientID {
+			httpJSON(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		httpJSON(w, `{"access_token":"`+clientID+`","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	srv := newServer(&serverStat{}, func(string) bool { return true })
+	defer srv.Close()
+
+	root := New(Options{
+		TokenURL:            ts.URL,
+		ClientID:            "root",
+		ClientSecret:        "secret-root",
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+	defer root.Close()
+
+	good := ContextWithCredentials(context.TODO(), "tenant", "secret-tenant")
+	if _, errToken := root.Token(good); errToken != nil {
+		t.Fatalf("token: %v", errToken)
+	}
+
+	wrong := ContextWithCredentials(context.TODO(), "tenant", "wrong")
+
+	_, errToken := root.Token(wrong)
+	var errStatus *StatusError
+	if !errors.As(errToken, &errStatus) || errStatus.StatusCode != http.StatusUnauthorized {
+		t.Errorf("token: expected token server 401, got: %v", errToken)
+	}
+
+	req, errReq := http.NewRequestWithContext(wrong, "GET", srv.URL, nil)
+	if errReq != nil {
+		t.Fatalf("request: %v", errReq)
+	}
+	if _, errDo := root.Do(req); !errors.As(errDo, &errStatus) || errStatus.StatusCode != http.StatusUnauthorized {
+		t.Errorf("do: expected token server 401, got: %v", errDo)
+	}
+
+	// the cached tenant token survives the wrong secret
+	if _, errToken := root.Token(good); errToken != nil {
+		t.Errorf("token: %v", errToken)
+	}
+
+	expect := "tenant:secret-tenant,tenant:wrong,tenant:wrong"
+	if got := strings.Join(fetches, ","); got != expect {
+		t.Errorf("expected fetches %s, got %s", expect, got)
+	}
+}
+
+func TestDerivedClientsShareLocalCache(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		httpJSON(w, `{"access_token":"token-`+formParam(r, "client_id")+`","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	root := New(Options{
+		TokenURL:            ts.URL,
+		ClientID:            "root",
+		ClientSecret:        "secret",
+		LocalCache:          true,
+		MaxIdentities:       1,
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+	defer root.Close()
+
+	var keys []string
+
+	for i := range 2 {
+		tenant := root.WithCredentials(fmt.Sprintf("tenant%d", i), "secret")
+		if _, errTok := tenant.Token(context.TODO()); errTok != nil {
+			t.Fatalf("tenant%d: token: %v", i, errTok)
+		}
+		keys = append(keys, tenant.cacheKey())
+	}
+
+	// tenant0 evicted by tenant1, see MaxIdentities
+
+	if _, found := root.local.Load(keys[0]); found {
+		t.Errorf("expected evicted tenant removed from local cache")
+	}
+	if _, found := root.decoded.Load(keys[0]); found {
+		t.Errorf("expected evicted tenant removed from decoded cache")
+	}
+	if _, found := root.local.Load(keys[1]); !found {
+		t.Errorf("expected tenant in local cache shared with root")
+	}
+	if _, found := root.decoded.Load(keys[1]); !found {
+		t.Errorf("expected tenant in decoded cache shared with root")
+	}
+}
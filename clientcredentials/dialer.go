@@ -0,0 +1,37 @@
+package clientcredentials
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+// needCustomTransport reports whether options require an internally
+// constructed transport instead of http.DefaultClient.
+func needCustomTransport(options Options) bool {
+	return options.DialTimeout != 0 ||
+		options.DialResolver != nil ||
+		options.DialNetwork != "" ||
+		options.DialFallbackDelay != 0
+}
+
+// newHTTPClient builds an HTTP client whose dialer honors the Dial* options.
+func newHTTPClient(options Options) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:       options.DialTimeout,
+		Resolver:      options.DialResolver,
+		FallbackDelay: options.DialFallbackDelay,
+	}
+
+	network := options.DialNetwork
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, defaultNetwork, addr string) (net.Conn, error) {
+		if network == "" {
+			return dialer.DialContext(ctx, defaultNetwork, addr)
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	return &http.Client{Transport: transport}
+}
@@ -0,0 +1,83 @@
+package clientcredentials
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+func TestDialNetwork(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "abc"
+	expireIn := 60
+
+	tokenServerStat := serverStat{}
+	serverStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, token, expireIn)
+	defer ts.Close()
+
+	validToken := func(t string) bool { return t == token }
+
+	srv := newServer(&serverStat, validToken)
+	defer srv.Close()
+
+	options := Options{
+		TokenURL:            ts.URL,
+		ClientID:            clientID,
+		ClientSecret:        clientSecret,
+		DialTimeout:         5 * time.Second,
+		DialNetwork:         "tcp4",
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	}
+
+	client := New(options)
+
+	if client.options.HTTPClient == http.DefaultClient {
+		t.Errorf("expected internally constructed http client")
+	}
+
+	_, errSend := send(client, srv.URL)
+	if errSend != nil {
+		t.Errorf("send: %v", errSend)
+	}
+	if tokenServerStat.count != 1 {
+		t.Errorf("unexpected token server access count: %d", tokenServerStat.count)
+	}
+}
+
+func TestDialNetworkMismatch(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "abc"
+	expireIn := 60
+
+	tokenServerStat := serverStat{}
+
+	// httptest listens on 127.0.0.1, unreachable over tcp6
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, token, expireIn)
+	defer ts.Close()
+
+	options := Options{
+		TokenURL:            ts.URL,
+		ClientID:            clientID,
+		ClientSecret:        clientSecret,
+		DialNetwork:         "tcp6",
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	}
+
+	client := New(options)
+
+	_, errSend := send(client, "http://localhost")
+	if errSend == nil {
+		t.Errorf("unexpected success dialing ipv4 address over tcp6")
+	}
+	if tokenServerStat.count != 0 {
+		t.Errorf("unexpected token server access count: %d", tokenServerStat.count)
+	}
+}
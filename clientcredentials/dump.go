@@ -0,0 +1,93 @@
+package clientcredentials
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+// dumpSecretHeaders lists headers masked in token exchange dumps.
+var dumpSecretHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// dumpSecretFields lists token request form fields masked in token
+// exchange dumps.
+var dumpSecretFields = []string{"client_secret", "assertion", "client_assertion", "password"}
+
+// dumpTokenRequest logs the token request with Options.DumpTokenExchange.
+func (c *Client) dumpTokenRequest(ctx context.Context, req *http.Request) {
+	if !c.options.DumpTokenExchange {
+		return
+	}
+	dump, errDump := httputil.DumpRequestOut(req, true)
+	if errDump != nil {
+		c.errorfCtx(ctx, "dump token request: %v", errDump)
+		return
+	}
+	head, body, _ := bytes.Cut(dump, []byte("\r\n\r\n"))
+	c.logf(ctx, slog.LevelDebug, "token request dump:\n%s\r\n\r\n%s",
+		maskDumpHeader(head), maskDumpForm(body))
+}
+
+// dumpTokenResponse logs the token response with Options.DumpTokenExchange.
+// Secret fields are redacted from the body unless Options.UnsafeDebugSecrets.
+func (c *Client) dumpTokenResponse(ctx context.Context, resp *http.Response, body []byte) {
+	if !c.options.DumpTokenExchange {
+		return
+	}
+	dump, errDump := httputil.DumpResponse(resp, false)
+	if errDump != nil {
+		c.errorfCtx(ctx, "dump token response: %v", errDump)
+		return
+	}
+	head, _, _ := bytes.Cut(dump, []byte("\r\n\r\n"))
+	c.logf(ctx, slog.LevelDebug, "token response dump:\n%s\r\n\r\n%s",
+		maskDumpHeader(head), c.debugTokenBody(resp.StatusCode, body))
+}
+
+// maskDumpHeader masks the values of secret headers in a dump,
+// keeping the authorization scheme.
+func maskDumpHeader(head []byte) string {
+	lines := strings.Split(string(head), "\r\n")
+	for i, line := range lines {
+		name, value, found := strings.Cut(line, ":")
+		if !found || !isDumpSecretHeader(name) {
+			continue
+		}
+		if scheme, _, hasScheme := strings.Cut(strings.TrimSpace(value), " "); hasScheme &&
+			strings.HasSuffix(http.CanonicalHeaderKey(name), "Authorization") {
+			lines[i] = name + ": " + scheme + " " + redacted
+			continue
+		}
+		lines[i] = name + ": " + redacted
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+func isDumpSecretHeader(name string) bool {
+	name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+	for _, h := range dumpSecretHeaders {
+		if name == h {
+			return true
+		}
+	}
+	return false
+}
+
+// maskDumpForm masks secret fields in a form-encoded request body.
+// Bodies that fail to parse are masked entirely.
+func maskDumpForm(body []byte) string {
+	form, errForm := url.ParseQuery(string(body))
+	if errForm != nil {
+		return redacted
+	}
+	for _, f := range dumpSecretFields {
+		if form.Has(f) {
+			form.Set(f, redacted)
+		}
+	}
+	return form.Encode()
+}
@@ -0,0 +1,92 @@
+package clientcredentials
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+func TestDumpTokenExchange(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "secret-access-token"
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		id, secret, ok := r.BasicAuth()
+		if !ok {
+			id, secret = formParam(r, "client_id"), formParam(r, "client_secret")
+		}
+		if id != clientID || secret != clientSecret {
+			httpJSON(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		httpJSON(w, `{"access_token":"`+token+`","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	srv := newServer(&serverStat{}, func(t string) bool { return t == token })
+	defer srv.Close()
+
+	table := []struct {
+		name       string
+		basic      bool
+		unsafe     bool
+		expectDump []string
+	}{
+		{"form", false, false, []string{"client_secret=" + redacted, `"access_token":"` + redacted + `"`}},
+		{"basic", true, false, []string{"Authorization: Basic " + redacted, `"access_token":"` + redacted + `"`}},
+		{"unsafe", false, true, []string{"client_secret=" + redacted, `"access_token":"` + token + `"`}},
+	}
+
+	for _, data := range table {
+		var out strings.Builder
+		client := New(Options{
+			TokenURL:            ts.URL,
+			ClientID:            clientID,
+			ClientSecret:        clientSecret,
+			ClientAuthBasic:     data.basic,
+			DumpTokenExchange:   true,
+			UnsafeDebugSecrets:  data.unsafe,
+			Logf:                func(format string, v ...any) { fmt.Fprintf(&out, format+"\n", v...) },
+			GroupcacheWorkspace: groupcache.NewWorkspace(),
+		})
+		if _, errSend := send(client, srv.URL); errSend != nil {
+			t.Errorf("%s: send: %v", data.name, errSend)
+		}
+		client.Close()
+
+		logs := out.String()
+		expect := append([]string{
+			"token request dump:\nPOST / HTTP/1.1\r\n",
+			"grant_type=client_credentials",
+			"token response dump:\nHTTP/1.1 200 OK\r\n",
+			"Content-Type: application/json",
+		}, data.expectDump...)
+		for _, e := range expect {
+			if !strings.Contains(logs, e) {
+				t.Errorf("%s: missing %q in dump: %s", data.name, e, logs)
+			}
+		}
+		if strings.Contains(logs, clientSecret) {
+			t.Errorf("%s: client secret leaked: %s", data.name, logs)
+		}
+		if !data.unsafe && strings.Contains(logs, token) {
+			t.Errorf("%s: access token leaked: %s", data.name, logs)
+		}
+	}
+}
+
+func TestMaskDumpHeader(t *testing.T) {
+	head := "POST /token HTTP/1.1\r\nHost: idp\r\nauthorization: Bearer abc\r\nCookie: s=1\r\nX-Other: keep"
+	expect := "POST /token HTTP/1.1\r\nHost: idp\r\nauthorization: Bearer " + redacted +
+		"\r\nCookie: " + redacted + "\r\nX-Other: keep"
+	if got := maskDumpHeader([]byte(head)); got != expect {
+		t.Errorf("expected %q, got %q", expect, got)
+	}
+}
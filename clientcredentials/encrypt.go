@@ -0,0 +1,55 @@
+package clientcredentials
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// newCacheCipher creates the AES-GCM cipher for Options.CacheEncryptionKey.
+func newCacheCipher(key []byte) (cipher.AEAD, error) {
+	block, errCipher := aes.NewCipher(key)
+	if errCipher != nil {
+		return nil, fmt.Errorf("cache encryption key: %v", errCipher)
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealValue encrypts the cached value when encryption is enabled.
+// The result is base64-encoded nonce followed by ciphertext.
+// The cache key is authenticated as additional data, so a value
+// copied under another key fails to decrypt.
+func (c *Client) sealValue(key, plain string) (string, error) {
+	if c.aead == nil {
+		return plain, nil
+	}
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(plain)+c.aead.Overhead())
+	if _, errRand := rand.Read(nonce); errRand != nil {
+		return "", errRand
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(plain), []byte(key))
+	return base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// openValue decrypts the cached value for key when encryption is enabled.
+func (c *Client) openValue(key, value string) (string, error) {
+	if c.aead == nil {
+		return value, nil
+	}
+	sealed, errDecode := base64.RawStdEncoding.DecodeString(value)
+	if errDecode != nil {
+		return "", fmt.Errorf("decrypt cached token: %v", errDecode)
+	}
+	n := c.aead.NonceSize()
+	if len(sealed) < n {
+		return "", errors.New("decrypt cached token: short value")
+	}
+	plain, errOpen := c.aead.Open(nil, sealed[:n], sealed[n:], []byte(key))
+	if errOpen != nil {
+		return "", fmt.Errorf("decrypt cached token: %v", errOpen)
+	}
+	return string(plain), nil
+}
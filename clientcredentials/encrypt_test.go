@@ -0,0 +1,104 @@
+package clientcredentials
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCacheEncryption(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "secret-token"
+	expireIn := 60
+
+	tokenServerStat := serverStat{}
+	serverStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, token, expireIn)
+	defer ts.Close()
+
+	srv := newServer(&serverStat, func(t string) bool { return t == token })
+	defer srv.Close()
+
+	cache := NewMemoryTokenCache()
+
+	newEncryptedClient := func(key []byte) *Client {
+		return New(Options{
+			TokenURL:           ts.URL,
+			ClientID:           clientID,
+			ClientSecret:       clientSecret,
+			TokenCache:         cache,
+			CacheEncryptionKey: key,
+		})
+	}
+
+	key := bytes.Repeat([]byte{1}, 32)
+
+	client := newEncryptedClient(key)
+
+	for i := range 2 {
+		if _, errSend := send(client, srv.URL); errSend != nil {
+			t.Errorf("send %d: %v", i, errSend)
+		}
+	}
+	if tokenServerStat.count != 1 {
+		t.Errorf("unexpected token server access count: %d", tokenServerStat.count)
+	}
+
+	for _, e := range cache.entries {
+		if strings.Contains(e.value, token) {
+			t.Errorf("plaintext token in cache: %s", e.value)
+		}
+	}
+
+	// wrong key cannot read cached token
+
+	wrong := newEncryptedClient(bytes.Repeat([]byte{2}, 32))
+	if _, errSend := send(wrong, srv.URL); errSend == nil {
+		t.Errorf("wrong key: unexpected success")
+	}
+}
+
+func TestCacheEncryptionSwappedValue(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		httpJSON(w, `{"access_token":"token-`+formParam(r, "client_id")+`","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	cache := NewMemoryTokenCache()
+
+	root := New(Options{
+		TokenURL:           ts.URL,
+		ClientID:           "root",
+		ClientSecret:       "secret",
+		TokenCache:         cache,
+		CacheEncryptionKey: bytes.Repeat([]byte{1}, 32),
+	})
+	defer root.Close()
+
+	tenant1 := root.WithCredentials("tenant1", "secret")
+	tenant2 := root.WithCredentials("tenant2", "secret")
+
+	for _, c := range []*Client{tenant1, tenant2} {
+		if _, errTok := c.Token(context.TODO()); errTok != nil {
+			t.Fatalf("token: %v", errTok)
+		}
+	}
+
+	// ciphertext of tenant1 copied under the key of tenant2
+	cache.mutex.Lock()
+	cache.entries[tenant2.cacheKey()] = cache.entries[tenant1.cacheKey()]
+	cache.mutex.Unlock()
+
+	tok, errTok := tenant2.Token(context.TODO())
+	if errTok == nil {
+		t.Errorf("swapped value: unexpected token: %s", tok.AccessToken)
+	}
+}
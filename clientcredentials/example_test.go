@@ -0,0 +1,110 @@
+package clientcredentials_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/modernprogram/groupcache/v2"
+	"github.com/udhos/groupcache_oauth2/clientcredentials"
+)
+
+// newExampleServers starts a fake token server and a target server
+// accepting only the token issued by the token server.
+func newExampleServers() (tokenServer, targetServer *httptest.Server) {
+	tokenServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"abc","token_type":"Bearer","expires_in":300}`)
+	}))
+	targetServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer abc" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("X-Request-Id", "req-1")
+		fmt.Fprint(w, "hello")
+	}))
+	return
+}
+
+func ExampleNew() {
+	tokenServer, targetServer := newExampleServers()
+	defer tokenServer.Close()
+	defer targetServer.Close()
+
+	client := clientcredentials.New(clientcredentials.Options{
+		TokenURL:            tokenServer.URL,
+		ClientID:            "client-id",
+		ClientSecret:        "client-secret",
+		Scope:               "scope1 scope2",
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+
+	req, errReq := http.NewRequest("GET", targetServer.URL, nil)
+	if errReq != nil {
+		fmt.Println(errReq)
+		return
+	}
+
+	resp, errDo := client.Do(req)
+	if errDo != nil {
+		fmt.Println(errDo)
+		return
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	fmt.Println(resp.StatusCode, string(body))
+
+	// Output:
+	// 200 hello
+}
+
+func ExampleClient_DoWithOutput() {
+	tokenServer, targetServer := newExampleServers()
+	defer tokenServer.Close()
+	defer targetServer.Close()
+
+	client := clientcredentials.New(clientcredentials.Options{
+		TokenURL:            tokenServer.URL,
+		ClientID:            "client-id",
+		ClientSecret:        "client-secret",
+		OutputHeaders:       []string{"X-Request-Id"},
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+
+	req, errReq := http.NewRequest("GET", targetServer.URL, nil)
+	if errReq != nil {
+		fmt.Println(errReq)
+		return
+	}
+
+	out, errDo := client.DoWithOutput(req, clientcredentials.WithTrace())
+	if errDo != nil {
+		fmt.Println(errDo)
+		return
+	}
+	defer out.Response.Body.Close()
+
+	fmt.Println("request id:", out.Headers.Get("X-Request-Id"))
+	for _, e := range out.Trace {
+		fmt.Println("trace:", e.Step)
+	}
+
+	// Output:
+	// request id: req-1
+	// trace: cache_get
+	// trace: token_fetch
+}
+
+func ExampleNewAzureAD() {
+	client := clientcredentials.NewAzureAD("my-tenant-id", clientcredentials.Options{
+		ClientID:            "client-id",
+		ClientSecret:        "client-secret",
+		Audience:            "api://my-api", // sent as scope=api://my-api/.default
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+
+	_ = client // use client.Do as with New
+}
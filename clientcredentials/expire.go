@@ -0,0 +1,69 @@
+package clientcredentials
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseExpiresOn parses the expires_on field as an absolute unix time,
+// either a number or a string, as sent by Azure AD v1.
+func parseExpiresOn(expiresOn any) (time.Time, error) {
+	switch v := expiresOn.(type) {
+	case float64:
+		return time.Unix(int64(v), 0), nil
+	case string:
+		sec, errConv := strconv.ParseInt(v, 10, 64)
+		if errConv != nil {
+			return time.Time{}, fmt.Errorf("error converting expires_on field from string='%s' to int: %v", v, errConv)
+		}
+		return time.Unix(sec, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("unexpected type %T for expires_on field in token response", expiresOn)
+}
+
+// jwtClaims holds the JWT claims used by the client.
+type jwtClaims struct {
+	Exp *float64 `json:"exp"`
+	Iat *float64 `json:"iat"`
+	Jti string   `json:"jti"`
+}
+
+// parseJWTClaims decodes JWT claims without verifying the signature.
+// Claims are only informative: they schedule renewal and are reported
+// to the caller, never used for authorization.
+func parseJWTClaims(accessToken string) (jwtClaims, error) {
+	var claims jwtClaims
+
+	parts := strings.Split(accessToken, ".")
+	if len(parts) != 3 {
+		return claims, fmt.Errorf("access token is not a jwt")
+	}
+
+	payload, errDecode := base64.RawURLEncoding.DecodeString(parts[1])
+	if errDecode != nil {
+		return claims, fmt.Errorf("jwt payload: %v", errDecode)
+	}
+
+	if errJSON := json.Unmarshal(payload, &claims); errJSON != nil {
+		return claims, fmt.Errorf("jwt claims: %v", errJSON)
+	}
+
+	return claims, nil
+}
+
+// jwtExpire extracts the exp claim from a JWT.
+func jwtExpire(accessToken string) (time.Time, error) {
+	claims, errClaims := parseJWTClaims(accessToken)
+	if errClaims != nil {
+		return time.Time{}, errClaims
+	}
+	if claims.Exp == nil {
+		return time.Time{}, fmt.Errorf("missing jwt exp claim")
+	}
+
+	return time.Unix(int64(*claims.Exp), 0), nil
+}
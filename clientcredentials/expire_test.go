@@ -0,0 +1,157 @@
+package clientcredentials
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+func TestParseTokenExpiresOn(t *testing.T) {
+
+	on := time.Now().Add(time.Hour).Unix()
+
+	table := []struct {
+		name  string
+		token string
+	}{
+		{"expires_on number", fmt.Sprintf(`{"access_token":"abc","expires_on":%d}`, on)},
+		{"expires_on string", fmt.Sprintf(`{"access_token":"abc","expires_on":"%d"}`, on)},
+	}
+
+	for _, data := range table {
+		info, errParse := parseToken([]byte(data.token), t.Logf)
+		if errParse != nil {
+			t.Errorf("%s: %v", data.name, errParse)
+			continue
+		}
+		if info.ExpiresIn < 59*time.Minute || info.ExpiresIn > time.Hour {
+			t.Errorf("%s: unexpected expire: %v", data.name, info.ExpiresIn)
+		}
+	}
+
+	if _, errParse := parseToken([]byte(`{"access_token":"abc","expires_on":"TTT"}`), t.Logf); errParse == nil {
+		t.Errorf("expires_on broken string: unexpected success")
+	}
+
+	past := fmt.Sprintf(`{"access_token":"abc","expires_on":%d}`, time.Now().Add(-time.Hour).Unix())
+	if _, errParse := parseToken([]byte(past), t.Logf); errParse == nil {
+		t.Errorf("expires_on in the past: unexpected success")
+	}
+}
+
+func TestExpireFromJWTExpired(t *testing.T) {
+
+	jwt := func(exp time.Time) string {
+		payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"x","exp":%d}`, exp.Unix())))
+		return "header." + payload + ".signature"
+	}
+
+	table := []struct {
+		name      string
+		response  string
+		expectErr bool
+	}{
+		{"jwt valid", `{"access_token":"` + jwt(time.Now().Add(time.Hour)) + `"}`, false},
+		{"jwt expired", `{"access_token":"` + jwt(time.Now().Add(-time.Hour)) + `"}`, true},
+		{"jwt skewed", `{"access_token":"` + jwt(time.Now().Add(-time.Second)) + `"}`, true},
+		{"negative expires_in", `{"access_token":"abc","expires_in":-60}`, true},
+	}
+
+	for _, data := range table {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			httpJSON(w, data.response, http.StatusOK)
+		}))
+
+		client := New(Options{
+			TokenURL:            ts.URL,
+			ClientID:            "clientID",
+			ClientSecret:        "clientSecret",
+			ExpireFromJWT:       true,
+			GroupcacheWorkspace: groupcache.NewWorkspace(),
+		})
+
+		tok, errTok := client.Token(context.TODO())
+		client.Close()
+		ts.Close()
+
+		if data.expectErr {
+			if errTok == nil {
+				t.Errorf("%s: unexpected success: expire=%v", data.name, tok.Expire)
+			}
+			continue
+		}
+		if errTok != nil {
+			t.Errorf("%s: token: %v", data.name, errTok)
+			continue
+		}
+		if lifetime := time.Until(tok.Expire); lifetime <= 0 || lifetime > time.Hour {
+			t.Errorf("%s: unexpected expire: %v", data.name, tok.Expire)
+		}
+	}
+}
+
+func TestJWTExpire(t *testing.T) {
+
+	exp := time.Now().Add(time.Hour).Unix()
+
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"x","exp":%d}`, exp)))
+
+	got, errExp := jwtExpire("header." + payload + ".signature")
+	if errExp != nil {
+		t.Fatalf("jwt exp: %v", errExp)
+	}
+	if got.Unix() != exp {
+		t.Errorf("expected exp=%d got=%d", exp, got.Unix())
+	}
+
+	if _, errExp := jwtExpire("opaque"); errExp == nil {
+		t.Errorf("opaque token: unexpected success")
+	}
+
+	noExp := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"x"}`))
+	if _, errExp := jwtExpire("header." + noExp + ".signature"); errExp == nil {
+		t.Errorf("missing exp: unexpected success")
+	}
+}
+
+func TestOutputJWTClaims(t *testing.T) {
+
+	iat := time.Now().Add(-time.Minute).Unix()
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"iat":%d,"jti":"id-1"}`, iat)))
+	token := "header." + payload + ".signature"
+
+	tokenServerStat := serverStat{}
+	serverStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, "clientID", "clientSecret", token, 60)
+	defer ts.Close()
+
+	srv := newServer(&serverStat, func(t string) bool { return t == token })
+	defer srv.Close()
+
+	client := newClient(ts.URL, "clientID", "clientSecret", 0)
+
+	req, errReq := http.NewRequestWithContext(context.TODO(), "GET", srv.URL, nil)
+	if errReq != nil {
+		t.Fatalf("request: %v", errReq)
+	}
+
+	out, errDo := client.DoWithOutput(req)
+	if errDo != nil {
+		t.Fatalf("do: %v", errDo)
+	}
+	out.Response.Body.Close()
+
+	if out.TokenIssuedAt.Unix() != iat {
+		t.Errorf("expected iat=%d got=%d", iat, out.TokenIssuedAt.Unix())
+	}
+	if out.TokenID != "id-1" {
+		t.Errorf("unexpected token id: %q", out.TokenID)
+	}
+}
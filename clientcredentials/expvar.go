@@ -0,0 +1,74 @@
+package clientcredentials
+
+import (
+	"expvar"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// publishExpvar publishes client and cache counters as an expvar map
+// named Options.ExpvarName. Since expvar variables cannot be removed,
+// a name already published is kept, and the client is not published.
+func (c *Client) publishExpvar() {
+	name := c.options.ExpvarName
+	if expvar.Get(name) != nil {
+		c.warnf("expvar %s already published, client counters not published", name)
+		return
+	}
+	expvar.Publish(name, expvar.Func(func() any { return c.expvarCounters() }))
+}
+
+// expvarCounters returns cache statistics, see Stats, and client
+// counters summed across labels.
+func (c *Client) expvarCounters() map[string]any {
+	stats := c.Stats()
+	m := c.metrics
+	return map[string]any{
+		"cache_gets":             stats.Gets,
+		"cache_hits":             stats.Hits,
+		"cache_misses":           stats.Misses,
+		"cache_fills":            stats.Fills,
+		"cache_fill_errors":      stats.FillErrors,
+		"cache_evictions":        stats.Evictions,
+		"cache_items":            stats.Items,
+		"cache_bytes":            stats.Bytes,
+		"token_fetches":          sumMetric(m.tokenFetches),
+		"token_fetch_errors":     sumMetric(m.tokenFetchErrors),
+		"token_fetch_retries":    sumMetric(m.tokenFetchRetries),
+		"token_fetch_in_flight":  sumMetric(m.tokenFetchInFlight),
+		"token_rejected":         sumMetric(m.tokenRejected),
+		"token_waiting":          sumMetric(m.tokenWaiting),
+		"stale_token_served":     sumMetric(m.staleTokenServed),
+		"stale_while_revalidate": sumMetric(m.staleWhileRevalidate),
+		"requests_in_flight":     sumMetric(m.requestsInFlight),
+		"fallbacks":              sumMetric(m.fallback),
+		"identities":             sumMetric(m.identities),
+		"identity_evictions":     sumMetric(m.identityEvictions),
+		"refresh_ahead":          sumMetric(m.refreshAhead),
+		"consistency_checks":     sumMetric(m.consistency),
+	}
+}
+
+// sumMetric sums counter or gauge values across labels.
+func sumMetric(collector prometheus.Collector) float64 {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		collector.Collect(ch)
+		close(ch)
+	}()
+	var sum float64
+	for metric := range ch {
+		var d dto.Metric
+		if metric.Write(&d) != nil {
+			continue
+		}
+		switch {
+		case d.Counter != nil:
+			sum += d.Counter.GetValue()
+		case d.Gauge != nil:
+			sum += d.Gauge.GetValue()
+		}
+	}
+	return sum
+}
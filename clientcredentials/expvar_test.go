@@ -0,0 +1,75 @@
+package clientcredentials
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+func TestExpvar(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "abc"
+
+	ts := newTokenServer(&serverStat{}, clientID, clientSecret, token, 60)
+	defer ts.Close()
+
+	srv := newServer(&serverStat{}, func(t string) bool { return t == token })
+	defer srv.Close()
+
+	client := New(Options{
+		TokenURL:            ts.URL,
+		ClientID:            clientID,
+		ClientSecret:        clientSecret,
+		ExpvarName:          "test_oauth2_client",
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+	defer client.Close()
+
+	// a duplicate name is not published again
+	other := New(Options{
+		TokenURL:            ts.URL,
+		ClientID:            clientID,
+		ClientSecret:        clientSecret,
+		ExpvarName:          "test_oauth2_client",
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+	defer other.Close()
+
+	for i := range 3 {
+		if _, errSend := send(client, srv.URL); errSend != nil {
+			t.Fatalf("send %d: %v", i, errSend)
+		}
+	}
+
+	v := expvar.Get("test_oauth2_client")
+	if v == nil {
+		t.Fatalf("expvar not published")
+	}
+
+	var counters map[string]float64
+	if errJSON := json.Unmarshal([]byte(v.String()), &counters); errJSON != nil {
+		t.Fatalf("expvar json: %v: %s", errJSON, v.String())
+	}
+
+	table := []struct {
+		name   string
+		expect float64
+	}{
+		{"cache_gets", 3},
+		{"cache_fills", 1},
+		{"cache_items", 1},
+		{"token_fetches", 1},
+		{"token_fetch_errors", 0},
+		{"requests_in_flight", 0},
+	}
+
+	for _, data := range table {
+		if got := counters[data.name]; got != data.expect {
+			t.Errorf("%s: expected %v, got %v", data.name, data.expect, got)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package clientcredentials
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+)
+
+// tokenEndpoints tracks the token endpoint currently in use, with
+// Options.TokenURLs. It is shared by a root client and its derived clients.
+type tokenEndpoints struct {
+	urls    []string
+	current atomic.Int32 // index of the last endpoint that answered
+}
+
+// newTokenEndpoints returns nil if there are no alternate endpoints.
+func newTokenEndpoints(primary string, alternates []string) *tokenEndpoints {
+	if len(alternates) == 0 {
+		return nil
+	}
+	urls := append([]string{primary}, alternates...)
+	return &tokenEndpoints{urls: urls}
+}
+
+// requestTokenEndpoints performs a token request. With Options.TokenURLs, endpoints
+// failing with transient errors are skipped, starting from the endpoint
+// that answered last, so a failed primary is not retried on every fetch.
+func (c *Client) requestTokenEndpoints(ctx context.Context, clientSecret string) (TokenInfo, TokenResponse, error) {
+	e := c.endpoints
+	if e == nil {
+		return c.requestTokenURL(ctx, c.options.TokenURL, clientSecret)
+	}
+
+	start := int(e.current.Load())
+	n := len(e.urls)
+
+	for i := 0; ; i++ {
+		idx := (start + i) % n
+		ti, tr, errTok := c.requestTokenURL(ctx, e.urls[idx], clientSecret)
+		if errTok == nil {
+			if idx != start {
+				c.logEvent(ctx, slog.LevelInfo, "token_endpoint_failover", "token endpoint failover",
+					slog.String("endpoint", e.urls[idx]))
+				e.current.Store(int32(idx))
+			}
+			return ti, tr, nil
+		}
+		if i == n-1 || !isTransient(ctx, errTok) {
+			return ti, tr, errTok
+		}
+		c.warnfCtx(ctx, "token endpoint %s failed, trying next: %v", e.urls[idx], errTok)
+		c.fallback(FallbackTokenURL, c.cacheKey(), errTok)
+	}
+}
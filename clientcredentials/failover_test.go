@@ -0,0 +1,177 @@
+package clientcredentials
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/modernprogram/groupcache/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTokenURLs(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+
+	primaryStat := serverStat{}
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		primaryStat.inc()
+		httpJSON(w, `{"error":"unavailable"}`, http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+
+	// unreachable endpoint
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	secondaryStat := serverStat{}
+	secondary := newTokenServer(&secondaryStat, clientID, clientSecret, "abc", 60)
+	defer secondary.Close()
+
+	// the server rejects every token, forcing fetches
+	serverStat := serverStat{}
+	srv := newServer(&serverStat, func(string) bool { return false })
+	defer srv.Close()
+
+	client := New(Options{
+		TokenURL:            primary.URL,
+		TokenURLs:           []string{down.URL, secondary.URL},
+		ClientID:            clientID,
+		ClientSecret:        clientSecret,
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+
+	for range 3 {
+		send(client, srv.URL) // rejected by server
+	}
+
+	if serverStat.count != 3 {
+		t.Errorf("expected 3 server requests, got %d", serverStat.count)
+	}
+	if primaryStat.count != 1 {
+		t.Errorf("expected 1 primary request, got %d", primaryStat.count)
+	}
+	if secondaryStat.count != 3 {
+		t.Errorf("expected 3 secondary requests, got %d", secondaryStat.count)
+	}
+
+	// primary and down endpoints skipped on first fetch only
+	count := testutil.ToFloat64(client.metrics.fallback.WithLabelValues(FallbackTokenURL))
+	if count != 2 {
+		t.Errorf("unexpected fallback token url metric: %v", count)
+	}
+}
+
+func TestTokenURLsRateLimit(t *testing.T) {
+
+	primaryStat := serverStat{}
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		primaryStat.inc()
+		httpJSON(w, `{"error":"unavailable"}`, http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+
+	secondaryStat := serverStat{}
+	secondary := newTokenServer(&secondaryStat, "clientID", "clientSecret", "abc", 60)
+	defer secondary.Close()
+
+	var events []FallbackEvent
+
+	client := New(Options{
+		TokenURL:            primary.URL,
+		TokenURLs:           []string{secondary.URL},
+		ClientID:            "clientID",
+		ClientSecret:        "clientSecret",
+		TokenFetchRateLimit: 1,
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+		OnFallback: func(event FallbackEvent) {
+			events = append(events, event)
+		},
+	})
+	defer client.Close()
+
+	// the failover is a second token request, beyond the limit
+	_, errToken := client.Token(context.TODO())
+
+	var rateErr *RateLimitError
+	if !errors.As(errToken, &rateErr) {
+		t.Errorf("expected RateLimitError, got: %v", errToken)
+	}
+	if primaryStat.count != 1 {
+		t.Errorf("expected 1 primary request, got %d", primaryStat.count)
+	}
+	if secondaryStat.count != 0 {
+		t.Errorf("expected no secondary requests, got %d", secondaryStat.count)
+	}
+	if len(events) != 1 || events[0].Reason != FallbackTokenURL {
+		t.Errorf("expected fallback token url event, got: %v", events)
+	}
+}
+
+func TestTokenURLsNotTransient(t *testing.T) {
+
+	primaryStat := serverStat{}
+	primary := newTokenServer(&primaryStat, "other", "other", "abc", 60)
+	defer primary.Close()
+
+	secondaryStat := serverStat{}
+	secondary := newTokenServer(&secondaryStat, "clientID", "clientSecret", "abc", 60)
+	defer secondary.Close()
+
+	serverStat := serverStat{}
+	srv := newServer(&serverStat, func(t string) bool { return t == "abc" })
+	defer srv.Close()
+
+	client := New(Options{
+		TokenURL:            primary.URL,
+		TokenURLs:           []string{secondary.URL},
+		ClientID:            "clientID",
+		ClientSecret:        "clientSecret",
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+
+	// credentials rejected by the primary are not tried elsewhere
+	if _, errSend := send(client, srv.URL); errSend == nil {
+		t.Errorf("expected error")
+	}
+
+	if primaryStat.count != 1 {
+		t.Errorf("expected 1 primary request, got %d", primaryStat.count)
+	}
+	if secondaryStat.count != 0 {
+		t.Errorf("expected no secondary requests, got %d", secondaryStat.count)
+	}
+}
+
+func TestTokenURLsConcurrent(t *testing.T) {
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		httpJSON(w, `{"error":"unavailable"}`, http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+
+	secondary := newTokenServer(&serverStat{}, "clientID", "clientSecret", "abc", 60)
+	defer secondary.Close()
+
+	// the server rejects every token, forcing fetches
+	srv := newServer(&serverStat{}, func(string) bool { return false })
+	defer srv.Close()
+
+	client := New(Options{
+		TokenURL:            primary.URL,
+		TokenURLs:           []string{secondary.URL},
+		ClientID:            "clientID",
+		ClientSecret:        "clientSecret",
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+	defer client.Close()
+
+	for _, status := range doConcurrent(t, client, srv.URL) {
+		if status != http.StatusUnauthorized {
+			t.Errorf("unexpected status: %d", status)
+		}
+	}
+}
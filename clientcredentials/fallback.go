@@ -0,0 +1,54 @@
+package clientcredentials
+
+// Fallback reasons reported by Options.OnFallback and the
+// groupcache_oauth2_fallback_total metric.
+const (
+	// FallbackStaleToken reports a hard-expired token was served
+	// during a token server outage. See Options.StaleTokenGracePeriod.
+	FallbackStaleToken = "stale_token"
+
+	// FallbackStaleWhileRevalidate reports a cache-expired token was served
+	// while renewed in background. See Options.StaleWhileRevalidate.
+	FallbackStaleWhileRevalidate = "stale_while_revalidate"
+
+	// FallbackRefreshAheadFailure reports a background renewal failed,
+	// the current token is kept until hard expiration.
+	// See Options.RefreshAhead.
+	FallbackRefreshAheadFailure = "refresh_ahead_failure"
+
+	// FallbackShortLifetime reports a token with lifetime shorter than
+	// the soft expire period, cached for half its lifetime.
+	FallbackShortLifetime = "short_lifetime"
+
+	// FallbackIntrospectionFailure reports the introspection endpoint
+	// failed, the token state is unknown. See Options.IntrospectionURL.
+	FallbackIntrospectionFailure = "introspection_failure"
+
+	// FallbackSecret reports the client secret in use was rejected,
+	// the next secret is tried. See Options.FallbackClientSecrets.
+	FallbackSecret = "secret"
+
+	// FallbackTokenURL reports the token endpoint in use failed,
+	// the next endpoint is tried. See Options.TokenURLs.
+	FallbackTokenURL = "token_url"
+)
+
+// FallbackEvent describes a degraded operation.
+type FallbackEvent struct {
+	// Reason is one of the Fallback* constants.
+	Reason string
+
+	// Key is the cache key.
+	Key string
+
+	// Err is the error that triggered the fallback, if any.
+	Err error
+}
+
+// fallback records a degraded operation.
+func (c *Client) fallback(reason, key string, err error) {
+	c.metrics.fallback.WithLabelValues(reason).Inc()
+	if c.options.OnFallback != nil {
+		c.options.OnFallback(FallbackEvent{Reason: reason, Key: key, Err: err})
+	}
+}
@@ -0,0 +1,72 @@
+package clientcredentials
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/modernprogram/groupcache/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestFallbackStaleToken(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "abc"
+
+	tokenServerStat := serverStat{}
+	serverStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, token, 1)
+
+	srv := newServer(&serverStat, func(t string) bool { return t == token })
+	defer srv.Close()
+
+	var mutex sync.Mutex
+	var events []FallbackEvent
+
+	client := New(Options{
+		TokenURL:              ts.URL,
+		ClientID:              clientID,
+		ClientSecret:          clientSecret,
+		SoftExpireInSeconds:   -1,
+		StaleTokenGracePeriod: 10 * time.Second,
+		GroupcacheWorkspace:   groupcache.NewWorkspace(),
+		OnFallback: func(event FallbackEvent) {
+			mutex.Lock()
+			events = append(events, event)
+			mutex.Unlock()
+		},
+	})
+
+	if _, errSend := send(client, srv.URL); errSend != nil {
+		t.Errorf("send 1: %v", errSend)
+	}
+
+	ts.Close() // token server outage
+
+	time.Sleep(1100 * time.Millisecond) // wait hard expiration
+
+	if _, errSend := send(client, srv.URL); errSend != nil {
+		t.Errorf("send 2: expected stale token: %v", errSend)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(events) != 1 {
+		t.Fatalf("expected 1 fallback event, got %d", len(events))
+	}
+	if events[0].Reason != FallbackStaleToken {
+		t.Errorf("unexpected reason: %s", events[0].Reason)
+	}
+	if events[0].Err == nil {
+		t.Errorf("expected fallback error")
+	}
+
+	count := testutil.ToFloat64(client.metrics.fallback.WithLabelValues(FallbackStaleToken))
+	if count != 1 {
+		t.Errorf("unexpected fallback metric: %v", count)
+	}
+}
@@ -0,0 +1,97 @@
+package clientcredentials
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// fetchLimiter bounds concurrent token fetches, globally and per clientID.
+// It is shared by a root client and its derived clients.
+type fetchLimiter struct {
+	global    chan struct{} // nil if unlimited
+	perClient int           // 0 if unlimited
+
+	mutex   sync.Mutex
+	clients map[string]*clientSlots
+}
+
+// clientSlots is the per-clientID semaphore, dropped when unused,
+// so the map does not grow with the number of distinct identities.
+type clientSlots struct {
+	sem   chan struct{}
+	users int
+}
+
+// newFetchLimiter returns nil if no limit is defined.
+func newFetchLimiter(global, perClient int) *fetchLimiter {
+	if global < 1 && perClient < 1 {
+		return nil
+	}
+	l := &fetchLimiter{
+		perClient: max(perClient, 0),
+		clients:   map[string]*clientSlots{},
+	}
+	if global > 0 {
+		l.global = make(chan struct{}, global)
+	}
+	return l
+}
+
+// acquire waits for a fetch slot for clientID.
+// The returned release function must be called when the fetch ends.
+func (l *fetchLimiter) acquire(ctx context.Context, clientID string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	var slots *clientSlots
+	if l.perClient > 0 {
+		l.mutex.Lock()
+		slots = l.clients[clientID]
+		if slots == nil {
+			slots = &clientSlots{sem: make(chan struct{}, l.perClient)}
+			l.clients[clientID] = slots
+		}
+		slots.users++
+		l.mutex.Unlock()
+
+		select {
+		case slots.sem <- struct{}{}:
+		case <-ctx.Done():
+			l.leave(clientID, slots)
+			return nil, fmt.Errorf("waiting for token fetch slot: %w", ctx.Err())
+		}
+	}
+
+	if l.global != nil {
+		select {
+		case l.global <- struct{}{}:
+		case <-ctx.Done():
+			if slots != nil {
+				<-slots.sem
+				l.leave(clientID, slots)
+			}
+			return nil, fmt.Errorf("waiting for token fetch slot: %w", ctx.Err())
+		}
+	}
+
+	return func() {
+		if l.global != nil {
+			<-l.global
+		}
+		if slots != nil {
+			<-slots.sem
+			l.leave(clientID, slots)
+		}
+	}, nil
+}
+
+func (l *fetchLimiter) leave(clientID string, slots *clientSlots) {
+	l.mutex.Lock()
+	slots.users--
+	if slots.users == 0 {
+		delete(l.clients, clientID)
+	}
+	l.mutex.Unlock()
+}
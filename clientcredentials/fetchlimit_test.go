@@ -0,0 +1,110 @@
+package clientcredentials
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+func TestFetchLimiter(t *testing.T) {
+
+	tryAcquire := func(l *fetchLimiter, clientID string) (func(), error) {
+		ctx, cancel := context.WithTimeout(context.TODO(), 20*time.Millisecond)
+		defer cancel()
+		return l.acquire(ctx, clientID)
+	}
+
+	table := []struct {
+		name      string
+		global    int
+		perClient int
+		second    string // clientID for second acquire
+		expectOk  bool
+	}{
+		{"unlimited", 0, 0, "a", true},
+		{"global blocks", 1, 0, "b", false},
+		{"per client other client", 0, 1, "b", true},
+		{"per client same client", 0, 1, "a", false},
+		{"global above per client", 2, 1, "b", true},
+	}
+
+	for _, data := range table {
+		l := newFetchLimiter(data.global, data.perClient)
+
+		release1, err1 := tryAcquire(l, "a")
+		if err1 != nil {
+			t.Fatalf("%s: acquire 1: %v", data.name, err1)
+		}
+
+		release2, err2 := tryAcquire(l, data.second)
+		if ok := err2 == nil; ok != data.expectOk {
+			t.Errorf("%s: second acquire: expected ok=%t, got error: %v", data.name, data.expectOk, err2)
+		}
+		if err2 == nil {
+			release2()
+		}
+
+		release1()
+
+		// released slots are reusable
+		release3, err3 := tryAcquire(l, data.second)
+		if err3 != nil {
+			t.Errorf("%s: acquire after release: %v", data.name, err3)
+		} else {
+			release3()
+		}
+
+		if l != nil && len(l.clients) != 0 {
+			t.Errorf("%s: leaked per-client slots: %d", data.name, len(l.clients))
+		}
+	}
+}
+
+func TestMaxConcurrentFetches(t *testing.T) {
+
+	var mutex sync.Mutex
+	var inFlight, maxInFlight int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		mutex.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mutex.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mutex.Lock()
+		inFlight--
+		mutex.Unlock()
+
+		httpJSON(w, `{"access_token":"abc","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	root := New(Options{
+		TokenURL:             ts.URL,
+		ClientID:             "tenant0",
+		ClientSecret:         "secret",
+		MaxConcurrentFetches: 2,
+		GroupcacheWorkspace:  groupcache.NewWorkspace(),
+	})
+
+	clients := []*Client{root}
+	for i := 1; i < 6; i++ {
+		clients = append(clients, root.WithCredentials(fmt.Sprintf("tenant%d", i), "secret"))
+	}
+
+	if errWarm := WarmUp(context.TODO(), 0, clients...); errWarm != nil {
+		t.Errorf("warm up: %v", errWarm)
+	}
+
+	if maxInFlight != 2 {
+		t.Errorf("expected at most 2 concurrent fetches, got %d", maxInFlight)
+	}
+}
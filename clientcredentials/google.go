@@ -0,0 +1,149 @@
+package clientcredentials
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// GoogleTokenURL is the Google OAuth2 token endpoint.
+const GoogleTokenURL = "https://oauth2.googleapis.com/token"
+
+// googleAssertionLifetime is the assertion lifetime, Google accepts at most one hour.
+const googleAssertionLifetime = time.Hour
+
+// GoogleServiceAccount holds the fields used from a Google service account
+// JSON key file.
+type GoogleServiceAccount struct {
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// GoogleServiceAccountFromJSON parses a Google service account JSON key file.
+func GoogleServiceAccountFromJSON(data []byte) (GoogleServiceAccount, error) {
+	var sa GoogleServiceAccount
+	if errJSON := json.Unmarshal(data, &sa); errJSON != nil {
+		return sa, fmt.Errorf("parse service account: %v", errJSON)
+	}
+	if sa.ClientEmail == "" {
+		return sa, errors.New("missing client_email in service account")
+	}
+	if sa.PrivateKey == "" {
+		return sa, errors.New("missing private_key in service account")
+	}
+	return sa, nil
+}
+
+// GoogleServiceAccountOptions presets options for the Google service
+// account flow: each token request sends a JWT assertion signed with
+// the service account key, requesting the scope of the client,
+// options.Scope or the scope given to WithScope.
+// If TokenURL is unspecified, it is taken from the service account,
+// defaulting to GoogleTokenURL.
+// ClientID is set to the service account email, used as cache key.
+func GoogleServiceAccountOptions(sa GoogleServiceAccount, options Options) (Options, error) {
+	key, errKey := parseRSAPrivateKey(sa.PrivateKey)
+	if errKey != nil {
+		return options, errKey
+	}
+
+	if options.TokenURL == "" {
+		options.TokenURL = sa.TokenURI
+	}
+	if options.TokenURL == "" {
+		options.TokenURL = GoogleTokenURL
+	}
+
+	options.ClientID = sa.ClientEmail
+	options.ClientSecret = ""
+	options.AzureEndpointVersion = AzureEndpointNone
+
+	aud := options.TokenURL
+
+	// the scope is sent within the assertion
+	options.ScopedAssertion = func(scope string) (string, error) {
+		now := time.Now()
+		claims := map[string]any{
+			"iss":   sa.ClientEmail,
+			"scope": scope,
+			"aud":   aud,
+			"iat":   now.Unix(),
+			"exp":   now.Add(googleAssertionLifetime).Unix(),
+		}
+		return signJWT(key, sa.PrivateKeyID, claims)
+	}
+
+	return options, nil
+}
+
+// NewGoogleServiceAccount creates a client for the Google service account flow.
+// See GoogleServiceAccountOptions.
+func NewGoogleServiceAccount(sa GoogleServiceAccount, options Options) (*Client, error) {
+	o, errOpt := GoogleServiceAccountOptions(sa, options)
+	if errOpt != nil {
+		return nil, errOpt
+	}
+	return New(o), nil
+}
+
+// parseRSAPrivateKey parses a PEM key in PKCS#8 or PKCS#1 form.
+func parseRSAPrivateKey(keyPEM string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return nil, errors.New("private key: missing PEM block")
+	}
+
+	if key, errPKCS1 := x509.ParsePKCS1PrivateKey(block.Bytes); errPKCS1 == nil {
+		return key, nil
+	}
+
+	parsed, errPKCS8 := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if errPKCS8 != nil {
+		return nil, fmt.Errorf("private key: %v", errPKCS8)
+	}
+
+	key, isRSA := parsed.(*rsa.PrivateKey)
+	if !isRSA {
+		return nil, fmt.Errorf("private key: unexpected key type %T", parsed)
+	}
+
+	return key, nil
+}
+
+// signJWT builds a RS256 signed JWT.
+func signJWT(key *rsa.PrivateKey, keyID string, claims map[string]any) (string, error) {
+	header := map[string]string{"alg": "RS256", "typ": "JWT"}
+	if keyID != "" {
+		header["kid"] = keyID
+	}
+
+	headerJSON, errHeader := json.Marshal(header)
+	if errHeader != nil {
+		return "", errHeader
+	}
+	claimsJSON, errClaims := json.Marshal(claims)
+	if errClaims != nil {
+		return "", errClaims
+	}
+
+	enc := base64.RawURLEncoding
+	signingInput := enc.EncodeToString(headerJSON) + "." + enc.EncodeToString(claimsJSON)
+
+	sum := sha256.Sum256([]byte(signingInput))
+	sig, errSign := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if errSign != nil {
+		return "", fmt.Errorf("sign jwt: %v", errSign)
+	}
+
+	return signingInput + "." + enc.EncodeToString(sig), nil
+}
@@ -0,0 +1,117 @@
+package clientcredentials
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+func TestGoogleServiceAccount(t *testing.T) {
+
+	key, errKey := rsa.GenerateKey(rand.Reader, 2048)
+	if errKey != nil {
+		t.Fatalf("generate key: %v", errKey)
+	}
+	keyDER, errDER := x509.MarshalPKCS8PrivateKey(key)
+	if errDER != nil {
+		t.Fatalf("marshal key: %v", errDER)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+
+	var tokenURL string
+	var scopes []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if formParam(r, "grant_type") != GrantTypeJWTBearer || formParam(r, "client_secret") != "" {
+			httpJSON(w, `{"error":"unsupported_grant_type"}`, http.StatusBadRequest)
+			return
+		}
+		claims, errVerify := verifyJWT(&key.PublicKey, formParam(r, "assertion"))
+		if errVerify != nil {
+			httpJSON(w, fmt.Sprintf(`{"error":"invalid_grant","error_description":%q}`, errVerify.Error()), http.StatusBadRequest)
+			return
+		}
+		if claims["iss"] != "sa@project.iam.gserviceaccount.com" || claims["aud"] != tokenURL || formParam(r, "scope") != "" {
+			httpJSON(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		scopes = append(scopes, fmt.Sprint(claims["scope"]))
+		httpJSON(w, `{"access_token":"abc","expires_in":3600,"token_type":"Bearer"}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	tokenURL = ts.URL
+
+	serverStat := serverStat{}
+	srv := newServer(&serverStat, func(t string) bool { return t == "abc" })
+	defer srv.Close()
+
+	saJSON, _ := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "sa@project.iam.gserviceaccount.com",
+		"private_key":    string(keyPEM),
+		"private_key_id": "key1",
+		"token_uri":      ts.URL,
+	})
+
+	sa, errSA := GoogleServiceAccountFromJSON(saJSON)
+	if errSA != nil {
+		t.Fatalf("service account: %v", errSA)
+	}
+
+	client, errClient := NewGoogleServiceAccount(sa, Options{
+		Scope:               "scope1",
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+	if errClient != nil {
+		t.Fatalf("client: %v", errClient)
+	}
+
+	if _, errSend := send(client, srv.URL); errSend != nil {
+		t.Errorf("send: %v", errSend)
+	}
+
+	// derived client signs its own scope into the assertion
+	if _, errSend := send(client.WithScope("scope2"), srv.URL); errSend != nil {
+		t.Errorf("send with scope: %v", errSend)
+	}
+
+	if got := strings.Join(scopes, ","); got != "scope1,scope2" {
+		t.Errorf("unexpected assertion scopes: %s", got)
+	}
+}
+
+func verifyJWT(key *rsa.PublicKey, token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("bad jwt")
+	}
+	sig, errSig := base64.RawURLEncoding.DecodeString(parts[2])
+	if errSig != nil {
+		return nil, errSig
+	}
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if errVerify := rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig); errVerify != nil {
+		return nil, errVerify
+	}
+	payload, errPayload := base64.RawURLEncoding.DecodeString(parts[1])
+	if errPayload != nil {
+		return nil, errPayload
+	}
+	var claims map[string]any
+	errJSON := json.Unmarshal(payload, &claims)
+	return claims, errJSON
+}
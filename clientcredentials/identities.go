@@ -0,0 +1,120 @@
+package clientcredentials
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+)
+
+// DefaultMaxIdentities is the default Options.MaxIdentities when
+// identities are taken from request headers.
+const DefaultMaxIdentities = 1000
+
+// Policies for Options.IdentityOverflow.
+const (
+	// IdentityOverflowEvict evicts the least recently used identities.
+	IdentityOverflowEvict = "evict"
+
+	// IdentityOverflowReject rejects new identities with ErrTooManyIdentities.
+	IdentityOverflowReject = "reject"
+)
+
+// ErrTooManyIdentities is returned by clients derived beyond
+// Options.MaxIdentities with IdentityOverflowReject.
+var ErrTooManyIdentities = errors.New("too many identities")
+
+// identityLRU bounds the number of derived clients registered by a root
+// client, see Options.MaxIdentities. The root client is never evicted.
+type identityLRU struct {
+	max    int
+	reject bool // reject new keys beyond max, instead of evicting
+
+	mutex sync.Mutex
+	order *list.List // cache keys, most recently used first
+	elems map[string]*list.Element
+}
+
+// newIdentityLRU returns nil if unbounded.
+func newIdentityLRU(maxIdentities int, reject bool) *identityLRU {
+	if maxIdentities < 1 {
+		return nil
+	}
+	return &identityLRU{
+		max:    maxIdentities,
+		reject: reject,
+		order:  list.New(),
+		elems:  map[string]*list.Element{},
+	}
+}
+
+// touch records use of key, returning the keys evicted to stay
+// within bounds and the current number of identities. It returns
+// false if key was rejected.
+func (l *identityLRU) touch(key string) ([]string, int, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if e, found := l.elems[key]; found {
+		l.order.MoveToFront(e)
+		return nil, l.order.Len(), true
+	}
+
+	if l.reject && l.order.Len() >= l.max {
+		return nil, l.order.Len(), false
+	}
+
+	l.elems[key] = l.order.PushFront(key)
+
+	var evicted []string
+	for l.order.Len() > l.max {
+		oldest := l.order.Back()
+		k := l.order.Remove(oldest).(string)
+		delete(l.elems, k)
+		evicted = append(evicted, k)
+	}
+
+	return evicted, l.order.Len(), true
+}
+
+// remove forgets key, e.g. the key of a rotated secret.
+func (l *identityLRU) remove(key string) {
+	if l == nil {
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if e, found := l.elems[key]; found {
+		l.order.Remove(e)
+		delete(l.elems, key)
+	}
+}
+
+// headerIdentities reports whether options derive identities from
+// request headers, thus from callers.
+func headerIdentities(options Options) bool {
+	return options.ScopeHeader != "" || options.BasicAuthCredentials ||
+		options.ExtractCredentials != nil
+}
+
+// trackIdentity records use of the derived client c, evicting the least
+// recently used derived clients beyond Options.MaxIdentities. It returns
+// false if c was rejected, see Options.IdentityOverflow.
+func (c *Client) trackIdentity() bool {
+	if c.identities == nil {
+		return true
+	}
+	evicted, size, ok := c.identities.touch(c.key)
+	if !ok {
+		c.metrics.identityRejections.Inc()
+		return false
+	}
+	for _, key := range evicted {
+		if owner, found := c.owners.LoadAndDelete(key); found {
+			owner.(*Client).evict(context.Background(), key)
+		}
+		c.metrics.identityEvictions.Inc()
+	}
+	c.metrics.identities.Set(float64(size))
+	return true
+}
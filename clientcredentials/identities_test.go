@@ -0,0 +1,241 @@
+package clientcredentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/modernprogram/groupcache/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMaxIdentities(t *testing.T) {
+
+	tokenServerStat := serverStat{}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenServerStat.inc()
+		r.ParseForm()
+		httpJSON(w, `{"access_token":"token-`+formParam(r, "client_id")+`","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	root := New(Options{
+		TokenURL:            ts.URL,
+		ClientID:            "root",
+		ClientSecret:        "secret",
+		MaxIdentities:       2,
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+
+	var tenants []*Client
+
+	for i := range 3 {
+		tenant := root.WithCredentials(fmt.Sprintf("tenant%d", i), "secret")
+		if _, errTok := tenant.Token(context.TODO()); errTok != nil {
+			t.Fatalf("tenant%d: token: %v", i, errTok)
+		}
+		tenants = append(tenants, tenant)
+	}
+
+	if n := testutil.ToFloat64(root.metrics.identities); n != 2 {
+		t.Errorf("expected 2 identities, got %v", n)
+	}
+	if n := testutil.ToFloat64(root.metrics.identityEvictions); n != 1 {
+		t.Errorf("expected 1 identity eviction, got %v", n)
+	}
+
+	if _, found := root.owners.Load(tenants[0].cacheKey()); found {
+		t.Errorf("expected oldest identity evicted")
+	}
+
+	// evicted client keeps working, fetching its token again
+
+	tok, errTok := tenants[0].Token(context.TODO())
+	if errTok != nil {
+		t.Fatalf("evicted tenant: token: %v", errTok)
+	}
+	if tok.AccessToken != "token-tenant0" {
+		t.Errorf("evicted tenant: unexpected token: %s", tok.AccessToken)
+	}
+
+	if tokenServerStat.count != 4 {
+		t.Errorf("expected 4 token requests, got %d", tokenServerStat.count)
+	}
+}
+
+func TestIdentityOverflowReject(t *testing.T) {
+
+	tokenServerStat := serverStat{}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenServerStat.inc()
+		r.ParseForm()
+		httpJSON(w, `{"access_token":"token-`+formParam(r, "client_id")+`","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	root := New(Options{
+		TokenURL:            ts.URL,
+		ClientID:            "root",
+		ClientSecret:        "secret",
+		MaxIdentities:       2,
+		IdentityOverflow:    IdentityOverflowReject,
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+	defer root.Close()
+
+	table := []struct {
+		name      string
+		clientID  string
+		expectErr error
+	}{
+		{"first", "tenant0", nil},
+		{"second", "tenant1", nil},
+		{"beyond limit", "tenant2", ErrTooManyIdentities},
+		{"known identity", "tenant0", nil},
+		{"scope beyond limit", "tenant0", ErrTooManyIdentities},
+	}
+
+	for _, data := range table {
+		tenant := root.WithCredentials(data.clientID, "secret")
+		if data.name == "scope beyond limit" {
+			tenant = tenant.WithScope("extra")
+		}
+		tok, errTok := tenant.Token(context.TODO())
+		if !errors.Is(errTok, data.expectErr) {
+			t.Errorf("%s: expected error %v, got %v", data.name, data.expectErr, errTok)
+			continue
+		}
+		if errTok == nil && tok.AccessToken != "token-"+data.clientID {
+			t.Errorf("%s: unexpected token: %s", data.name, tok.AccessToken)
+		}
+	}
+
+	// rejected clients derive rejected clients
+	rejected := root.WithCredentials("tenant3", "secret").WithScope("other")
+	if _, errTok := rejected.Token(context.TODO()); !errors.Is(errTok, ErrTooManyIdentities) {
+		t.Errorf("derived from rejected: expected ErrTooManyIdentities, got %v", errTok)
+	}
+
+	if n := testutil.ToFloat64(root.metrics.identities); n != 2 {
+		t.Errorf("expected 2 identities, got %v", n)
+	}
+	if n := testutil.ToFloat64(root.metrics.identityEvictions); n != 0 {
+		t.Errorf("expected no identity eviction, got %v", n)
+	}
+	if n := testutil.ToFloat64(root.metrics.identityRejections); n != 3 {
+		t.Errorf("expected 3 identity rejections, got %v", n)
+	}
+
+	// tokens of known identities are kept
+	if tokenServerStat.count != 2 {
+		t.Errorf("expected 2 token requests, got %d", tokenServerStat.count)
+	}
+}
+
+func TestIdentityOverflowUnknown(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic for unknown identity overflow")
+		}
+	}()
+	New(Options{
+		TokenURL:            "http://localhost",
+		IdentityOverflow:    "drop",
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+}
+
+func TestMaxIdentitiesDefault(t *testing.T) {
+
+	table := []struct {
+		name   string
+		option func(o *Options)
+		expect int
+	}{
+		{"no header identities", func(*Options) {}, 0},
+		{"scope header", func(o *Options) { o.ScopeHeader = "oauth2-scope" }, DefaultMaxIdentities},
+		{"basic auth credentials", func(o *Options) { o.BasicAuthCredentials = true }, DefaultMaxIdentities},
+		{"extract credentials", func(o *Options) {
+			o.ExtractCredentials = func(*http.Request) (string, string, bool) { return "", "", false }
+		}, DefaultMaxIdentities},
+		{"explicit limit", func(o *Options) { o.ScopeHeader = "oauth2-scope"; o.MaxIdentities = 5 }, 5},
+		{"explicit unbounded", func(o *Options) { o.ScopeHeader = "oauth2-scope"; o.MaxIdentities = -1 }, 0},
+	}
+
+	for _, data := range table {
+		options := Options{
+			TokenURL:            "http://localhost",
+			GroupcacheWorkspace: groupcache.NewWorkspace(),
+		}
+		data.option(&options)
+		client := New(options)
+		got := 0
+		if client.identities != nil {
+			got = client.identities.max
+		}
+		client.Close()
+		if got != data.expect {
+			t.Errorf("%s: expected max identities %d, got %d", data.name, data.expect, got)
+		}
+	}
+}
+
+func TestScopeHeaderBoundedIdentities(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		httpJSON(w, `{"access_token":"token-`+formParam(r, "scope")+`","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		httpJSON(w, `{"message":"ok"}`, http.StatusOK)
+	}))
+	defer srv.Close()
+
+	cache := NewMemoryTokenCache()
+
+	client := New(Options{
+		TokenURL:            ts.URL,
+		ClientID:            "root",
+		ClientSecret:        "secret",
+		ScopeHeader:         "oauth2-scope",
+		MaxIdentities:       3,
+		TokenCache:          cache,
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+	defer client.Close()
+
+	for i := range 10 {
+		req, errReq := http.NewRequest("GET", srv.URL, nil)
+		if errReq != nil {
+			t.Fatalf("request %d: %v", i, errReq)
+		}
+		req.Header.Set("oauth2-scope", fmt.Sprintf("scope%d", i))
+		resp, errDo := client.Do(req)
+		if errDo != nil {
+			t.Fatalf("do %d: %v", i, errDo)
+		}
+		resp.Body.Close()
+	}
+
+	owners := 0
+	client.owners.Range(func(_, _ any) bool {
+		owners++
+		return true
+	})
+	if owners != 4 { // 3 identities, plus the root client
+		t.Errorf("expected 4 registered clients, got %d", owners)
+	}
+	cache.mutex.Lock()
+	entries := len(cache.entries)
+	cache.mutex.Unlock()
+	if entries > 4 { // 3 identities, plus the root client, if cached
+		t.Errorf("expected at most 4 cached tokens, got %d", entries)
+	}
+}
@@ -0,0 +1,88 @@
+package clientcredentials
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// introspect checks the token against the RFC 7662 introspection endpoint.
+// The client authenticates with its credentials using HTTP Basic auth.
+func (c *Client) introspect(ctx context.Context, accessToken string) (bool, error) {
+	form := url.Values{}
+	form.Add("token", accessToken)
+	form.Add("token_type_hint", "access_token")
+
+	req, errReq := http.NewRequestWithContext(ctx, "POST", c.options.IntrospectionURL,
+		strings.NewReader(form.Encode()))
+	if errReq != nil {
+		return false, errReq
+	}
+
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	c.setClientBasicAuth(req, c.clientSecret())
+
+	resp, errDo := c.options.TokenHTTPClient.Do(req)
+	if errDo != nil {
+		return false, errDo
+	}
+	defer resp.Body.Close()
+
+	body, errBody := io.ReadAll(resp.Body)
+	if errBody != nil {
+		return false, errBody
+	}
+
+	if resp.StatusCode < c.options.HTTPStatusOkMin || resp.StatusCode > c.options.HTTPStatusOkMax {
+		return false, fmt.Errorf("bad introspection response http status: status:%d body:%v",
+			resp.StatusCode, string(body))
+	}
+
+	var data struct {
+		Active bool `json:"active"`
+	}
+	if errJSON := json.Unmarshal(body, &data); errJSON != nil {
+		return false, fmt.Errorf("parse introspection response: %v", errJSON)
+	}
+
+	return data.Active, nil
+}
+
+// introspectAndEvict checks the token and evicts it when inactive.
+// Introspection failure is logged and counts as inactive only if
+// evictOnError is true.
+func (c *Client) introspectAndEvict(ctx context.Context, key, accessToken string, evictOnError bool) bool {
+	active, errIntro := c.introspect(ctx, accessToken)
+	if errIntro != nil {
+		c.errorfCtx(ctx, "introspection error: %v", errIntro)
+		c.fallback(FallbackIntrospectionFailure, key, errIntro)
+		if !evictOnError {
+			return false
+		}
+	} else if active {
+		return false
+	}
+
+	c.logEvent(ctx, slog.LevelDebug, "evict", "introspection: evicting inactive token", slog.String("key", key))
+
+	c.evict(ctx, key)
+
+	return true
+}
+
+// introspectAll checks all tracked tokens, evicting inactive ones.
+func (c *Client) introspectAll() {
+	now := time.Now()
+	for key, t := range c.tokens.snapshot() {
+		if now.After(t.hardExpire) {
+			continue // expired tokens are already inactive
+		}
+		c.introspectAndEvict(context.Background(), key, t.accessToken, false)
+	}
+}
@@ -0,0 +1,160 @@
+package clientcredentials
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+func newIntrospectionServer(stat *serverStat, active *atomic.Bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stat.inc()
+		if _, _, ok := r.BasicAuth(); !ok {
+			httpJSON(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		if active.Load() {
+			httpJSON(w, `{"active":true}`, http.StatusOK)
+			return
+		}
+		httpJSON(w, `{"active":false}`, http.StatusOK)
+	}))
+}
+
+func TestIntrospectionPeriodic(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "abc"
+	expireIn := 60
+
+	tokenServerStat := serverStat{}
+	introStat := serverStat{}
+	serverStat := serverStat{}
+
+	var active atomic.Bool
+	active.Store(true)
+
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, token, expireIn)
+	defer ts.Close()
+
+	is := newIntrospectionServer(&introStat, &active)
+	defer is.Close()
+
+	srv := newServer(&serverStat, func(t string) bool { return t == token })
+	defer srv.Close()
+
+	options := Options{
+		TokenURL:              ts.URL,
+		ClientID:              clientID,
+		ClientSecret:          clientSecret,
+		IntrospectionURL:      is.URL,
+		IntrospectionInterval: 20 * time.Millisecond,
+		GroupcacheWorkspace:   groupcache.NewWorkspace(),
+	}
+
+	client := New(options)
+	defer client.Close()
+
+	if _, errSend := send(client, srv.URL); errSend != nil {
+		t.Errorf("send 1: %v", errSend)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if _, errSend := send(client, srv.URL); errSend != nil {
+		t.Errorf("send 2: %v", errSend)
+	}
+	if tokenServerStat.count != 1 {
+		t.Errorf("active token: unexpected token server access count: %d", tokenServerStat.count)
+	}
+
+	active.Store(false)
+
+	time.Sleep(100 * time.Millisecond)
+
+	if _, errSend := send(client, srv.URL); errSend != nil {
+		t.Errorf("send 3: %v", errSend)
+	}
+	if tokenServerStat.count != 2 {
+		t.Errorf("inactive token: unexpected token server access count: %d", tokenServerStat.count)
+	}
+}
+
+func TestIntrospectionOn401(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "abc"
+	expireIn := 60
+
+	tokenServerStat := serverStat{}
+	introStat := serverStat{}
+	serverStat := serverStat{}
+
+	var active atomic.Bool
+	active.Store(true)
+
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, token, expireIn)
+	defer ts.Close()
+
+	is := newIntrospectionServer(&introStat, &active)
+	defer is.Close()
+
+	var accept atomic.Bool
+	accept.Store(false)
+
+	srv := newServer(&serverStat, func(string) bool { return accept.Load() })
+	defer srv.Close()
+
+	options := Options{
+		TokenURL:            ts.URL,
+		ClientID:            clientID,
+		ClientSecret:        clientSecret,
+		IntrospectionURL:    is.URL,
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	}
+
+	client := New(options)
+	defer client.Close()
+
+	// 401 with active token: keep token
+
+	if _, errSend := send(client, srv.URL); errSend == nil {
+		t.Errorf("send 1: unexpected success")
+	}
+	if introStat.count != 1 {
+		t.Errorf("unexpected introspection count: %d", introStat.count)
+	}
+
+	accept.Store(true)
+
+	if _, errSend := send(client, srv.URL); errSend != nil {
+		t.Errorf("send 2: %v", errSend)
+	}
+	if tokenServerStat.count != 1 {
+		t.Errorf("unexpected token server access count: %d", tokenServerStat.count)
+	}
+
+	// 401 with inactive token: evict token
+
+	accept.Store(false)
+	active.Store(false)
+
+	if _, errSend := send(client, srv.URL); errSend == nil {
+		t.Errorf("send 3: unexpected success")
+	}
+
+	accept.Store(true)
+
+	if _, errSend := send(client, srv.URL); errSend != nil {
+		t.Errorf("send 4: %v", errSend)
+	}
+	if tokenServerStat.count != 2 {
+		t.Errorf("unexpected token server access count: %d", tokenServerStat.count)
+	}
+}
@@ -0,0 +1,51 @@
+package clientcredentials
+
+// Credential sources reported by Options.OnInvalidCredentials and the
+// groupcache_oauth2_invalid_credentials_total metric.
+const (
+	// CredentialSourceOptions reports credentials from Options.ClientID
+	// and Options.ClientSecret.
+	CredentialSourceOptions = "options"
+
+	// CredentialSourceContext reports credentials from ContextWithCredentials.
+	CredentialSourceContext = "context"
+
+	// CredentialSourceExtract reports credentials from Options.ExtractCredentials.
+	CredentialSourceExtract = "extract"
+
+	// CredentialSourceBasicAuth reports credentials from the Basic
+	// authorization header, see Options.BasicAuthCredentials.
+	CredentialSourceBasicAuth = "basic_auth"
+
+	// CredentialSourceProvider reports credentials from Options.CredentialsProvider.
+	CredentialSourceProvider = "provider"
+)
+
+// InvalidCredentialsEvent describes client credentials refused by the
+// token server.
+type InvalidCredentialsEvent struct {
+	// ClientID is the refused client ID.
+	ClientID string
+
+	// Source is one of the CredentialSource* constants.
+	Source string
+
+	// Err is the token server error.
+	Err error
+}
+
+// invalidCredentials records credentials from source refused by the
+// token server, if err reports so.
+func (c *Client) invalidCredentials(source string, err error) {
+	if !isInvalidClient(err) {
+		return
+	}
+	c.metrics.invalidCredentials.WithLabelValues(c.metrics.clientIDs.label(c.options.ClientID), source).Inc()
+	if c.options.OnInvalidCredentials != nil {
+		c.options.OnInvalidCredentials(InvalidCredentialsEvent{
+			ClientID: c.options.ClientID,
+			Source:   source,
+			Err:      err,
+		})
+	}
+}
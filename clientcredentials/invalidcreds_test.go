@@ -0,0 +1,112 @@
+package clientcredentials
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/modernprogram/groupcache/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInvalidCredentials(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		clientID := formParam(r, "client_id")
+		if formParam(r, "client_secret") != clientID+"Secret" {
+			httpJSON(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		httpJSON(w, `{"access_token":"`+clientID+`","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httpJSON(w, `{"message":"ok"}`, http.StatusOK)
+	}))
+	defer srv.Close()
+
+	var events []InvalidCredentialsEvent
+	client := New(Options{
+		TokenURL:             ts.URL,
+		ClientID:             "root",
+		ClientSecret:         "rootSecret",
+		BasicAuthCredentials: true,
+		MetricsClientIDLabel: true,
+		OnInvalidCredentials: func(event InvalidCredentialsEvent) {
+			events = append(events, event)
+		},
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+	defer client.Close()
+
+	table := []struct {
+		name      string
+		clientID  string
+		secret    string
+		expectErr bool
+	}{
+		{"tenant", "tenant1", "tenant1Secret", false},
+		{"wrong secret", "tenant1", "wrong", true},
+		{"wrong secret again", "tenant1", "wrong2", true},
+		{"other tenant wrong secret", "tenant2", "wrong", true},
+	}
+
+	for _, data := range table {
+		req, errReq := http.NewRequest("GET", srv.URL, nil)
+		if errReq != nil {
+			t.Fatalf("%s: request: %v", data.name, errReq)
+		}
+		req.SetBasicAuth(data.clientID, data.secret)
+		resp, errDo := client.Do(req)
+		if data.expectErr {
+			if errDo == nil {
+				resp.Body.Close()
+				t.Errorf("%s: expected error", data.name)
+			}
+			continue
+		}
+		if errDo != nil {
+			t.Fatalf("%s: do: %v", data.name, errDo)
+		}
+		resp.Body.Close()
+	}
+
+	ctx := ContextWithCredentials(context.Background(), "tenant1", "wrong")
+	if _, err := client.Token(ctx); err == nil {
+		t.Errorf("expected token error for wrong context secret")
+	}
+
+	if len(events) != 4 {
+		t.Fatalf("expected 4 events, got %d: %v", len(events), events)
+	}
+	expectSources := []string{CredentialSourceBasicAuth, CredentialSourceBasicAuth,
+		CredentialSourceBasicAuth, CredentialSourceContext}
+	expectIDs := []string{"tenant1", "tenant1", "tenant2", "tenant1"}
+	for i, e := range events {
+		if e.Source != expectSources[i] || e.ClientID != expectIDs[i] || !isInvalidClient(e.Err) {
+			t.Errorf("event %d: expected %s/%s, got %s/%s: %v",
+				i, expectIDs[i], expectSources[i], e.ClientID, e.Source, e.Err)
+		}
+	}
+
+	metricsTable := []struct {
+		clientID string
+		source   string
+		expect   float64
+	}{
+		{"tenant1", CredentialSourceBasicAuth, 2},
+		{"tenant2", CredentialSourceBasicAuth, 1},
+		{"tenant1", CredentialSourceContext, 1},
+		{"root", CredentialSourceOptions, 0},
+	}
+	for _, data := range metricsTable {
+		m := client.metrics.invalidCredentials.WithLabelValues(data.clientID, data.source)
+		if got := testutil.ToFloat64(m); got != data.expect {
+			t.Errorf("%s/%s: expected %v invalid credentials, got %v",
+				data.clientID, data.source, data.expect, got)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package clientcredentials
+
+import (
+	"context"
+	"net/http"
+	"slices"
+)
+
+// TokenURLNotAllowedError reports a token URL taken from the
+// Options.TokenURLHeader request header but missing from
+// Options.AllowedTokenURLs.
+type TokenURLNotAllowedError struct {
+	URL string
+}
+
+func (e *TokenURLNotAllowedError) Error() string {
+	return "token url not allowed: " + e.URL
+}
+
+// WithTokenURL returns a client requesting tokens from another token
+// endpoint, e.g. a per-tenant identity provider, sharing cache, HTTP client,
+// metrics and background tasks with c. Tokens are cached under a key
+// including tokenURL. Alternate endpoints from Options.TokenURLs are
+// not used by the derived client.
+// The derived client must not be closed; close the root client instead.
+// WithTokenURL panics if tokenURL is rejected by Options.RequireTLS.
+func (c *Client) WithTokenURL(tokenURL string) *Client {
+	if errTLS := c.checkTLSString("token", tokenURL); errTLS != nil {
+		panic(errTLS)
+	}
+	d := c.derive()
+	d.options.TokenURL = tokenURL
+	d.options.TokenURLs = nil
+	d.endpoints = nil
+	d.tokenURLInKey = true
+	return d.register()
+}
+
+type tokenURLKey struct{}
+
+// ContextWithTokenURL returns a context carrying a per-request token
+// endpoint, overriding Options.TokenURL for Do, DoWithOutput and Token.
+// The request is served by the client derived with WithTokenURL, thus
+// tokens from distinct endpoints are cached under distinct keys.
+// Unlike Options.TokenURLHeader, the URL is not checked against
+// Options.AllowedTokenURLs, since the context is set by the application.
+func ContextWithTokenURL(ctx context.Context, tokenURL string) context.Context {
+	return context.WithValue(ctx, tokenURLKey{}, tokenURL)
+}
+
+// requestTokenURLOverride retrieves the token URL from ContextWithTokenURL,
+// then from the Options.TokenURLHeader request header.
+func (c *Client) requestTokenURLOverride(ctx context.Context, req *http.Request) (string, bool, error) {
+	if tokenURL, found := ctx.Value(tokenURLKey{}).(string); found {
+		return tokenURL, true, nil
+	}
+	if c.options.TokenURLHeader == "" || req == nil {
+		return "", false, nil
+	}
+	values, found := req.Header[c.options.TokenURLHeader]
+	if !found || len(values) == 0 {
+		return "", false, nil
+	}
+	tokenURL := values[0]
+	if tokenURL != c.options.TokenURL && !slices.Contains(c.options.AllowedTokenURLs, tokenURL) {
+		return "", false, &TokenURLNotAllowedError{URL: tokenURL}
+	}
+	return tokenURL, true, nil
+}
+
+// forTokenURL returns c if it already uses the token URL,
+// otherwise the client derived with WithTokenURL.
+func (c *Client) forTokenURL(tokenURL string) (*Client, error) {
+	if tokenURL == c.options.TokenURL {
+		return c, nil
+	}
+	if errTLS := c.checkTLSString("token", tokenURL); errTLS != nil {
+		return nil, errTLS
+	}
+	return c.WithTokenURL(tokenURL), nil
+}
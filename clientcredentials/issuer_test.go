@@ -0,0 +1,101 @@
+package clientcredentials
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+func TestRequestTokenURL(t *testing.T) {
+
+	var fetches []string
+	newIssuer := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			fetches = append(fetches, name)
+			httpJSON(w, `{"access_token":"`+name+`","expires_in":60}`, http.StatusOK)
+		}))
+	}
+	issuer1 := newIssuer("issuer1")
+	defer issuer1.Close()
+	issuer2 := newIssuer("issuer2")
+	defer issuer2.Close()
+	issuer3 := newIssuer("issuer3")
+	defer issuer3.Close()
+
+	var gotToken, gotHeader string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotToken = r.Header.Get("Authorization")
+		gotHeader = r.Header.Get("oauth2-token-url")
+		httpJSON(w, `{"message":"ok"}`, http.StatusOK)
+	}))
+	defer srv.Close()
+
+	root := New(Options{
+		TokenURL:            issuer1.URL,
+		ClientID:            "clientID",
+		ClientSecret:        "clientSecret",
+		TokenURLHeader:      "oauth2-token-url",
+		AllowedTokenURLs:    []string{issuer2.URL},
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+	defer root.Close()
+
+	table := []struct {
+		name         string
+		ctx          context.Context
+		header       string
+		expect       string
+		expectDenied bool
+	}{
+		{"default issuer", context.TODO(), "", "Bearer issuer1", false},
+		{"header issuer", context.TODO(), issuer2.URL, "Bearer issuer2", false},
+		{"header issuer cached", context.TODO(), issuer2.URL, "Bearer issuer2", false},
+		{"header default issuer", context.TODO(), issuer1.URL, "Bearer issuer1", false},
+		{"header issuer not allowed", context.TODO(), issuer3.URL, "", true},
+		{"context issuer", ContextWithTokenURL(context.TODO(), issuer3.URL), "", "Bearer issuer3", false},
+		{"context over header", ContextWithTokenURL(context.TODO(), issuer3.URL), issuer2.URL, "Bearer issuer3", false},
+	}
+
+	for _, data := range table {
+		req, errReq := http.NewRequestWithContext(data.ctx, "GET", srv.URL, nil)
+		if errReq != nil {
+			t.Fatalf("%s: request: %v", data.name, errReq)
+		}
+		if data.header != "" {
+			req.Header.Set("oauth2-token-url", data.header)
+		}
+		gotToken = ""
+		resp, errDo := root.Do(req)
+		if data.expectDenied {
+			var notAllowed *TokenURLNotAllowedError
+			if !errors.As(errDo, &notAllowed) {
+				t.Errorf("%s: expected TokenURLNotAllowedError, got %v", data.name, errDo)
+			}
+			continue
+		}
+		if errDo != nil {
+			t.Fatalf("%s: do: %v", data.name, errDo)
+		}
+		resp.Body.Close()
+		if gotToken != data.expect {
+			t.Errorf("%s: expected token %q, got %q", data.name, data.expect, gotToken)
+		}
+		if gotHeader != "" {
+			t.Errorf("%s: token url header forwarded: %q", data.name, gotHeader)
+		}
+	}
+
+	expect := "issuer1,issuer2,issuer3"
+	if got := strings.Join(fetches, ","); got != expect {
+		t.Errorf("expected fetches %s, got %s", expect, got)
+	}
+
+	if key := root.WithTokenURL(issuer2.URL).cacheKey(); key == root.cacheKey() || !strings.Contains(key, issuer2.URL) {
+		t.Errorf("unexpected derived cache key: %s", key)
+	}
+}
@@ -0,0 +1,155 @@
+package clientcredentials
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// levelPrefix prefixes Options.Logf lines with the level.
+func levelPrefix(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return "ERROR: "
+	case level >= slog.LevelWarn:
+		return "WARN: "
+	case level >= slog.LevelInfo:
+		return "INFO: "
+	}
+	return "DEBUG: "
+}
+
+// logAttrs returns the attributes of every structured log record.
+func (c *Client) logAttrs() []slog.Attr {
+	return []slog.Attr{
+		slog.String("client_id", c.options.ClientID),
+		slog.String("token_url", redactURL(c.options.TokenURL)),
+	}
+}
+
+// logf emits a log record to Options.Logger, if defined, otherwise
+// to Options.Logf, with the request ID from ctx, see Options.RequestIDFunc.
+func (c *Client) logf(ctx context.Context, level slog.Level, format string, v ...any) {
+	requestID := c.requestID(ctx)
+	if c.options.Logger == nil {
+		if requestID != "" {
+			format = "request_id=" + requestID + " " + format
+		}
+		c.options.Logf(levelPrefix(level)+format, v...)
+		return
+	}
+	if !c.options.Logger.Enabled(ctx, level) {
+		return
+	}
+	attrs := c.logAttrs()
+	if requestID != "" {
+		attrs = append(attrs, slog.String("request_id", requestID))
+	}
+	c.options.Logger.LogAttrs(ctx, level, fmt.Sprintf(format, v...), attrs...)
+}
+
+func (c *Client) errorfCtx(ctx context.Context, format string, v ...any) {
+	c.logf(ctx, slog.LevelError, format, v...)
+}
+
+func (c *Client) infofCtx(ctx context.Context, format string, v ...any) {
+	c.logf(ctx, slog.LevelInfo, format, v...)
+}
+
+func (c *Client) warnfCtx(ctx context.Context, format string, v ...any) {
+	c.logf(ctx, slog.LevelWarn, format, v...)
+}
+
+func (c *Client) debugfCtx(ctx context.Context, format string, v ...any) {
+	if c.options.Debug {
+		c.logf(ctx, slog.LevelDebug, format, v...)
+	}
+}
+
+// logEvent emits a cache or token fetch event with structured attributes.
+// Options.Logf receives the attributes as key=value pairs. Debug events
+// require Options.Debug.
+func (c *Client) logEvent(ctx context.Context, level slog.Level, event, msg string, attrs ...slog.Attr) {
+	if level < slog.LevelInfo && !c.options.Debug {
+		return
+	}
+	attrs = append([]slog.Attr{slog.String("cache_event", event)}, attrs...)
+	if requestID := c.requestID(ctx); requestID != "" {
+		attrs = append(attrs, slog.String("request_id", requestID))
+	}
+	if c.options.Logger == nil {
+		var sb strings.Builder
+		sb.WriteString(msg)
+		sb.WriteString(":")
+		for _, a := range append(attrs, slog.String("client_id", c.options.ClientID)) {
+			sb.WriteString(" ")
+			sb.WriteString(a.String())
+		}
+		c.options.Logf(levelPrefix(level)+"%s", sb.String())
+		return
+	}
+	if !c.options.Logger.Enabled(ctx, level) {
+		return
+	}
+	c.options.Logger.LogAttrs(ctx, level, msg, append(c.logAttrs(), attrs...)...)
+}
+
+// debugTokenBody returns the token response body for debug output, with
+// secret fields redacted unless Options.UnsafeDebugSecrets.
+func (c *Client) debugTokenBody(status int, body []byte) string {
+	if c.options.UnsafeDebugSecrets {
+		return string(body)
+	}
+	ok := status >= c.options.HTTPStatusOkMin && status <= c.options.HTTPStatusOkMax
+	return sanitizeTokenBody(body, ok)
+}
+
+type traceparentKey struct{}
+
+// withTraceparent records the trace ID from the W3C traceparent request
+// header, for requests without an OpenTelemetry span context.
+func withTraceparent(ctx context.Context, req *http.Request) context.Context {
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+	traceID := parseTraceparent(req.Header.Get("Traceparent"))
+	if traceID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, traceparentKey{}, traceID)
+}
+
+// parseTraceparent returns the trace ID from a W3C traceparent header:
+// version-traceid-parentid-flags.
+func parseTraceparent(header string) string {
+	parts := strings.Split(header, "-")
+	if len(parts) < 4 || len(parts[1]) != 32 {
+		return ""
+	}
+	traceID, errTrace := trace.TraceIDFromHex(parts[1])
+	if errTrace != nil {
+		return ""
+	}
+	return traceID.String()
+}
+
+// requestID returns the request ID for log records, from
+// Options.RequestIDFunc if defined, otherwise the trace ID from the
+// caller's W3C traceparent request header or from the OpenTelemetry
+// span context.
+func (c *Client) requestID(ctx context.Context) string {
+	if c.options.RequestIDFunc != nil {
+		return c.options.RequestIDFunc(ctx)
+	}
+	if traceID, found := ctx.Value(traceparentKey{}).(string); found {
+		return traceID
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		return sc.TraceID().String()
+	}
+	return ""
+}
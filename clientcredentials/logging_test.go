@@ -0,0 +1,221 @@
+package clientcredentials
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+func TestLogger(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "abc"
+
+	ts := newTokenServer(&serverStat{}, clientID, clientSecret, token, 60)
+	defer ts.Close()
+
+	srv := newServer(&serverStat{}, func(t string) bool { return t == token })
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	var lines []string
+
+	table := []struct {
+		name    string
+		options Options
+	}{
+		{"slog", Options{
+			Logger: slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+			Logf:   func(string, ...any) { t.Errorf("Logf should not be called with Logger") },
+		}},
+		{"logf", Options{
+			Logf: func(format string, v ...any) { lines = append(lines, fmt.Sprintf(format, v...)) },
+		}},
+	}
+
+	for _, data := range table {
+		options := data.options
+		options.TokenURL = ts.URL
+		options.ClientID = clientID
+		options.ClientSecret = clientSecret
+		options.Debug = true
+		options.GroupcacheWorkspace = groupcache.NewWorkspace()
+
+		client := New(options)
+		if _, errSend := send(client, srv.URL); errSend != nil {
+			t.Errorf("%s: send: %v", data.name, errSend)
+		}
+		client.Close()
+	}
+
+	var found bool
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		if errJSON := json.Unmarshal([]byte(line), &record); errJSON != nil {
+			t.Fatalf("slog record: %v: %s", errJSON, line)
+		}
+		if record["client_id"] != clientID || record["token_url"] != ts.URL {
+			t.Errorf("slog record missing client attributes: %s", line)
+		}
+		if record["cache_event"] == "token_fetch" {
+			found = true
+			if record["level"] != "DEBUG" || record["latency"] == nil || record["status"] != float64(200) {
+				t.Errorf("unexpected token_fetch record: %s", line)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("missing token_fetch slog record: %s", buf.String())
+	}
+
+	found = false
+	for _, line := range lines {
+		if strings.HasPrefix(line, "DEBUG: token response: cache_event=token_fetch status=200 latency=") &&
+			strings.HasSuffix(line, " client_id="+clientID) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("missing token_fetch Logf line: %q", lines)
+	}
+}
+
+func TestDebugRedaction(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "secret-access-token"
+
+	ts := newTokenServer(&serverStat{}, clientID, clientSecret, token, 60)
+	defer ts.Close()
+
+	srv := newServer(&serverStat{}, func(t string) bool { return t == token })
+	defer srv.Close()
+
+	table := []struct {
+		name         string
+		unsafe       bool
+		expectLeaked bool
+	}{
+		{"redacted", false, false},
+		{"unsafe", true, true},
+	}
+
+	for _, data := range table {
+		var out strings.Builder
+		client := New(Options{
+			TokenURL:            ts.URL,
+			ClientID:            clientID,
+			ClientSecret:        clientSecret,
+			Debug:               true,
+			UnsafeDebugSecrets:  data.unsafe,
+			Logf:                func(format string, v ...any) { fmt.Fprintf(&out, format+"\n", v...) },
+			GroupcacheWorkspace: groupcache.NewWorkspace(),
+		})
+		if _, errSend := send(client, srv.URL); errSend != nil {
+			t.Errorf("%s: send: %v", data.name, errSend)
+		}
+		client.Close()
+
+		logs := out.String()
+		if leaked := strings.Contains(logs, token); leaked != data.expectLeaked {
+			t.Errorf("%s: expected token leaked=%v, got %v: %s", data.name, data.expectLeaked, leaked, logs)
+		}
+		if strings.Contains(logs, clientSecret) {
+			t.Errorf("%s: client secret leaked: %s", data.name, logs)
+		}
+		if !data.unsafe && !strings.Contains(logs, redacted) {
+			t.Errorf("%s: expected redacted token response: %s", data.name, logs)
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "abc"
+
+	ts := newTokenServer(&serverStat{}, clientID, clientSecret, token, 60)
+	defer ts.Close()
+
+	srv := newServer(&serverStat{}, func(t string) bool { return t == token })
+	defer srv.Close()
+
+	type requestIDKey struct{}
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	table := []struct {
+		name          string
+		requestIDFunc func(ctx context.Context) string
+		ctx           context.Context
+		traceparent   string
+		expect        string
+	}{
+		{"no request id", nil, context.TODO(), "", ""},
+		{"traceparent", nil, context.TODO(), "00-" + traceID + "-00f067aa0ba902b7-01", traceID},
+		{"invalid traceparent", nil, context.TODO(), "00-invalid-00f067aa0ba902b7-01", ""},
+		{"request id func", func(ctx context.Context) string {
+			id, _ := ctx.Value(requestIDKey{}).(string)
+			return id
+		}, context.WithValue(context.TODO(), requestIDKey{}, "req-1"), "", "req-1"},
+	}
+
+	for _, data := range table {
+		var lines []string
+		client := New(Options{
+			TokenURL:            ts.URL,
+			ClientID:            clientID,
+			ClientSecret:        clientSecret,
+			Debug:               true,
+			RequestIDFunc:       data.requestIDFunc,
+			Logf:                func(format string, v ...any) { lines = append(lines, fmt.Sprintf(format, v...)) },
+			GroupcacheWorkspace: groupcache.NewWorkspace(),
+		})
+
+		req, errReq := http.NewRequestWithContext(data.ctx, "GET", srv.URL, nil)
+		if errReq != nil {
+			t.Fatalf("%s: request: %v", data.name, errReq)
+		}
+		if data.traceparent != "" {
+			req.Header.Set("traceparent", data.traceparent)
+		}
+		resp, errDo := client.Do(req)
+		if errDo != nil {
+			t.Fatalf("%s: do: %v", data.name, errDo)
+		}
+		resp.Body.Close()
+		client.Close()
+
+		var fetch, elapsed bool
+		for _, line := range lines {
+			if strings.HasPrefix(line, "DEBUG: token response: cache_event=token_fetch") {
+				fetch = true
+				if got := strings.Contains(line, " request_id="+data.expect+" "); got != (data.expect != "") {
+					t.Errorf("%s: unexpected request id: %s", data.name, line)
+				}
+			}
+			if strings.Contains(line, "elapsed:") {
+				elapsed = true
+				if data.expect != "" && !strings.HasPrefix(line, "DEBUG: request_id="+data.expect+" ") {
+					t.Errorf("%s: missing request id: %s", data.name, line)
+				}
+				if data.expect == "" && strings.Contains(line, "request_id=") {
+					t.Errorf("%s: unexpected request id: %s", data.name, line)
+				}
+			}
+		}
+		if !fetch || !elapsed {
+			t.Errorf("%s: missing token fetch log lines: %q", data.name, lines)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package clientcredentials
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metrics holds client metrics. Metrics are always created, but only
+// registered when Options.MetricsRegisterer is defined, and mirrored to
+// OpenTelemetry when Options.MeterProvider is defined.
+type metrics struct {
+	staleTokenServed     counter
+	staleWhileRevalidate counter
+
+	// tokenWaiting counts requests waiting for a token, either from
+	// the cache or from a fetch shared with concurrent requests.
+	tokenWaiting     *gauge
+	tokenWaitSeconds histogram
+
+	tokenFetchInFlight *gauge
+	tokenFetchQueued   *gauge
+	tokenFetchRetries  counter
+
+	requestsInFlight *gauge
+	requestSeconds   histogram
+
+	refreshAhead counterVec
+
+	fallback counterVec
+
+	consistency counterVec
+
+	identities         *gauge
+	identityEvictions  counter
+	identityRejections counter
+
+	// metrics below are labeled by client_id, see Options.MetricsClientIDLabel.
+	tokenFetches      counterVec
+	tokenFetchErrors  counterVec
+	tokenFetchSeconds histogramVec
+	tokenLookups      counterVec
+	tokenRejected     counterVec
+
+	// invalidCredentials is labeled by client_id and source, see
+	// Options.OnInvalidCredentials.
+	invalidCredentials counterVec
+
+	clientIDs *clientIDLabels
+}
+
+// registeredMetrics tracks metrics registered with Options.MetricsRegisterer,
+// so clients registering metrics for the same cache name share them
+// instead of failing on duplicate registration.
+var registeredMetrics = struct {
+	mutex   sync.Mutex
+	metrics map[registeredMetricsKey]*metrics
+}{metrics: map[registeredMetricsKey]*metrics{}}
+
+type registeredMetricsKey struct {
+	registerer prometheus.Registerer
+	namespace  string
+	cacheName  string
+}
+
+// sharedMetrics returns the metrics for cacheName, shared by clients
+// with the same Options.MetricsRegisterer and Options.MetricsNamespace.
+// Shared metrics keep the options of the client creating them.
+func sharedMetrics(options Options, cacheName string) *metrics {
+	if options.MetricsRegisterer == nil {
+		return newMetrics(options, cacheName)
+	}
+
+	key := registeredMetricsKey{
+		registerer: options.MetricsRegisterer,
+		namespace:  options.MetricsNamespace,
+		cacheName:  cacheName,
+	}
+
+	registeredMetrics.mutex.Lock()
+	defer registeredMetrics.mutex.Unlock()
+
+	m, found := registeredMetrics.metrics[key]
+	if !found {
+		m = newMetrics(options, cacheName)
+		registeredMetrics.metrics[key] = m
+	}
+
+	return m
+}
+
+func newMetrics(options Options, cacheName string) *metrics {
+	constLabels := prometheus.Labels{"cache": cacheName}
+	meter := otelMeter(options.MeterProvider)
+
+	m := &metrics{
+		staleTokenServed: newCounter(meter, prometheus.CounterOpts{
+			Namespace:   options.MetricsNamespace,
+			Name:        "groupcache_oauth2_stale_token_served_total",
+			Help:        "Number of expired tokens served during token server outage.",
+			ConstLabels: constLabels,
+		}),
+		staleWhileRevalidate: newCounter(meter, prometheus.CounterOpts{
+			Namespace:   options.MetricsNamespace,
+			Name:        "groupcache_oauth2_stale_while_revalidate_total",
+			Help:        "Number of expired tokens served while renewed in background.",
+			ConstLabels: constLabels,
+		}),
+		tokenWaiting: newGauge(meter, prometheus.GaugeOpts{
+			Namespace:   options.MetricsNamespace,
+			Name:        "groupcache_oauth2_token_waiting",
+			Help:        "Number of requests waiting for a token.",
+			ConstLabels: constLabels,
+		}),
+		tokenWaitSeconds: newHistogram(meter, prometheus.HistogramOpts{
+			Namespace:   options.MetricsNamespace,
+			Name:        "groupcache_oauth2_token_wait_seconds",
+			Help:        "Time requests spent waiting for a token.",
+			ConstLabels: constLabels,
+			Buckets:     []float64{0.0001, 0.001, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		}),
+		tokenFetchInFlight: newGauge(meter, prometheus.GaugeOpts{
+			Namespace:   options.MetricsNamespace,
+			Name:        "groupcache_oauth2_token_fetch_in_flight",
+			Help:        "Number of token requests in flight to the token server.",
+			ConstLabels: constLabels,
+		}),
+		tokenFetchQueued: newGauge(meter, prometheus.GaugeOpts{
+			Namespace:   options.MetricsNamespace,
+			Name:        "groupcache_oauth2_token_fetch_queued",
+			Help:        "Number of token requests waiting for a fetch slot.",
+			ConstLabels: constLabels,
+		}),
+		tokenFetchRetries: newCounter(meter, prometheus.CounterOpts{
+			Namespace:   options.MetricsNamespace,
+			Name:        "groupcache_oauth2_token_fetch_retries_total",
+			Help:        "Number of token requests retried after transient failures.",
+			ConstLabels: constLabels,
+		}),
+		requestsInFlight: newGauge(meter, prometheus.GaugeOpts{
+			Namespace:   options.MetricsNamespace,
+			Name:        "groupcache_oauth2_requests_in_flight",
+			Help:        "Number of requests in flight to the target server.",
+			ConstLabels: constLabels,
+		}),
+		requestSeconds: newHistogram(meter, prometheus.HistogramOpts{
+			Namespace:   options.MetricsNamespace,
+			Name:        "groupcache_oauth2_request_seconds",
+			Help:        "Time spent on requests to the target server.",
+			ConstLabels: constLabels,
+			Buckets:     []float64{0.001, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		}),
+		refreshAhead: newCounterVec(meter, prometheus.CounterOpts{
+			Namespace:   options.MetricsNamespace,
+			Name:        "groupcache_oauth2_refresh_ahead_total",
+			Help:        "Number of background token renewals by result.",
+			ConstLabels: constLabels,
+		}, []string{"result"}),
+		fallback: newCounterVec(meter, prometheus.CounterOpts{
+			Namespace:   options.MetricsNamespace,
+			Name:        "groupcache_oauth2_fallback_total",
+			Help:        "Number of degraded operations by reason.",
+			ConstLabels: constLabels,
+		}, []string{"reason"}),
+		consistency: newCounterVec(meter, prometheus.CounterOpts{
+			Namespace:   options.MetricsNamespace,
+			Name:        "groupcache_oauth2_consistency_checks_total",
+			Help:        "Number of cached keys compared against their owner peer, by result.",
+			ConstLabels: constLabels,
+		}, []string{"result"}),
+		identities: newGauge(meter, prometheus.GaugeOpts{
+			Namespace:   options.MetricsNamespace,
+			Name:        "groupcache_oauth2_identities",
+			Help:        "Number of derived client identities tracked by Options.MaxIdentities.",
+			ConstLabels: constLabels,
+		}),
+		identityEvictions: newCounter(meter, prometheus.CounterOpts{
+			Namespace:   options.MetricsNamespace,
+			Name:        "groupcache_oauth2_identity_evictions_total",
+			Help:        "Number of derived client identities evicted by Options.MaxIdentities.",
+			ConstLabels: constLabels,
+		}),
+		identityRejections: newCounter(meter, prometheus.CounterOpts{
+			Namespace:   options.MetricsNamespace,
+			Name:        "groupcache_oauth2_identity_rejections_total",
+			Help:        "Number of derived client identities rejected by Options.IdentityOverflow.",
+			ConstLabels: constLabels,
+		}),
+		tokenFetches: newCounterVec(meter, prometheus.CounterOpts{
+			Namespace:   options.MetricsNamespace,
+			Name:        "groupcache_oauth2_token_fetches_total",
+			Help:        "Number of token fetches from the token server, including retries, by result.",
+			ConstLabels: constLabels,
+		}, []string{"client_id", "result"}),
+		tokenFetchErrors: newCounterVec(meter, prometheus.CounterOpts{
+			Namespace:   options.MetricsNamespace,
+			Name:        "groupcache_oauth2_token_fetch_errors_total",
+			Help:        "Number of failed token fetches by reason.",
+			ConstLabels: constLabels,
+		}, []string{"client_id", "reason"}),
+		tokenFetchSeconds: newHistogramVec(meter, prometheus.HistogramOpts{
+			Namespace:   options.MetricsNamespace,
+			Name:        "groupcache_oauth2_token_fetch_seconds",
+			Help:        "Time spent fetching tokens from the token server, including retries.",
+			ConstLabels: constLabels,
+			Buckets:     []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		}, []string{"client_id"}),
+		tokenLookups: newCounterVec(meter, prometheus.CounterOpts{
+			Namespace:   options.MetricsNamespace,
+			Name:        "groupcache_oauth2_token_lookups_total",
+			Help:        "Number of token lookups by result: hit, miss (fetched for the request) or error.",
+			ConstLabels: constLabels,
+		}, []string{"client_id", "result"}),
+		tokenRejected: newCounterVec(meter, prometheus.CounterOpts{
+			Namespace:   options.MetricsNamespace,
+			Name:        "groupcache_oauth2_token_rejected_total",
+			Help:        "Number of tokens rejected by the target server, see Options.IsBadTokenResponse.",
+			ConstLabels: constLabels,
+		}, []string{"client_id"}),
+		invalidCredentials: newCounterVec(meter, prometheus.CounterOpts{
+			Namespace:   options.MetricsNamespace,
+			Name:        "groupcache_oauth2_invalid_credentials_total",
+			Help:        "Number of client credentials refused by the token server, by credential source.",
+			ConstLabels: constLabels,
+		}, []string{"client_id", "source"}),
+		clientIDs: newClientIDLabels(options.MetricsClientIDLabel, options.MetricsMaxClientIDs),
+	}
+
+	if options.MetricsRegisterer != nil {
+		options.MetricsRegisterer.MustRegister(
+			m.staleTokenServed,
+			m.staleWhileRevalidate,
+			m.tokenWaiting,
+			m.tokenWaitSeconds,
+			m.tokenFetchInFlight,
+			m.tokenFetchQueued,
+			m.tokenFetchRetries,
+			m.requestsInFlight,
+			m.requestSeconds,
+			m.refreshAhead,
+			m.fallback,
+			m.consistency,
+			m.identities,
+			m.identityEvictions,
+			m.identityRejections,
+			m.tokenFetches,
+			m.tokenFetchErrors,
+			m.tokenFetchSeconds,
+			m.tokenLookups,
+			m.tokenRejected,
+			m.invalidCredentials,
+		)
+	}
+
+	return m
+}
+
+// metricsOtherClientID labels client IDs beyond Options.MetricsMaxClientIDs.
+const metricsOtherClientID = "other"
+
+// clientIDLabels caps the cardinality of the client_id metric label.
+type clientIDLabels struct {
+	enabled bool
+	max     int
+
+	mutex sync.Mutex
+	seen  map[string]struct{}
+}
+
+func newClientIDLabels(enabled bool, maxClientIDs int) *clientIDLabels {
+	return &clientIDLabels{enabled: enabled, max: maxClientIDs, seen: map[string]struct{}{}}
+}
+
+// label returns the client_id label value: empty unless enabled,
+// and metricsOtherClientID beyond the cap.
+func (l *clientIDLabels) label(clientID string) string {
+	if !l.enabled {
+		return ""
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if _, found := l.seen[clientID]; found {
+		return clientID
+	}
+	if len(l.seen) >= l.max {
+		return metricsOtherClientID
+	}
+	l.seen[clientID] = struct{}{}
+	return clientID
+}
+
+// observeFetch records a token fetch, with its retries.
+func (m *metrics) observeFetch(clientID string, elapsed time.Duration, err error) {
+	label := m.clientIDs.label(clientID)
+	m.tokenFetchSeconds.WithLabelValues(label).Observe(elapsed.Seconds())
+	if err == nil {
+		m.tokenFetches.WithLabelValues(label, "ok").Inc()
+		return
+	}
+	m.tokenFetches.WithLabelValues(label, "error").Inc()
+	m.tokenFetchErrors.WithLabelValues(label, fetchErrorReason(err)).Inc()
+}
+
+// observeLookup records a token lookup result: hit, miss or error.
+func (m *metrics) observeLookup(clientID, result string) {
+	m.tokenLookups.WithLabelValues(m.clientIDs.label(clientID), result).Inc()
+}
+
+// observeRejected records a token rejected by the target server.
+func (m *metrics) observeRejected(clientID string) {
+	m.tokenRejected.WithLabelValues(m.clientIDs.label(clientID)).Inc()
+}
+
+// fetchErrorReason classifies token fetch errors for metrics.
+func fetchErrorReason(err error) string {
+	var rateErr *RateLimitError
+	var statusErr *StatusError
+	var urlErr *url.Error
+	switch {
+	case errors.As(err, &rateErr):
+		return "rate_limited"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, ErrInvalidClient):
+		return "invalid_client"
+	case errors.As(err, &statusErr):
+		if statusErr.StatusCode >= http.StatusInternalServerError {
+			return "status_5xx"
+		}
+		return "status_4xx"
+	case errors.As(err, &urlErr):
+		return "network"
+	}
+	return "other"
+}
@@ -0,0 +1,290 @@
+package clientcredentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/modernprogram/groupcache/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestWaitMetrics(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "abc"
+	expireIn := 60
+
+	tokenServerStat := serverStat{}
+	serverStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, token, expireIn)
+	defer ts.Close()
+
+	srv := newServer(&serverStat, func(t string) bool { return t == token })
+	defer srv.Close()
+
+	registry := prometheus.NewRegistry()
+
+	options := Options{
+		TokenURL:            ts.URL,
+		ClientID:            clientID,
+		ClientSecret:        clientSecret,
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+		MetricsRegisterer:   registry,
+	}
+
+	client := New(options)
+
+	for i := range 3 {
+		if _, errSend := send(client, srv.URL); errSend != nil {
+			t.Errorf("send %d: %v", i, errSend)
+		}
+	}
+
+	for _, g := range []prometheus.Gauge{
+		client.metrics.tokenWaiting,
+		client.metrics.tokenFetchInFlight,
+		client.metrics.requestsInFlight,
+	} {
+		if v := testutil.ToFloat64(g); v != 0 {
+			t.Errorf("unexpected non-zero gauge: %v", v)
+		}
+	}
+
+	got, errGather := registry.Gather()
+	if errGather != nil {
+		t.Fatalf("gather: %v", errGather)
+	}
+	samples := map[string]uint64{}
+	for _, mf := range got {
+		for _, m := range mf.GetMetric() {
+			if h := m.GetHistogram(); h != nil {
+				samples[mf.GetName()] = h.GetSampleCount()
+			}
+		}
+	}
+	if samples["groupcache_oauth2_token_wait_seconds"] != 3 {
+		t.Errorf("unexpected token wait samples: %d", samples["groupcache_oauth2_token_wait_seconds"])
+	}
+	if samples["groupcache_oauth2_request_seconds"] != 3 {
+		t.Errorf("unexpected request samples: %d", samples["groupcache_oauth2_request_seconds"])
+	}
+}
+
+func TestClientMetrics(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		clientID := formParam(r, "client_id")
+		if clientID == "bad" {
+			httpJSON(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		httpJSON(w, `{"access_token":"`+clientID+`","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	// the server rejects tenant2 tokens
+	srv := newServer(&serverStat{}, func(t string) bool { return t != "tenant2" })
+	defer srv.Close()
+
+	client := New(Options{
+		TokenURL:             ts.URL,
+		ClientID:             "root",
+		ClientSecret:         "secret",
+		MetricsClientIDLabel: true,
+		MetricsMaxClientIDs:  3,
+		GroupcacheWorkspace:  groupcache.NewWorkspace(),
+	})
+	defer client.Close()
+
+	for _, clientID := range []string{"root", "root", "tenant1", "tenant2", "bad", "tenant3"} {
+		send(client.WithCredentials(clientID, "secret"), srv.URL)
+	}
+
+	m := client.metrics
+
+	table := []struct {
+		name   string
+		metric prometheus.Collector
+		expect float64
+	}{
+		{"root fetches", m.tokenFetches.WithLabelValues("root", "ok"), 1},
+		{"root hits", m.tokenLookups.WithLabelValues("root", "hit"), 1},
+		{"root misses", m.tokenLookups.WithLabelValues("root", "miss"), 1},
+		{"tenant1 fetches", m.tokenFetches.WithLabelValues("tenant1", "ok"), 1},
+		{"tenant2 rejected", m.tokenRejected.WithLabelValues("tenant2"), 1},
+		{"root rejected", m.tokenRejected.WithLabelValues("root"), 0},
+		{"other fetch errors", m.tokenFetchErrors.WithLabelValues("other", "invalid_client"), 1},
+		{"other lookup errors", m.tokenLookups.WithLabelValues("other", "error"), 1},
+		{"other fetches", m.tokenFetches.WithLabelValues("other", "ok"), 1},
+	}
+
+	for _, data := range table {
+		if got := testutil.ToFloat64(data.metric); got != data.expect {
+			t.Errorf("%s: expected %v, got %v", data.name, data.expect, got)
+		}
+	}
+
+	if n := testutil.CollectAndCount(m.tokenFetchSeconds); n != 4 {
+		t.Errorf("expected 4 client_id label values, got %d", n)
+	}
+}
+
+func TestMetricsSharedRegisterer(t *testing.T) {
+
+	ts := newTokenServer(&serverStat{}, "clientID", "clientSecret", "abc", 60)
+	defer ts.Close()
+
+	registry := prometheus.NewRegistry()
+
+	newClientWith := func(options Options) *Client {
+		options.TokenURL = ts.URL
+		options.ClientID = "clientID"
+		options.ClientSecret = "clientSecret"
+		options.MetricsRegisterer = registry
+		return New(options)
+	}
+
+	cache := NewMemoryTokenCache()
+
+	c1 := newClientWith(Options{TokenCache: cache})
+	defer c1.Close()
+	c2 := newClientWith(Options{TokenCache: cache})
+	defer c2.Close()
+
+	for i, c := range []*Client{c1, c2} {
+		if _, errTok := c.Token(context.TODO()); errTok != nil {
+			t.Errorf("client %d: token: %v", i, errTok)
+		}
+	}
+
+	if c1.metrics != c2.metrics {
+		t.Errorf("expected shared metrics")
+	}
+	if n := testutil.ToFloat64(c1.metrics.tokenLookups.WithLabelValues("", "hit")); n != 1 {
+		t.Errorf("expected 1 shared cache hit, got %v", n)
+	}
+
+	// the group is recreated after the last client closes
+	ws := groupcache.NewWorkspace()
+	for i := range 2 {
+		c := newClientWith(Options{GroupcacheWorkspace: ws})
+		if _, errTok := c.Token(context.TODO()); errTok != nil {
+			t.Errorf("group client %d: token: %v", i, errTok)
+		}
+		c.Close()
+	}
+}
+
+func TestFetchErrorReason(t *testing.T) {
+
+	table := []struct {
+		err    error
+		expect string
+	}{
+		{&RateLimitError{ClientID: "id"}, "rate_limited"},
+		{fmt.Errorf("wrapped: %w", context.DeadlineExceeded), "timeout"},
+		{context.Canceled, "canceled"},
+		{&StatusError{StatusCode: 401, OAuth: &OAuthError{Code: "invalid_client"}}, "invalid_client"},
+		{&StatusError{StatusCode: 503}, "status_5xx"},
+		{&StatusError{StatusCode: 400}, "status_4xx"},
+		{&url.Error{Op: "Post", URL: "http://token", Err: errors.New("connection refused")}, "network"},
+		{errors.New("bad json"), "other"},
+	}
+
+	for _, data := range table {
+		if got := fetchErrorReason(data.err); got != data.expect {
+			t.Errorf("%v: expected %s, got %s", data.err, data.expect, got)
+		}
+	}
+}
+
+func TestMeterProvider(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "abc"
+
+	ts := newTokenServer(&serverStat{}, clientID, clientSecret, token, 60)
+	defer ts.Close()
+
+	srv := newServer(&serverStat{}, func(t string) bool { return t == token })
+	defer srv.Close()
+
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	registry := prometheus.NewRegistry()
+
+	client := New(Options{
+		TokenURL:            ts.URL,
+		ClientID:            clientID,
+		ClientSecret:        clientSecret,
+		MetricsRegisterer:   registry,
+		MeterProvider:       mp,
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+	defer client.Close()
+
+	for i := range 3 {
+		if _, errSend := send(client, srv.URL); errSend != nil {
+			t.Fatalf("send %d: %v", i, errSend)
+		}
+	}
+
+	var rm metricdata.ResourceMetrics
+	if errCollect := reader.Collect(context.TODO(), &rm); errCollect != nil {
+		t.Fatalf("collect: %v", errCollect)
+	}
+
+	sums := map[string]float64{}
+	counts := map[string]uint64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[float64]:
+				for _, dp := range data.DataPoints {
+					sums[m.Name] += dp.Value
+				}
+			case metricdata.Histogram[float64]:
+				for _, dp := range data.DataPoints {
+					counts[m.Name] += dp.Count
+				}
+			}
+		}
+	}
+
+	table := []struct {
+		name   string
+		expect float64
+		got    float64
+	}{
+		{"token fetches", 1, sums["groupcache_oauth2_token_fetches"]},
+		{"token lookups", 3, sums["groupcache_oauth2_token_lookups"]},
+		{"requests in flight", 0, sums["groupcache_oauth2_requests_in_flight"]},
+		{"token wait samples", 3, float64(counts["groupcache_oauth2_token_wait_seconds"])},
+		{"request samples", 3, float64(counts["groupcache_oauth2_request_seconds"])},
+		{"token fetch samples", 1, float64(counts["groupcache_oauth2_token_fetch_seconds"])},
+	}
+
+	for _, data := range table {
+		if data.got != data.expect {
+			t.Errorf("%s: expected %v, got %v", data.name, data.expect, data.got)
+		}
+	}
+
+	// the prometheus path keeps working
+	if v := testutil.ToFloat64(client.metrics.tokenLookups.WithLabelValues("", "hit")); v != 2 {
+		t.Errorf("expected 2 prometheus lookup hits, got %v", v)
+	}
+}
@@ -0,0 +1,26 @@
+package clientcredentials
+
+import "net/http"
+
+// HTTPClientDoerFunc is an adapter to allow the use of ordinary
+// functions as HTTPClientDoer.
+type HTTPClientDoerFunc func(req *http.Request) (*http.Response, error)
+
+// Do calls f(req).
+func (f HTTPClientDoerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware wraps the HTTP client sending requests to the target server,
+// e.g. to add tracing headers, log requests or post-process responses.
+// See Options.Middlewares.
+type Middleware func(next HTTPClientDoer) HTTPClientDoer
+
+// chain wraps doer with middlewares, the first middleware being the
+// outermost, thus the first to see the request.
+func chain(doer HTTPClientDoer, middlewares []Middleware) HTTPClientDoer {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		doer = middlewares[i](doer)
+	}
+	return doer
+}
@@ -0,0 +1,107 @@
+package clientcredentials
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+func TestMiddlewares(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+
+	tokenServerStat := serverStat{}
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, "abc", 60)
+	defer ts.Close()
+
+	serverStat := serverStat{}
+	srv := newServer(&serverStat, func(t string) bool { return t == "abc" })
+	defer srv.Close()
+
+	var calls []string
+
+	named := func(name string) Middleware {
+		return func(next HTTPClientDoer) HTTPClientDoer {
+			return HTTPClientDoerFunc(func(req *http.Request) (*http.Response, error) {
+				calls = append(calls, name+":"+req.Header.Get("Authorization"))
+				return next.Do(req)
+			})
+		}
+	}
+
+	client := New(Options{
+		TokenURL:            ts.URL,
+		ClientID:            clientID,
+		ClientSecret:        clientSecret,
+		Middlewares:         []Middleware{named("outer"), named("inner")},
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+
+	for _, c := range []*Client{client, client.WithScope("other")} {
+		if _, errSend := send(c, srv.URL); errSend != nil {
+			t.Fatalf("send: %v", errSend)
+		}
+	}
+
+	expect := "outer:Bearer abc,inner:Bearer abc,outer:Bearer abc,inner:Bearer abc"
+	if got := strings.Join(calls, ","); got != expect {
+		t.Errorf("expected calls %s, got %s", expect, got)
+	}
+
+	if tokenServerStat.count != 2 {
+		t.Errorf("expected 2 token requests, got %d", tokenServerStat.count)
+	}
+}
+
+func TestMiddlewareModifiesAuthorization(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+
+	tokenServerStat := serverStat{}
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, "abc", 60)
+	defer ts.Close()
+
+	serverStat := serverStat{}
+	srv := newServer(&serverStat, func(t string) bool { return t == "abc" })
+	defer srv.Close()
+
+	var seen []string
+
+	// tamper modifies the Authorization header in place
+	tamper := func(next HTTPClientDoer) HTTPClientDoer {
+		return HTTPClientDoerFunc(func(req *http.Request) (*http.Response, error) {
+			seen = append(seen, req.Header.Get("Authorization"))
+			req.Header["Authorization"][0] = "Bearer tampered"
+			return next.Do(req)
+		})
+	}
+
+	client := New(Options{
+		TokenURL:            ts.URL,
+		ClientID:            clientID,
+		ClientSecret:        clientSecret,
+		Middlewares:         []Middleware{tamper},
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+	defer client.Close()
+
+	for i := range 2 {
+		req, errReq := http.NewRequest("GET", srv.URL, nil)
+		if errReq != nil {
+			t.Fatalf("request %d: %v", i, errReq)
+		}
+		resp, errDo := client.Do(req)
+		if errDo != nil {
+			t.Fatalf("do %d: %v", i, errDo)
+		}
+		resp.Body.Close()
+	}
+
+	if got := strings.Join(seen, ","); got != "Bearer abc,Bearer abc" {
+		t.Errorf("cached token modified by request: %s", got)
+	}
+}
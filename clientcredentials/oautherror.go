@@ -0,0 +1,52 @@
+package clientcredentials
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// OAuthError is an RFC 6749 section 5.2 error response from the token
+// server, available from *StatusError with errors.As. Compare with the
+// Err* values using errors.Is, which matches on Code:
+//
+//	if errors.Is(err, clientcredentials.ErrInvalidClient) {
+//		// fix credentials
+//	}
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	URI         string `json:"error_uri,omitempty"`
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return "oauth2: " + e.Code
+	}
+	return fmt.Sprintf("oauth2: %s: %s", e.Code, e.Description)
+}
+
+// Is matches OAuthError values by Code.
+func (e *OAuthError) Is(target error) bool {
+	t, ok := target.(*OAuthError)
+	return ok && t.Code == e.Code
+}
+
+// RFC 6749 section 5.2 error codes.
+var (
+	ErrInvalidRequest       = &OAuthError{Code: "invalid_request"}
+	ErrInvalidClient        = &OAuthError{Code: "invalid_client"}
+	ErrInvalidGrant         = &OAuthError{Code: "invalid_grant"}
+	ErrUnauthorizedClient   = &OAuthError{Code: "unauthorized_client"}
+	ErrUnsupportedGrantType = &OAuthError{Code: "unsupported_grant_type"}
+	ErrInvalidScope         = &OAuthError{Code: "invalid_scope"}
+)
+
+// parseOAuthError extracts the RFC 6749 error from the token server
+// response body, or returns nil if the body carries none.
+func parseOAuthError(body []byte) *OAuthError {
+	var e OAuthError
+	if errJSON := json.Unmarshal(body, &e); errJSON != nil || e.Code == "" {
+		return nil
+	}
+	return &e
+}
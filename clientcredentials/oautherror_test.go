@@ -0,0 +1,64 @@
+package clientcredentials
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOAuthError(t *testing.T) {
+
+	table := []struct {
+		name        string
+		body        string
+		expectIs    error
+		expectNotIs error
+		expectDesc  string
+	}{
+		{"invalid client", `{"error":"invalid_client","error_description":"bad secret"}`, ErrInvalidClient, ErrInvalidScope, "bad secret"},
+		{"invalid scope", `{"error":"invalid_scope"}`, ErrInvalidScope, ErrInvalidClient, ""},
+		{"not oauth", `{"message":"denied"}`, nil, ErrInvalidClient, ""},
+		{"not json", `denied`, nil, ErrInvalidClient, ""},
+	}
+
+	for _, data := range table {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			httpJSON(w, data.body, http.StatusBadRequest)
+		}))
+
+		srv := newServer(&serverStat{}, func(string) bool { return true })
+
+		client := newClient(ts.URL, "clientID", "clientSecret", 0)
+
+		req, errReq := http.NewRequestWithContext(context.TODO(), "GET", srv.URL, nil)
+		if errReq != nil {
+			t.Fatalf("%s: request: %v", data.name, errReq)
+		}
+
+		_, errDo := client.Do(req)
+		if errDo == nil {
+			t.Fatalf("%s: expected error", data.name)
+		}
+
+		if data.expectIs != nil && !errors.Is(errDo, data.expectIs) {
+			t.Errorf("%s: expected error to match %v: %v", data.name, data.expectIs, errDo)
+		}
+		if errors.Is(errDo, data.expectNotIs) {
+			t.Errorf("%s: unexpected error match %v: %v", data.name, data.expectNotIs, errDo)
+		}
+
+		var oauthErr *OAuthError
+		found := errors.As(errDo, &oauthErr)
+		if found != (data.expectIs != nil) {
+			t.Errorf("%s: unexpected OAuthError presence: %t", data.name, found)
+		}
+		if found && oauthErr.Description != data.expectDesc {
+			t.Errorf("%s: expected description %q, got %q", data.name, data.expectDesc, oauthErr.Description)
+		}
+
+		srv.Close()
+		ts.Close()
+	}
+}
@@ -0,0 +1,226 @@
+package clientcredentials
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// The types below wrap Prometheus metrics, mirroring every update to an
+// OpenTelemetry instrument with Options.MeterProvider. The OpenTelemetry
+// instrument is nil otherwise. Instruments are named after the Prometheus
+// metrics, without the _total suffix for counters, and labels are
+// recorded as attributes.
+
+// otelMeter returns nil if mp is nil.
+func otelMeter(mp metric.MeterProvider) metric.Meter {
+	if mp == nil {
+		return nil
+	}
+	return mp.Meter(tracerName)
+}
+
+func otelName(namespace, name string) string {
+	if namespace != "" {
+		return namespace + "_" + name
+	}
+	return name
+}
+
+func otelUnit(name string) string {
+	if strings.HasSuffix(name, "_seconds") {
+		return "s"
+	}
+	return ""
+}
+
+func otelAttributes(constLabels prometheus.Labels, names, values []string) metric.MeasurementOption {
+	attrs := make([]attribute.KeyValue, 0, len(constLabels)+len(names))
+	for k, v := range constLabels {
+		attrs = append(attrs, attribute.String(k, v))
+	}
+	for i, k := range names {
+		attrs = append(attrs, attribute.String(k, values[i]))
+	}
+	return metric.WithAttributeSet(attribute.NewSet(attrs...))
+}
+
+func must[T any](instrument T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return instrument
+}
+
+type counter struct {
+	prometheus.Counter
+	otel  metric.Float64Counter
+	attrs metric.MeasurementOption
+}
+
+func newCounter(meter metric.Meter, opts prometheus.CounterOpts) counter {
+	c := counter{Counter: prometheus.NewCounter(opts)}
+	if meter != nil {
+		c.otel = must(meter.Float64Counter(
+			otelName(opts.Namespace, strings.TrimSuffix(opts.Name, "_total")),
+			metric.WithDescription(opts.Help)))
+		c.attrs = otelAttributes(opts.ConstLabels, nil, nil)
+	}
+	return c
+}
+
+func (c counter) Inc() {
+	c.Counter.Inc()
+	if c.otel != nil {
+		c.otel.Add(context.Background(), 1, c.attrs)
+	}
+}
+
+type counterVec struct {
+	*prometheus.CounterVec
+	otel        metric.Float64Counter
+	constLabels prometheus.Labels
+	labelNames  []string
+}
+
+func newCounterVec(meter metric.Meter, opts prometheus.CounterOpts, labelNames []string) counterVec {
+	c := counterVec{
+		CounterVec:  prometheus.NewCounterVec(opts, labelNames),
+		constLabels: opts.ConstLabels,
+		labelNames:  labelNames,
+	}
+	if meter != nil {
+		c.otel = must(meter.Float64Counter(
+			otelName(opts.Namespace, strings.TrimSuffix(opts.Name, "_total")),
+			metric.WithDescription(opts.Help)))
+	}
+	return c
+}
+
+func (c counterVec) WithLabelValues(lvs ...string) counter {
+	cnt := counter{Counter: c.CounterVec.WithLabelValues(lvs...), otel: c.otel}
+	if c.otel != nil {
+		cnt.attrs = otelAttributes(c.constLabels, c.labelNames, lvs)
+	}
+	return cnt
+}
+
+// gauge tracks its value, since OpenTelemetry up-down counters
+// record deltas.
+type gauge struct {
+	prometheus.Gauge
+	otel  metric.Float64UpDownCounter
+	attrs metric.MeasurementOption
+
+	mutex sync.Mutex
+	value float64
+}
+
+func newGauge(meter metric.Meter, opts prometheus.GaugeOpts) *gauge {
+	g := &gauge{Gauge: prometheus.NewGauge(opts)}
+	if meter != nil {
+		g.otel = must(meter.Float64UpDownCounter(otelName(opts.Namespace, opts.Name),
+			metric.WithDescription(opts.Help)))
+		g.attrs = otelAttributes(opts.ConstLabels, nil, nil)
+	}
+	return g
+}
+
+func (g *gauge) Inc() {
+	g.Gauge.Inc()
+	if g.otel != nil {
+		g.otel.Add(context.Background(), 1, g.attrs)
+	}
+}
+
+func (g *gauge) Dec() {
+	g.Gauge.Dec()
+	if g.otel != nil {
+		g.otel.Add(context.Background(), -1, g.attrs)
+	}
+}
+
+func (g *gauge) Set(v float64) {
+	g.Gauge.Set(v)
+	if g.otel != nil {
+		g.mutex.Lock()
+		delta := v - g.value
+		g.value = v
+		g.mutex.Unlock()
+		g.otel.Add(context.Background(), delta, g.attrs)
+	}
+}
+
+type histogram struct {
+	prometheus.Histogram
+	otel  metric.Float64Histogram
+	attrs metric.MeasurementOption
+}
+
+func newOtelHistogram(meter metric.Meter, opts prometheus.HistogramOpts) metric.Float64Histogram {
+	return must(meter.Float64Histogram(otelName(opts.Namespace, opts.Name),
+		metric.WithDescription(opts.Help),
+		metric.WithUnit(otelUnit(opts.Name)),
+		metric.WithExplicitBucketBoundaries(opts.Buckets...)))
+}
+
+func newHistogram(meter metric.Meter, opts prometheus.HistogramOpts) histogram {
+	h := histogram{Histogram: prometheus.NewHistogram(opts)}
+	if meter != nil {
+		h.otel = newOtelHistogram(meter, opts)
+		h.attrs = otelAttributes(opts.ConstLabels, nil, nil)
+	}
+	return h
+}
+
+func (h histogram) Observe(v float64) {
+	h.Histogram.Observe(v)
+	if h.otel != nil {
+		h.otel.Record(context.Background(), v, h.attrs)
+	}
+}
+
+// observer is a labeled histogram from histogramVec.
+type observer struct {
+	prometheus.Observer
+	otel  metric.Float64Histogram
+	attrs metric.MeasurementOption
+}
+
+func (o observer) Observe(v float64) {
+	o.Observer.Observe(v)
+	if o.otel != nil {
+		o.otel.Record(context.Background(), v, o.attrs)
+	}
+}
+
+type histogramVec struct {
+	*prometheus.HistogramVec
+	otel        metric.Float64Histogram
+	constLabels prometheus.Labels
+	labelNames  []string
+}
+
+func newHistogramVec(meter metric.Meter, opts prometheus.HistogramOpts, labelNames []string) histogramVec {
+	h := histogramVec{
+		HistogramVec: prometheus.NewHistogramVec(opts, labelNames),
+		constLabels:  opts.ConstLabels,
+		labelNames:   labelNames,
+	}
+	if meter != nil {
+		h.otel = newOtelHistogram(meter, opts)
+	}
+	return h
+}
+
+func (h histogramVec) WithLabelValues(lvs ...string) observer {
+	o := observer{Observer: h.HistogramVec.WithLabelValues(lvs...), otel: h.otel}
+	if h.otel != nil {
+		o.attrs = otelAttributes(h.constLabels, h.labelNames, lvs)
+	}
+	return o
+}
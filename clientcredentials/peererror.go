@@ -0,0 +1,138 @@
+package clientcredentials
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+// peerErrorPrefix marks token load errors encoded for requesting peers,
+// since groupcache relays only the error message, see
+// groupcache.ErrRemoteCall.
+const peerErrorPrefix = "oauth2-load-error:"
+
+// peerLoadError wraps token load failures returned by the groupcache
+// getter. Its message encodes the failure for requesting peers, which
+// rebuild it, see peerError; local callers unwrap it.
+type peerLoadError struct {
+	err error
+}
+
+func (e *peerLoadError) Error() string {
+	info := peerErrorInfo{Msg: e.err.Error()}
+	var statusErr *StatusError
+	var netErr net.Error
+	switch {
+	case errors.As(e.err, &statusErr):
+		info.Status = statusErr.StatusCode
+		info.Body = statusErr.Body
+		info.RetryAfter = statusErr.RetryAfter.Milliseconds()
+	case errors.Is(e.err, context.DeadlineExceeded):
+		info.Timeout = true
+	case errors.As(e.err, &netErr):
+		info.Network = true
+		info.Timeout = netErr.Timeout()
+	}
+	buf, _ := json.Marshal(info)
+	return peerErrorPrefix + string(buf)
+}
+
+func (e *peerLoadError) Unwrap() error {
+	return e.err
+}
+
+// peerErrorInfo is the encoded token load failure.
+type peerErrorInfo struct {
+	Msg        string `json:"m"`
+	Status     int    `json:"s,omitempty"`
+	Body       string `json:"b,omitempty"`
+	RetryAfter int64  `json:"r,omitempty"` // milliseconds
+	Network    bool   `json:"n,omitempty"`
+	Timeout    bool   `json:"t,omitempty"`
+}
+
+// peerNetError rebuilds a network error reaching the token server
+// from the owner peer.
+type peerNetError struct {
+	msg     string
+	timeout bool
+}
+
+func (e *peerNetError) Error() string {
+	return e.msg
+}
+
+func (e *peerNetError) Timeout() bool {
+	return e.timeout
+}
+
+func (e *peerNetError) Temporary() bool {
+	return false
+}
+
+// peerTimeoutError rebuilds a deadline exceeded on the owner peer,
+// matching context.DeadlineExceeded with errors.Is. Like
+// context.DeadlineExceeded, it is a net.Error.
+type peerTimeoutError struct {
+	msg string
+}
+
+func (e *peerTimeoutError) Error() string {
+	return e.msg
+}
+
+func (e *peerTimeoutError) Timeout() bool {
+	return true
+}
+
+func (e *peerTimeoutError) Temporary() bool {
+	return true
+}
+
+func (e *peerTimeoutError) Is(target error) bool {
+	return target == context.DeadlineExceeded
+}
+
+// peerError returns the token load failure from a groupcache Get: the
+// local error, unwrapped, or the error relayed by the owner peer,
+// rebuilt as *StatusError or net.Error. Other relayed errors keep only
+// their message.
+func peerError(err error) error {
+	var local *peerLoadError
+	if errors.As(err, &local) {
+		return local.err
+	}
+
+	var remote *groupcache.ErrRemoteCall
+	if !errors.As(err, &remote) {
+		return err
+	}
+	encoded, found := strings.CutPrefix(remote.Msg, peerErrorPrefix)
+	if !found {
+		return err
+	}
+	var info peerErrorInfo
+	if errJSON := json.Unmarshal([]byte(encoded), &info); errJSON != nil {
+		return err
+	}
+
+	switch {
+	case info.Status != 0:
+		return &StatusError{
+			StatusCode: info.Status,
+			Body:       info.Body,
+			RetryAfter: time.Duration(info.RetryAfter) * time.Millisecond,
+			OAuth:      parseOAuthError([]byte(info.Body)),
+		}
+	case info.Network:
+		return &peerNetError{msg: info.Msg, timeout: info.Timeout}
+	case info.Timeout:
+		return &peerTimeoutError{msg: info.Msg}
+	}
+	return &groupcache.ErrRemoteCall{Msg: info.Msg}
+}
@@ -0,0 +1,80 @@
+package clientcredentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+func TestPeerErrorTyped(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Retry-After", "2")
+		httpJSON(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+
+	var clients []*Client
+	for _, ws := range newPeers(t, 2) {
+		client := New(Options{
+			TokenURL:            ts.URL,
+			ClientID:            "clientID",
+			ClientSecret:        "clientSecret",
+			GroupcacheWorkspace: ws,
+		})
+		defer client.Close()
+		clients = append(clients, client)
+	}
+
+	for i, client := range clients {
+		// one of the peers gets the error relayed by the owner peer
+		_, errToken := client.Token(context.TODO())
+
+		var errStatus *StatusError
+		if !errors.As(errToken, &errStatus) || errStatus.StatusCode != http.StatusUnauthorized {
+			t.Errorf("peer %d: expected *StatusError 401, got: %v", i, errToken)
+			continue
+		}
+		if !errors.Is(errToken, ErrInvalidClient) {
+			t.Errorf("peer %d: expected ErrInvalidClient: %v", i, errToken)
+		}
+		if errStatus.RetryAfter.Seconds() != 2 {
+			t.Errorf("peer %d: unexpected retry after: %v", i, errStatus.RetryAfter)
+		}
+	}
+}
+
+func TestPeerErrorRebuild(t *testing.T) {
+
+	netErr := relayPeerError(&net.OpError{Op: "dial", Err: errors.New("connection refused")})
+	var errNet net.Error
+	if !errors.As(netErr, &errNet) || errNet.Timeout() {
+		t.Errorf("expected non-timeout net.Error: %v", netErr)
+	}
+
+	timeoutErr := relayPeerError(fmt.Errorf("wait: %w", context.DeadlineExceeded))
+	if !errors.Is(timeoutErr, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded: %v", timeoutErr)
+	}
+
+	otherErr := relayPeerError(errors.New("other"))
+	if !errors.Is(otherErr, &groupcache.ErrRemoteCall{}) || otherErr.Error() != "other" {
+		t.Errorf("expected relayed message: %v", otherErr)
+	}
+
+	local := errors.New("local")
+	if got := peerError(&peerLoadError{err: local}); got != local {
+		t.Errorf("expected local error unwrapped: %v", got)
+	}
+
+	unknown := &groupcache.ErrRemoteCall{Msg: "unknown cache key: k"}
+	if got := peerError(unknown); got != error(unknown) {
+		t.Errorf("expected unknown relayed error unchanged: %v", got)
+	}
+}
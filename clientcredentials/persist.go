@@ -0,0 +1,146 @@
+package clientcredentials
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// persistStore keeps a copy of cached values on disk, one file per key,
+// so a restarted instance can reuse still-valid tokens.
+type persistStore struct {
+	dir string
+}
+
+type persistEntry struct {
+	Value  string `json:"v"`
+	Expire int64  `json:"e"` // cache expiration, unix milliseconds
+}
+
+func newPersistStore(dir string) (*persistStore, error) {
+	if errMkdir := os.MkdirAll(dir, 0o700); errMkdir != nil {
+		return nil, errMkdir
+	}
+	return &persistStore{dir: dir}, nil
+}
+
+// path hashes the key, which may hold arbitrary characters.
+func (p *persistStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(p.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// load retrieves an unexpired value for key.
+func (p *persistStore) load(key string) (string, time.Time, bool, error) {
+	buf, errRead := os.ReadFile(p.path(key))
+	if errors.Is(errRead, fs.ErrNotExist) {
+		return "", time.Time{}, false, nil
+	}
+	if errRead != nil {
+		return "", time.Time{}, false, errRead
+	}
+	var e persistEntry
+	if errJSON := json.Unmarshal(buf, &e); errJSON != nil {
+		return "", time.Time{}, false, errJSON
+	}
+	expire := time.UnixMilli(e.Expire)
+	if !time.Now().Before(expire) {
+		return "", time.Time{}, false, nil
+	}
+	return e.Value, expire, true, nil
+}
+
+// save writes the value atomically, readable only by the owner
+// since it holds the access token.
+func (p *persistStore) save(key, value string, expire time.Time) error {
+	if expire.IsZero() {
+		return nil // never expiring tokens are not persisted
+	}
+	buf, errJSON := json.Marshal(persistEntry{Value: value, Expire: expire.UnixMilli()})
+	if errJSON != nil {
+		return errJSON
+	}
+	f, errTemp := os.CreateTemp(p.dir, ".tmp-*")
+	if errTemp != nil {
+		return errTemp
+	}
+	_, errWrite := f.Write(buf)
+	errClose := f.Close()
+	if errWrite == nil {
+		errWrite = errClose
+	}
+	if errWrite == nil {
+		errWrite = os.Rename(f.Name(), p.path(key))
+	}
+	if errWrite != nil {
+		os.Remove(f.Name())
+	}
+	return errWrite
+}
+
+func (p *persistStore) remove(key string) error {
+	errRemove := os.Remove(p.path(key))
+	if errors.Is(errRemove, fs.ErrNotExist) {
+		return nil
+	}
+	return errRemove
+}
+
+// loadValue is the cache load function. With Options.PersistDir,
+// a still-valid persisted value is reused before fetching a new token,
+// and fetched values are persisted.
+func (c *Client) loadValue(ctx context.Context) (string, time.Time, error) {
+	if c.persist == nil {
+		return c.fetchValue(ctx)
+	}
+
+	key := c.cacheKey()
+
+	value, expire, found, errLoad := c.persist.load(key)
+	if errLoad != nil {
+		c.errorfCtx(ctx, "persist load: key=%s: %v", key, errLoad)
+	}
+	if found {
+		tracerFrom(ctx).add(TracePersistedToken, "")
+		return value, expire, nil
+	}
+
+	value, expire, errFetch := c.fetchValue(ctx)
+	if errFetch != nil {
+		return value, expire, errFetch
+	}
+
+	c.savePersisted(key, value, expire)
+
+	return value, expire, nil
+}
+
+func (c *Client) savePersisted(key, value string, expire time.Time) {
+	if c.persist == nil {
+		return
+	}
+	if errSave := c.persist.save(key, value, expire); errSave != nil {
+		c.errorf("persist save: key=%s: %v", key, errSave)
+	}
+}
+
+// evict removes the token for key from the cache and all token stores.
+func (c *Client) evict(ctx context.Context, key string) {
+	if errRemove := c.cache.Remove(ctx, key); errRemove != nil {
+		c.errorf("cache remove error: %v", errRemove)
+	}
+	c.tokens.remove(key)
+	c.local.Delete(key)
+	c.decoded.Delete(key)
+	if c.persist != nil {
+		if errRemove := c.persist.remove(key); errRemove != nil {
+			c.errorf("persist remove: key=%s: %v", key, errRemove)
+		}
+	}
+}
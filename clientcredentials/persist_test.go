@@ -0,0 +1,75 @@
+package clientcredentials
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+func TestPersistDir(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "abc"
+	expireIn := 60
+
+	tokenServerStat := serverStat{}
+	serverStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, token, expireIn)
+	defer ts.Close()
+
+	validToken := token
+	srv := newServer(&serverStat, func(t string) bool { return t == validToken })
+	defer srv.Close()
+
+	dir := t.TempDir()
+
+	newPersistClient := func() *Client {
+		return New(Options{
+			TokenURL:            ts.URL,
+			ClientID:            clientID,
+			ClientSecret:        clientSecret,
+			PersistDir:          dir,
+			GroupcacheWorkspace: groupcache.NewWorkspace(),
+		})
+	}
+
+	if _, errSend := send(newPersistClient(), srv.URL); errSend != nil {
+		t.Errorf("send 1: %v", errSend)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("unexpected persisted files: %v", files)
+	}
+	if info, errStat := os.Stat(files[0]); errStat != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("unexpected persisted file mode: %v %v", info, errStat)
+	}
+
+	// restarted instance reuses persisted token
+
+	restarted := newPersistClient()
+
+	if _, errSend := send(restarted, srv.URL); errSend != nil {
+		t.Errorf("send 2: %v", errSend)
+	}
+	if tokenServerStat.count != 1 {
+		t.Errorf("unexpected token server access count: %d", tokenServerStat.count)
+	}
+
+	// rejected token is removed from disk
+
+	validToken = "other"
+
+	if _, errSend := send(restarted, srv.URL); errSend == nil {
+		t.Errorf("send 3: unexpected success")
+	}
+
+	files, _ = filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 0 {
+		t.Errorf("rejected token still persisted: %v", files)
+	}
+}
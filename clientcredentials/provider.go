@@ -0,0 +1,125 @@
+package clientcredentials
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// CredentialsProvider supplies client credentials per request, e.g. from
+// database lookups, per-host mapping or secret managers. See
+// Options.CredentialsProvider.
+type CredentialsProvider interface {
+	// Credentials returns the client credentials for the request.
+	// req is nil for tokens retrieved with Token or TokenSource.
+	Credentials(ctx context.Context, req *http.Request) (clientID, clientSecret string, err error)
+}
+
+// CredentialsProviderFunc is an adapter to allow the use of ordinary
+// functions as CredentialsProvider.
+type CredentialsProviderFunc func(ctx context.Context, req *http.Request) (string, string, error)
+
+// Credentials calls f(ctx, req).
+func (f CredentialsProviderFunc) Credentials(ctx context.Context, req *http.Request) (string, string, error) {
+	return f(ctx, req)
+}
+
+// forRequest returns the client for the request credentials, see
+// forRequestCredentials. The request token URL and scope, if any, are then
+// applied, see ContextWithTokenURL and ContextWithScope.
+// The credential source is one of the CredentialSource* constants.
+func (c *Client) forRequest(ctx context.Context, req *http.Request) (*Client, string, error) {
+	client, source, errCreds := c.forRequestCredentials(ctx, req)
+	if errCreds != nil {
+		return nil, source, errCreds
+	}
+	tokenURL, found, errURL := c.requestTokenURLOverride(ctx, req)
+	if errURL != nil {
+		return nil, source, errURL
+	}
+	if found {
+		client, errURL = client.forTokenURL(tokenURL)
+		if errURL != nil {
+			return nil, source, errURL
+		}
+	}
+	if scope, found := c.requestScope(ctx, req); found {
+		return client.forScope(scope), source, nil
+	}
+	return client, source, nil
+}
+
+// forRequestCredentials returns the client for the request credentials,
+// taken from ContextWithCredentials, then from Options.ExtractCredentials,
+// then from the Basic authorization header with Options.BasicAuthCredentials,
+// then from Options.CredentialsProvider, falling back to c itself.
+func (c *Client) forRequestCredentials(ctx context.Context, req *http.Request) (*Client, string, error) {
+	if creds, found := ctx.Value(credentialsKey{}).(contextCredentials); found {
+		return c.forCredentials(creds.clientID, creds.clientSecret), CredentialSourceContext, nil
+	}
+
+	if c.options.ExtractCredentials != nil && req != nil {
+		if clientID, clientSecret, ok := c.options.ExtractCredentials(req); ok {
+			return c.forCredentials(clientID, clientSecret), CredentialSourceExtract, nil
+		}
+	}
+
+	if c.hasBasicAuthCredentials(req) {
+		clientID, clientSecret, _ := req.BasicAuth()
+		return c.forCredentials(clientID, clientSecret), CredentialSourceBasicAuth, nil
+	}
+
+	if c.options.CredentialsProvider == nil {
+		return c, CredentialSourceOptions, nil
+	}
+
+	clientID, clientSecret, errCreds := c.options.CredentialsProvider.Credentials(ctx, req)
+	if errCreds != nil {
+		return nil, CredentialSourceProvider, fmt.Errorf("credentials provider: %w", errCreds)
+	}
+
+	return c.forCredentials(clientID, clientSecret), CredentialSourceProvider, nil
+}
+
+// requestScope retrieves the scope from ContextWithScope, then from
+// the Options.ScopeHeader request header.
+func (c *Client) requestScope(ctx context.Context, req *http.Request) (string, bool) {
+	if scope, found := ctx.Value(scopeKey{}).(string); found {
+		return scope, true
+	}
+	if c.options.ScopeHeader == "" || req == nil {
+		return "", false
+	}
+	if values, found := req.Header[c.options.ScopeHeader]; found && len(values) > 0 {
+		return values[0], true
+	}
+	return "", false
+}
+
+// forScope returns c if it already uses the scope,
+// otherwise the client derived with WithScope.
+func (c *Client) forScope(scope string) *Client {
+	if scope == c.options.Scope {
+		return c
+	}
+	return c.WithScope(scope)
+}
+
+// forCredentials returns c if it already uses the credentials,
+// otherwise the client derived with WithCredentials.
+func (c *Client) forCredentials(clientID, clientSecret string) *Client {
+	if clientID == c.options.ClientID && clientSecret == c.options.ClientSecret {
+		return c
+	}
+	return c.WithCredentials(clientID, clientSecret)
+}
+
+// hasBasicAuthCredentials checks if the request carries client credentials
+// in a Basic authorization header consumed by Options.BasicAuthCredentials.
+func (c *Client) hasBasicAuthCredentials(req *http.Request) bool {
+	if !c.options.BasicAuthCredentials || req == nil {
+		return false
+	}
+	_, _, found := req.BasicAuth()
+	return found
+}
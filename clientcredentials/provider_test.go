@@ -0,0 +1,429 @@
+package clientcredentials
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+func TestCredentialsProvider(t *testing.T) {
+
+	var fetches []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		clientID := formParam(r, "client_id")
+		fetches = append(fetches, clientID)
+		httpJSON(w, `{"access_token":"`+clientID+`","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	var gotToken string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotToken = r.Header.Get("Authorization")
+		httpJSON(w, `{"message":"ok"}`, http.StatusOK)
+	}))
+	defer srv.Close()
+
+	errUnknownTenant := errors.New("unknown tenant")
+
+	// tenant taken from the request path
+	provider := CredentialsProviderFunc(func(_ context.Context, req *http.Request) (string, string, error) {
+		if req == nil {
+			return "default", "defaultSecret", nil
+		}
+		tenant := strings.TrimPrefix(req.URL.Path, "/")
+		if tenant == "unknown" {
+			return "", "", errUnknownTenant
+		}
+		return tenant, tenant + "Secret", nil
+	})
+
+	client := New(Options{
+		TokenURL:            ts.URL,
+		ClientID:            "root",
+		ClientSecret:        "rootSecret",
+		CredentialsProvider: provider,
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+	defer client.Close()
+
+	table := []struct {
+		name        string
+		path        string
+		expect      string
+		expectError error
+	}{
+		{"tenant1", "/tenant1", "Bearer tenant1", nil},
+		{"tenant2", "/tenant2", "Bearer tenant2", nil},
+		{"tenant1 cached", "/tenant1", "Bearer tenant1", nil},
+		{"provider error", "/unknown", "", errUnknownTenant},
+	}
+
+	for _, data := range table {
+		gotToken = ""
+		req, errReq := http.NewRequestWithContext(context.TODO(), "GET", srv.URL+data.path, nil)
+		if errReq != nil {
+			t.Fatalf("%s: request: %v", data.name, errReq)
+		}
+		resp, errDo := client.Do(req)
+		if !errors.Is(errDo, data.expectError) {
+			t.Errorf("%s: expected error %v, got %v", data.name, data.expectError, errDo)
+		}
+		if errDo != nil {
+			continue
+		}
+		resp.Body.Close()
+		if gotToken != data.expect {
+			t.Errorf("%s: expected token %q, got %q", data.name, data.expect, gotToken)
+		}
+	}
+
+	tok, errToken := client.Token(context.TODO())
+	if errToken != nil {
+		t.Fatalf("token: %v", errToken)
+	}
+	if tok.AccessToken != "default" {
+		t.Errorf("unexpected token: %+v", tok)
+	}
+
+	expect := "tenant1,tenant2,default"
+	if got := strings.Join(fetches, ","); got != expect {
+		t.Errorf("expected fetches %s, got %s", expect, got)
+	}
+}
+
+func TestCredentialsProviderRotation(t *testing.T) {
+
+	accepted := "secret1"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if formParam(r, "client_secret") != accepted {
+			httpJSON(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		httpJSON(w, `{"access_token":"`+accepted+`","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	secret := "secret1"
+	provider := CredentialsProviderFunc(func(context.Context, *http.Request) (string, string, error) {
+		return "tenant", secret, nil
+	})
+
+	client := New(Options{
+		TokenURL:            ts.URL,
+		ClientID:            "root",
+		ClientSecret:        "rootSecret",
+		CredentialsProvider: provider,
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+	defer client.Close()
+
+	cache := client.derivedCache.(*MemoryTokenCache)
+
+	cached := func(key string) bool {
+		cache.mutex.Lock()
+		defer cache.mutex.Unlock()
+		_, found := cache.entries[key]
+		return found
+	}
+
+	if _, errToken := client.Token(context.TODO()); errToken != nil {
+		t.Fatalf("token 1: %v", errToken)
+	}
+	oldKey := client.WithCredentials("tenant", "secret1").cacheKey()
+
+	// a wrong secret is refused, the cached token is kept
+	ctx := ContextWithCredentials(context.TODO(), "tenant", "wrong")
+	if _, errToken := client.Token(ctx); errToken == nil {
+		t.Errorf("wrong secret: unexpected success")
+	}
+	if !cached(oldKey) {
+		t.Errorf("wrong secret evicted the cached token")
+	}
+
+	// secret rotation
+	secret = "secret2"
+	accepted = "secret2"
+
+	tok, errToken := client.Token(context.TODO())
+	if errToken != nil {
+		t.Fatalf("token 2: %v", errToken)
+	}
+	if tok.AccessToken != "secret2" {
+		t.Errorf("unexpected token: %s", tok.AccessToken)
+	}
+
+	if _, found := client.owners.Load(oldKey); found {
+		t.Errorf("expected previous secret client evicted")
+	}
+	if cached(oldKey) {
+		t.Errorf("expected previous secret token evicted")
+	}
+	if !cached(client.WithCredentials("tenant", "secret2").cacheKey()) {
+		t.Errorf("expected rotated secret token cached")
+	}
+}
+
+func TestBasicAuthCredentials(t *testing.T) {
+
+	var fetches []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		clientID := formParam(r, "client_id")
+		fetches = append(fetches, clientID+":"+formParam(r, "client_secret"))
+		httpJSON(w, `{"access_token":"`+clientID+`","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	var gotAuth, gotCustom []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Values("Authorization")
+		gotCustom = r.Header.Values("X-Token")
+		httpJSON(w, `{"message":"ok"}`, http.StatusOK)
+	}))
+	defer srv.Close()
+
+	table := []struct {
+		name         string
+		header       string
+		basicUser    string
+		expectAuth   []string
+		expectCustom []string
+	}{
+		{"no basic auth", "", "", []string{"Bearer root"}, nil},
+		{"basic auth", "", "tenant1", []string{"Bearer tenant1"}, nil},
+		{"custom header strips basic auth", "X-Token", "tenant2", nil, []string{"Bearer tenant2"}},
+	}
+
+	for _, data := range table {
+		client := New(Options{
+			TokenURL:              ts.URL,
+			ClientID:              "root",
+			ClientSecret:          "rootSecret",
+			BasicAuthCredentials:  true,
+			PreserveAuthorization: true,
+			AuthorizationHeader:   data.header,
+			GroupcacheWorkspace:   groupcache.NewWorkspace(),
+		})
+
+		req, errReq := http.NewRequest("GET", srv.URL, nil)
+		if errReq != nil {
+			t.Fatalf("%s: request: %v", data.name, errReq)
+		}
+		if data.basicUser != "" {
+			req.SetBasicAuth(data.basicUser, data.basicUser+"Secret")
+		}
+		resp, errDo := client.Do(req)
+		if errDo != nil {
+			t.Fatalf("%s: do: %v", data.name, errDo)
+		}
+		resp.Body.Close()
+		client.Close()
+
+		if !slices.Equal(gotAuth, data.expectAuth) {
+			t.Errorf("%s: expected Authorization %q, got %q", data.name, data.expectAuth, gotAuth)
+		}
+		if !slices.Equal(gotCustom, data.expectCustom) {
+			t.Errorf("%s: expected X-Token %q, got %q", data.name, data.expectCustom, gotCustom)
+		}
+	}
+
+	expect := "root:rootSecret,tenant1:tenant1Secret,tenant2:tenant2Secret"
+	if got := strings.Join(fetches, ","); got != expect {
+		t.Errorf("expected fetches %s, got %s", expect, got)
+	}
+}
+
+func TestBasicAuthCredentialsWrongSecret(t *testing.T) {
+	testGatewayWrongSecret(t, Options{BasicAuthCredentials: true},
+		func(req *http.Request, clientID, clientSecret string) {
+			req.SetBasicAuth(clientID, clientSecret)
+		})
+}
+
+func TestExtractCredentialsWrongSecret(t *testing.T) {
+	options := Options{
+		ExtractCredentials: func(req *http.Request) (string, string, bool) {
+			return req.Header.Get("X-Client-Id"), req.Header.Get("X-Client-Secret"),
+				req.Header.Get("X-Client-Id") != ""
+		},
+	}
+	testGatewayWrongSecret(t, options, func(req *http.Request, clientID, clientSecret string) {
+		req.Header.Set("X-Client-Id", clientID)
+		req.Header.Set("X-Client-Secret", clientSecret)
+	})
+}
+
+// testGatewayWrongSecret checks that a gateway taking credentials from
+// inbound requests never serves a cached tenant token to an inbound
+// request presenting the tenant client_id with a wrong secret.
+func testGatewayWrongSecret(t *testing.T, options Options,
+	authenticate func(req *http.Request, clientID, clientSecret string)) {
+
+	var fetches []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		clientID := formParam(r, "client_id")
+		fetches = append(fetches, clientID+":"+formParam(r, "client_secret"))
+		if formParam(r, "client_secret") != clientID+"Secret" {
+			httpJSON(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		httpJSON(w, `{"access_token":"`+clientID+`","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	var gotTokens []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTokens = append(gotTokens, r.Header.Get("Authorization"))
+		httpJSON(w, `{"message":"ok"}`, http.StatusOK)
+	}))
+	defer srv.Close()
+
+	options.TokenURL = ts.URL
+	options.ClientID = "root"
+	options.ClientSecret = "rootSecret"
+	options.GroupcacheWorkspace = groupcache.NewWorkspace()
+	client := New(options)
+	defer client.Close()
+
+	// the gateway forwards inbound requests to the target server
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, errReq := http.NewRequestWithContext(r.Context(), "GET", srv.URL, nil)
+		if errReq != nil {
+			http.Error(w, errReq.Error(), http.StatusInternalServerError)
+			return
+		}
+		req.Header = r.Header.Clone()
+		resp, errDo := client.Do(req)
+		if errDo != nil {
+			var errStatus *StatusError
+			if errors.As(errDo, &errStatus) {
+				w.WriteHeader(errStatus.StatusCode)
+				return
+			}
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+	}))
+	defer gateway.Close()
+
+	table := []struct {
+		name         string
+		secret       string
+		expectStatus int
+	}{
+		{"tenant", "tenant1Secret", http.StatusOK},
+		{"wrong secret", "wrong", http.StatusUnauthorized},
+		{"tenant cached", "tenant1Secret", http.StatusOK},
+	}
+
+	for _, data := range table {
+		req, errReq := http.NewRequest("GET", gateway.URL, nil)
+		if errReq != nil {
+			t.Fatalf("%s: request: %v", data.name, errReq)
+		}
+		authenticate(req, "tenant1", data.secret)
+		resp, errDo := http.DefaultClient.Do(req)
+		if errDo != nil {
+			t.Fatalf("%s: do: %v", data.name, errDo)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != data.expectStatus {
+			t.Errorf("%s: expected status %d, got %d", data.name, data.expectStatus, resp.StatusCode)
+		}
+	}
+
+	if expect := []string{"Bearer tenant1", "Bearer tenant1"}; !slices.Equal(gotTokens, expect) {
+		t.Errorf("expected target tokens %q, got %q", expect, gotTokens)
+	}
+
+	expect := "tenant1:tenant1Secret,tenant1:wrong"
+	if got := strings.Join(fetches, ","); got != expect {
+		t.Errorf("expected fetches %s, got %s", expect, got)
+	}
+}
+
+func TestExtractCredentials(t *testing.T) {
+
+	var fetches []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		clientID := formParam(r, "client_id")
+		fetches = append(fetches, clientID+":"+formParam(r, "client_secret"))
+		httpJSON(w, `{"access_token":"`+clientID+`","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	var gotToken string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotToken = r.Header.Get("Authorization")
+		httpJSON(w, `{"message":"ok"}`, http.StatusOK)
+	}))
+	defer srv.Close()
+
+	client := New(Options{
+		TokenURL:             ts.URL,
+		ClientID:             "root",
+		ClientSecret:         "rootSecret",
+		BasicAuthCredentials: true,
+		ExtractCredentials: func(req *http.Request) (string, string, bool) {
+			cookie, errCookie := req.Cookie("tenant")
+			if errCookie != nil {
+				return "", "", false
+			}
+			return cookie.Value, cookie.Value + "Secret", true
+		},
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+	defer client.Close()
+
+	table := []struct {
+		name      string
+		ctx       context.Context
+		cookie    string
+		basicUser string
+		expect    string
+	}{
+		{"no credentials", context.TODO(), "", "", "Bearer root"},
+		{"cookie", context.TODO(), "tenant1", "", "Bearer tenant1"},
+		{"cookie over basic auth", context.TODO(), "tenant1", "tenant2", "Bearer tenant1"},
+		{"basic auth fallback", context.TODO(), "", "tenant2", "Bearer tenant2"},
+		{"context over cookie", ContextWithCredentials(context.TODO(), "tenant3", "tenant3Secret"), "tenant1", "", "Bearer tenant3"},
+	}
+
+	for _, data := range table {
+		req, errReq := http.NewRequestWithContext(data.ctx, "GET", srv.URL, nil)
+		if errReq != nil {
+			t.Fatalf("%s: request: %v", data.name, errReq)
+		}
+		if data.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "tenant", Value: data.cookie})
+		}
+		if data.basicUser != "" {
+			req.SetBasicAuth(data.basicUser, data.basicUser+"Secret")
+		}
+		resp, errDo := client.Do(req)
+		if errDo != nil {
+			t.Fatalf("%s: do: %v", data.name, errDo)
+		}
+		resp.Body.Close()
+		if gotToken != data.expect {
+			t.Errorf("%s: expected token %q, got %q", data.name, data.expect, gotToken)
+		}
+	}
+
+	expect := "root:rootSecret,tenant1:tenant1Secret,tenant2:tenant2Secret,tenant3:tenant3Secret"
+	if got := strings.Join(fetches, ","); got != expect {
+		t.Errorf("expected fetches %s, got %s", expect, got)
+	}
+}
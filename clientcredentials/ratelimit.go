@@ -0,0 +1,104 @@
+package clientcredentials
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RateLimitError reports a token fetch refused by
+// Options.TokenFetchRateLimit, without contacting the token server.
+type RateLimitError struct {
+	ClientID string
+
+	// RetryAfter is the time until the next fetch is allowed.
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("token fetch rate limit exceeded: client_id=%s retry_after=%v",
+		e.ClientID, e.RetryAfter)
+}
+
+// fetchRateLimiter bounds the rate of token fetches per clientID, with
+// one token bucket per clientID. It is shared by a root client and its
+// derived clients.
+type fetchRateLimiter struct {
+	limit    float64       // bucket capacity
+	interval time.Duration // time to refill the full bucket
+
+	mutex   sync.Mutex
+	buckets map[string]*rateBucket
+	sweepAt int // map size triggering removal of full buckets
+}
+
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+const rateLimiterMinSweep = 1024
+
+// newFetchRateLimiter returns nil if no limit is defined.
+func newFetchRateLimiter(limit int, interval time.Duration) *fetchRateLimiter {
+	if limit < 1 {
+		return nil
+	}
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return &fetchRateLimiter{
+		limit:    float64(limit),
+		interval: interval,
+		buckets:  map[string]*rateBucket{},
+		sweepAt:  rateLimiterMinSweep,
+	}
+}
+
+// allow consumes one fetch for clientID, returning a *RateLimitError
+// if the limit is exceeded.
+func (l *fetchRateLimiter) allow(clientID string, now time.Time) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	b := l.buckets[clientID]
+	if b == nil {
+		if len(l.buckets) >= l.sweepAt {
+			l.sweep(now)
+		}
+		b = &rateBucket{tokens: l.limit, last: now}
+		l.buckets[clientID] = b
+	}
+
+	b.tokens = l.refill(b, now)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.limit * float64(l.interval))
+		return &RateLimitError{ClientID: clientID, RetryAfter: wait}
+	}
+
+	b.tokens--
+
+	return nil
+}
+
+func (l *fetchRateLimiter) refill(b *rateBucket, now time.Time) float64 {
+	elapsed := now.Sub(b.last)
+	return min(l.limit, b.tokens+l.limit*float64(elapsed)/float64(l.interval))
+}
+
+// sweep drops full buckets, which are equivalent to absent ones,
+// so the map does not grow with the number of distinct identities.
+func (l *fetchRateLimiter) sweep(now time.Time) {
+	for clientID, b := range l.buckets {
+		if l.refill(b, now) >= l.limit {
+			delete(l.buckets, clientID)
+		}
+	}
+	l.sweepAt = max(2*len(l.buckets), rateLimiterMinSweep)
+}
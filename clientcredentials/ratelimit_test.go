@@ -0,0 +1,101 @@
+package clientcredentials
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+func TestFetchRateLimiter(t *testing.T) {
+
+	l := newFetchRateLimiter(2, time.Minute)
+
+	now := time.Now()
+
+	table := []struct {
+		name            string
+		clientID        string
+		elapsed         time.Duration
+		expectOk        bool
+		expectRetryWait time.Duration
+	}{
+		{"first", "a", 0, true, 0},
+		{"second", "a", 0, true, 0},
+		{"third exceeds", "a", 0, false, 30 * time.Second},
+		{"other client", "b", 0, true, 0},
+		{"refilled", "a", 30 * time.Second, true, 0},
+		{"exceeds again", "a", 0, false, 30 * time.Second},
+	}
+
+	for _, data := range table {
+		now = now.Add(data.elapsed)
+		errAllow := l.allow(data.clientID, now)
+		if gotOk := errAllow == nil; gotOk != data.expectOk {
+			t.Errorf("%s: expected ok=%t, got error: %v", data.name, data.expectOk, errAllow)
+			continue
+		}
+		var rateErr *RateLimitError
+		if errors.As(errAllow, &rateErr) && rateErr.RetryAfter != data.expectRetryWait {
+			t.Errorf("%s: expected retry after %v, got %v", data.name, data.expectRetryWait, rateErr.RetryAfter)
+		}
+	}
+
+	// full buckets are dropped
+	l.sweep(now.Add(time.Minute))
+	if len(l.buckets) != 0 {
+		t.Errorf("expected no buckets after sweep, got %d", len(l.buckets))
+	}
+}
+
+func TestTokenFetchRateLimit(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+
+	tokenServerStat := serverStat{}
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, "abc", 60)
+	defer ts.Close()
+
+	// the server rejects every token, forcing fetches
+	serverStat := serverStat{}
+	srv := newServer(&serverStat, func(string) bool { return false })
+	defer srv.Close()
+
+	client := New(Options{
+		TokenURL:            ts.URL,
+		ClientID:            clientID,
+		ClientSecret:        clientSecret,
+		TokenFetchRateLimit: 2,
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+
+	var rateErrors int
+
+	for i := range 4 {
+		req, errReq := http.NewRequestWithContext(context.TODO(), "GET", srv.URL, nil)
+		if errReq != nil {
+			t.Fatalf("request: %v", errReq)
+		}
+		resp, errDo := client.Do(req)
+		if errDo != nil {
+			var rateErr *RateLimitError
+			if !errors.As(errDo, &rateErr) {
+				t.Fatalf("do %d: unexpected error: %v", i, errDo)
+			}
+			rateErrors++
+			continue
+		}
+		resp.Body.Close()
+	}
+
+	if tokenServerStat.count != 2 {
+		t.Errorf("expected 2 token requests, got %d", tokenServerStat.count)
+	}
+	if rateErrors != 2 {
+		t.Errorf("expected 2 rate limit errors, got %d", rateErrors)
+	}
+}
@@ -0,0 +1,106 @@
+package clientcredentials
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RefreshScheduler decides when a cached token is due for renewal.
+// The token is kept in cache until the returned time, then fetched again.
+// Returned times later than the token hard expiration are clamped to it.
+type RefreshScheduler interface {
+	RefreshAt(now time.Time, info TokenInfo) time.Time
+}
+
+// RefreshSchedulerFunc adapts a function to RefreshScheduler.
+type RefreshSchedulerFunc func(now time.Time, info TokenInfo) time.Time
+
+// RefreshAt calls f.
+func (f RefreshSchedulerFunc) RefreshAt(now time.Time, info TokenInfo) time.Time {
+	return f(now, info)
+}
+
+// softExpireScheduler is the default RefreshScheduler: renew the token
+// softExpire earlier than its hard expiration, plus a random jitter.
+type softExpireScheduler struct {
+	softExpire time.Duration
+	jitter     time.Duration
+}
+
+func (s softExpireScheduler) RefreshAt(now time.Time, info TokenInfo) time.Time {
+	early := s.softExpire
+	if s.jitter > 0 {
+		early += rand.N(s.jitter)
+	}
+	return now.Add(info.ExpiresIn - early)
+}
+
+// refreshAt computes the cache expiration for the token.
+func (c *Client) refreshAt(now time.Time, info TokenInfo) time.Time {
+	at := c.options.RefreshScheduler.RefreshAt(now, info)
+	if info.ExpiresIn > 0 {
+		if hardExpire := now.Add(info.ExpiresIn); at.After(hardExpire) {
+			return hardExpire
+		}
+	}
+	return at
+}
+
+// refreshAhead renews the token for key in background, unless a renewal
+// is already in progress. The renewed token replaces the cached one.
+func (c *Client) refreshAhead(key string) {
+	if _, busy := c.renewing.LoadOrStore(key, struct{}{}); busy {
+		return
+	}
+	go func() {
+		defer c.renewing.Delete(key)
+
+		ctx := context.Background()
+
+		value, expire, errFetch := c.fetchValue(ctx)
+		if errFetch != nil {
+			c.metrics.refreshAhead.WithLabelValues("failure").Inc()
+			c.errorf("refresh-ahead: key=%s: %v", key, errFetch)
+			c.fallback(FallbackRefreshAheadFailure, key, errFetch)
+			return
+		}
+
+		if errSet := c.cache.Set(ctx, key, value, expire); errSet != nil {
+			c.metrics.refreshAhead.WithLabelValues("failure").Inc()
+			c.errorf("refresh-ahead: key=%s: cache set: %v", key, errSet)
+			c.fallback(FallbackRefreshAheadFailure, key, errSet)
+			return
+		}
+
+		c.local.Delete(key) // next request picks the renewed token
+		c.savePersisted(key, value, expire)
+
+		c.metrics.refreshAhead.WithLabelValues("success").Inc()
+	}()
+}
+
+type forceRefreshKey struct{}
+
+// ContextWithForceRefresh returns a context forcing Do, DoWithOutput and
+// Token to evict the cached token and fetch a new one for that call.
+// The new token is cached for subsequent calls. Token fetches remain
+// subject to Options.TokenFetchRateLimit.
+func ContextWithForceRefresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceRefreshKey{}, true)
+}
+
+// forceRefresh checks if the call forces a token refresh, with
+// ContextWithForceRefresh or Options.ForceRefreshHeader.
+func (c *Client) forceRefresh(ctx context.Context, req *http.Request) bool {
+	if force, _ := ctx.Value(forceRefreshKey{}).(bool); force {
+		return true
+	}
+	if c.options.ForceRefreshHeader == "" || req == nil {
+		return false
+	}
+	force, _ := strconv.ParseBool(req.Header.Get(c.options.ForceRefreshHeader))
+	return force
+}
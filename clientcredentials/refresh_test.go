@@ -0,0 +1,238 @@
+package clientcredentials
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/modernprogram/groupcache/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRefreshScheduler(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "abc"
+	expireIn := 60
+
+	tokenServerStat := serverStat{}
+	serverStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, token, expireIn)
+	defer ts.Close()
+
+	srv := newServer(&serverStat, func(t string) bool { return t == token })
+	defer srv.Close()
+
+	scheduler := RefreshSchedulerFunc(func(now time.Time, _ TokenInfo) time.Time {
+		return now.Add(100 * time.Millisecond)
+	})
+
+	options := Options{
+		TokenURL:            ts.URL,
+		ClientID:            clientID,
+		ClientSecret:        clientSecret,
+		RefreshScheduler:    scheduler,
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	}
+
+	client := New(options)
+
+	for i := range 2 {
+		if _, errSend := send(client, srv.URL); errSend != nil {
+			t.Errorf("send %d: %v", i, errSend)
+		}
+	}
+	if tokenServerStat.count != 1 {
+		t.Errorf("unexpected token server access count before refresh: %d", tokenServerStat.count)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	if _, errSend := send(client, srv.URL); errSend != nil {
+		t.Errorf("send after refresh: %v", errSend)
+	}
+	if tokenServerStat.count != 2 {
+		t.Errorf("unexpected token server access count after refresh: %d", tokenServerStat.count)
+	}
+}
+
+func TestRefreshAtClampedToHardExpire(t *testing.T) {
+	scheduler := RefreshSchedulerFunc(func(now time.Time, _ TokenInfo) time.Time {
+		return now.Add(time.Hour)
+	})
+
+	c := &Client{options: Options{RefreshScheduler: scheduler}}
+
+	now := time.Now()
+	info := TokenInfo{AccessToken: "abc", ExpiresIn: time.Minute}
+
+	if at := c.refreshAt(now, info); !at.Equal(now.Add(time.Minute)) {
+		t.Errorf("expected refresh at hard expiration, got %v", at.Sub(now))
+	}
+}
+
+func TestRefreshAhead(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "abc"
+	expireIn := 2
+
+	tokenServerStat := serverStat{}
+	serverStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, token, expireIn)
+	defer ts.Close()
+
+	srv := newServer(&serverStat, func(t string) bool { return t == token })
+	defer srv.Close()
+
+	options := Options{
+		TokenURL:            ts.URL,
+		ClientID:            clientID,
+		ClientSecret:        clientSecret,
+		SoftExpireInSeconds: 1,
+		RefreshAhead:        true,
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+		MetricsRegisterer:   prometheus.NewRegistry(),
+	}
+
+	client := New(options)
+
+	if _, errSend := send(client, srv.URL); errSend != nil {
+		t.Errorf("send 1: %v", errSend)
+	}
+
+	time.Sleep(1100 * time.Millisecond) // enter soft expire window
+
+	// served from cache, renewed in background
+	if _, errSend := send(client, srv.URL); errSend != nil {
+		t.Errorf("send 2: %v", errSend)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	tokenServerStat.mutex.Lock()
+	count := tokenServerStat.count
+	tokenServerStat.mutex.Unlock()
+	if count != 2 {
+		t.Errorf("unexpected token server access count: %d", count)
+	}
+
+	if v := testutil.ToFloat64(client.metrics.refreshAhead.WithLabelValues("success")); v != 1 {
+		t.Errorf("unexpected refresh-ahead success metric: %v", v)
+	}
+
+	// renewed token is fresh
+	if _, errSend := send(client, srv.URL); errSend != nil {
+		t.Errorf("send 3: %v", errSend)
+	}
+	if v := testutil.ToFloat64(client.metrics.refreshAhead.WithLabelValues("success")); v != 1 {
+		t.Errorf("unexpected refresh-ahead success metric after renewal: %v", v)
+	}
+}
+
+func TestSoftExpireJitter(t *testing.T) {
+	s := softExpireScheduler{softExpire: 10 * time.Second, jitter: 5 * time.Second}
+
+	now := time.Now()
+	info := TokenInfo{AccessToken: "abc", ExpiresIn: time.Minute}
+
+	distinct := map[time.Time]bool{}
+
+	for range 100 {
+		at := s.RefreshAt(now, info)
+		if at.After(now.Add(50*time.Second)) || !at.After(now.Add(45*time.Second)) {
+			t.Fatalf("refresh out of jitter range: %v", at.Sub(now))
+		}
+		distinct[at] = true
+	}
+
+	if len(distinct) < 2 {
+		t.Errorf("expected jittered refresh times")
+	}
+}
+
+func TestForceRefresh(t *testing.T) {
+
+	var fetches int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fetches++
+		httpJSON(w, `{"access_token":"token`+strconv.Itoa(fetches)+`","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	var gotToken, gotHeader string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotToken = r.Header.Get("Authorization")
+		gotHeader = r.Header.Get("oauth2-force-refresh")
+		httpJSON(w, `{"message":"ok"}`, http.StatusOK)
+	}))
+	defer srv.Close()
+
+	client := New(Options{
+		TokenURL:            ts.URL,
+		ClientID:            "clientID",
+		ClientSecret:        "clientSecret",
+		ForceRefreshHeader:  "oauth2-force-refresh",
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+	defer client.Close()
+
+	table := []struct {
+		name         string
+		ctx          context.Context
+		header       string
+		expect       string
+		expectForced bool
+	}{
+		{"fetch", context.TODO(), "", "Bearer token1", false},
+		{"cached", context.TODO(), "", "Bearer token1", false},
+		{"header", context.TODO(), "true", "Bearer token2", true},
+		{"header false", context.TODO(), "false", "Bearer token2", false},
+		{"context", ContextWithForceRefresh(context.TODO()), "", "Bearer token3", true},
+		{"refreshed token cached", context.TODO(), "", "Bearer token3", false},
+	}
+
+	for _, data := range table {
+		req, errReq := http.NewRequestWithContext(data.ctx, "GET", srv.URL, nil)
+		if errReq != nil {
+			t.Fatalf("%s: request: %v", data.name, errReq)
+		}
+		if data.header != "" {
+			req.Header.Set("oauth2-force-refresh", data.header)
+		}
+		out, errDo := client.DoWithOutput(req, WithTrace())
+		if errDo != nil {
+			t.Fatalf("%s: do: %v", data.name, errDo)
+		}
+		out.Response.Body.Close()
+		if gotToken != data.expect {
+			t.Errorf("%s: expected token %q, got %q", data.name, data.expect, gotToken)
+		}
+		if gotHeader != "" {
+			t.Errorf("%s: force refresh header forwarded: %q", data.name, gotHeader)
+		}
+		forced := false
+		for _, e := range out.Trace {
+			forced = forced || e.Step == TraceForceRefresh
+		}
+		if forced != data.expectForced {
+			t.Errorf("%s: unexpected force refresh trace: %v", data.name, forced)
+		}
+	}
+
+	tok, errToken := client.Token(ContextWithForceRefresh(context.TODO()))
+	if errToken != nil {
+		t.Fatalf("token: %v", errToken)
+	}
+	if tok.AccessToken != "token4" {
+		t.Errorf("expected token4, got %s", tok.AccessToken)
+	}
+}
@@ -0,0 +1,63 @@
+package clientcredentials
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/udhos/groupcache_oauth2/backoff"
+)
+
+// isTransient reports whether the token request failure is worth
+// retrying: network errors, HTTP 429 and 5xx.
+func isTransient(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests ||
+			statusErr.StatusCode >= 500
+	}
+
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// retryDelay returns the delay before the retry attempt, honoring
+// Retry-After up to the backoff maximum.
+func (c *Client) retryDelay(attempt int, err error) time.Duration {
+	delay := c.options.TokenRetryBackoff.Delay(attempt)
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > delay {
+		maxDelay := c.options.TokenRetryBackoff.Max
+		if maxDelay <= 0 {
+			maxDelay = backoff.DefaultMax
+		}
+		delay = min(statusErr.RetryAfter, maxDelay)
+	}
+
+	return delay
+}
+
+// parseRetryAfter parses the Retry-After header, either delay seconds
+// or HTTP date. Returns zero if absent or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, errConv := strconv.Atoi(value); errConv == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if date, errParse := http.ParseTime(value); errParse == nil {
+		return max(date.Sub(now), 0)
+	}
+	return 0
+}
@@ -0,0 +1,89 @@
+package clientcredentials
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/modernprogram/groupcache/v2"
+	"github.com/udhos/groupcache_oauth2/backoff"
+)
+
+func TestTokenRetries(t *testing.T) {
+
+	table := []struct {
+		name           string
+		retries        int
+		failures       int
+		failStatus     int
+		expectSuccess  bool
+		expectRequests int
+	}{
+		{"no retries", 0, 1, http.StatusServiceUnavailable, false, 1},
+		{"retry until success", 2, 2, http.StatusServiceUnavailable, true, 3},
+		{"retries exhausted", 1, 2, http.StatusServiceUnavailable, false, 2},
+		{"retry too many requests", 1, 1, http.StatusTooManyRequests, true, 2},
+		{"bad request not retried", 2, 1, http.StatusBadRequest, false, 1},
+	}
+
+	for _, data := range table {
+
+		var requests int
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			requests++
+			if requests <= data.failures {
+				w.Header().Set("Retry-After", "0")
+				httpJSON(w, `{"error":"unavailable"}`, data.failStatus)
+				return
+			}
+			httpJSON(w, `{"access_token":"abc","expires_in":60}`, http.StatusOK)
+		}))
+
+		serverStat := serverStat{}
+		srv := newServer(&serverStat, func(t string) bool { return t == "abc" })
+
+		client := New(Options{
+			TokenURL:            ts.URL,
+			ClientID:            "clientID",
+			ClientSecret:        "clientSecret",
+			TokenRetries:        data.retries,
+			TokenRetryBackoff:   backoff.Config{Initial: time.Millisecond},
+			GroupcacheWorkspace: groupcache.NewWorkspace(),
+		})
+
+		_, errSend := send(client, srv.URL)
+		if gotSuccess := errSend == nil; gotSuccess != data.expectSuccess {
+			t.Errorf("%s: expected success=%t, got error: %v", data.name, data.expectSuccess, errSend)
+		}
+		if requests != data.expectRequests {
+			t.Errorf("%s: expected %d token requests, got %d", data.name, data.expectRequests, requests)
+		}
+
+		srv.Close()
+		ts.Close()
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	table := []struct {
+		value  string
+		expect time.Duration
+	}{
+		{"", 0},
+		{"3", 3 * time.Second},
+		{"-1", 0},
+		{"invalid", 0},
+		{now.Add(5 * time.Second).Format(http.TimeFormat), 5 * time.Second},
+		{now.Add(-5 * time.Second).Format(http.TimeFormat), 0},
+	}
+
+	for _, data := range table {
+		if got := parseRetryAfter(data.value, now); got != data.expect {
+			t.Errorf("value=%q: expected %v, got %v", data.value, data.expect, got)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package clientcredentials
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Route maps target requests to a Client. See NewRouter.
+type Route struct {
+	// Host matches the target host, with or without port, e.g.
+	// "api.example.com" or "api.example.com:8443".
+	Host string
+
+	// Prefix matches the beginning of the target URL, e.g.
+	// "https://api.example.com/billing/". Prefix routes are matched
+	// before Host routes, the longest prefix first.
+	Prefix string
+
+	// Client sends the requests matched by the route.
+	Client *Client
+}
+
+// NoRouteError reports a request URL not matched by any Router route,
+// when the router has no fallback client.
+type NoRouteError struct {
+	URL string
+}
+
+func (e *NoRouteError) Error() string {
+	return "router: no route for url: " + e.URL
+}
+
+// Router dispatches requests to clients by target host or URL prefix,
+// e.g. clients with distinct token URLs or scopes, so one wrapper can
+// front calls to many protected upstreams. It implements HTTPClientDoer.
+// A Router is safe for concurrent use.
+type Router struct {
+	prefixes []Route // sorted by descending prefix length
+	hosts    map[string]*Client
+	fallback *Client
+}
+
+// NewRouter creates a router. Requests matching no route are sent with
+// fallback, or fail with *NoRouteError if fallback is nil.
+// NewRouter panics on routes without Client, or with neither Host nor Prefix.
+func NewRouter(routes []Route, fallback *Client) *Router {
+	r := &Router{
+		hosts:    map[string]*Client{},
+		fallback: fallback,
+	}
+	for _, route := range routes {
+		if route.Client == nil {
+			panic("router: route client is nil")
+		}
+		switch {
+		case route.Prefix != "":
+			r.prefixes = append(r.prefixes, route)
+		case route.Host != "":
+			r.hosts[strings.ToLower(route.Host)] = route.Client
+		default:
+			panic("router: route has neither host nor prefix")
+		}
+	}
+	sort.SliceStable(r.prefixes, func(i, j int) bool {
+		return len(r.prefixes[i].Prefix) > len(r.prefixes[j].Prefix)
+	})
+	return r
+}
+
+// Do sends the request with the client matching its URL, see Client.Do.
+func (r *Router) Do(req *http.Request) (*http.Response, error) {
+	c, errRoute := r.route(req)
+	if errRoute != nil {
+		return nil, errRoute
+	}
+	return c.Do(req)
+}
+
+// DoWithOutput sends the request with the client matching its URL,
+// see Client.DoWithOutput.
+func (r *Router) DoWithOutput(req *http.Request, opts ...RequestOption) (Output, error) {
+	c, errRoute := r.route(req)
+	if errRoute != nil {
+		return Output{}, errRoute
+	}
+	return c.DoWithOutput(req, opts...)
+}
+
+// Transport returns an http.RoundTripper that sends requests with Do.
+// See Client.Transport.
+func (r *Router) Transport() http.RoundTripper {
+	return &transport{doer: r}
+}
+
+// route finds the client for the request URL.
+func (r *Router) route(req *http.Request) (*Client, error) {
+	if req.URL == nil {
+		return nil, &NoRouteError{}
+	}
+	if len(r.prefixes) > 0 {
+		u := req.URL.String()
+		for _, route := range r.prefixes {
+			if strings.HasPrefix(u, route.Prefix) {
+				return route.Client, nil
+			}
+		}
+	}
+	if c, found := r.hosts[strings.ToLower(req.URL.Host)]; found {
+		return c, nil
+	}
+	if c, found := r.hosts[strings.ToLower(req.URL.Hostname())]; found {
+		return c, nil
+	}
+	if r.fallback != nil {
+		return r.fallback, nil
+	}
+	return nil, &NoRouteError{URL: req.URL.Redacted()}
+}
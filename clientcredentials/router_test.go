@@ -0,0 +1,94 @@
+package clientcredentials
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+func TestRouter(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		httpJSON(w, `{"access_token":"`+formParam(r, "client_id")+`","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	var gotToken string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotToken = r.Header.Get("Authorization")
+		httpJSON(w, `{"message":"ok"}`, http.StatusOK)
+	}))
+	defer srv.Close()
+
+	newRouteClient := func(clientID string) *Client {
+		c := New(Options{
+			TokenURL:            ts.URL,
+			ClientID:            clientID,
+			ClientSecret:        "secret",
+			GroupcacheWorkspace: groupcache.NewWorkspace(),
+		})
+		t.Cleanup(c.Close)
+		return c
+	}
+
+	// srv is reachable as 127.0.0.1 and as localhost
+	port := srv.URL[strings.LastIndex(srv.URL, ":")+1:]
+	local := "http://localhost:" + port
+
+	router := NewRouter([]Route{
+		{Host: "127.0.0.1", Client: newRouteClient("host")},
+		{Prefix: srv.URL + "/billing/", Client: newRouteClient("billing")},
+		{Prefix: srv.URL + "/billing/invoices/", Client: newRouteClient("invoices")},
+	}, nil)
+
+	table := []struct {
+		name      string
+		url       string
+		expect    string
+		expectErr bool
+	}{
+		{"host", srv.URL + "/orders", "Bearer host", false},
+		{"prefix", srv.URL + "/billing/report", "Bearer billing", false},
+		{"longest prefix", srv.URL + "/billing/invoices/1", "Bearer invoices", false},
+		{"no route", local + "/orders", "", true},
+	}
+
+	for _, data := range table {
+		req, errReq := http.NewRequest("GET", data.url, nil)
+		if errReq != nil {
+			t.Fatalf("%s: request: %v", data.name, errReq)
+		}
+		gotToken = ""
+		resp, errDo := router.Do(req)
+		if data.expectErr {
+			var noRoute *NoRouteError
+			if !errors.As(errDo, &noRoute) {
+				t.Errorf("%s: expected NoRouteError, got %v", data.name, errDo)
+			}
+			continue
+		}
+		if errDo != nil {
+			t.Fatalf("%s: do: %v", data.name, errDo)
+		}
+		resp.Body.Close()
+		if gotToken != data.expect {
+			t.Errorf("%s: expected token %q, got %q", data.name, data.expect, gotToken)
+		}
+	}
+
+	fallback := NewRouter(nil, newRouteClient("fallback"))
+	httpClient := &http.Client{Transport: fallback.Transport()}
+	resp, errGet := httpClient.Get(local + "/orders")
+	if errGet != nil {
+		t.Fatalf("fallback: %v", errGet)
+	}
+	resp.Body.Close()
+	if gotToken != "Bearer fallback" {
+		t.Errorf("fallback: unexpected token %q", gotToken)
+	}
+}
@@ -0,0 +1,118 @@
+package clientcredentials
+
+import (
+	"sync"
+	"time"
+)
+
+// Runner runs periodic background tasks, such as introspection and
+// summary logging, for one or more clients on a single goroutine.
+// Share one Runner across clients with Options.Runner to avoid one timer
+// goroutine per client. Tasks run sequentially.
+type Runner struct {
+	tasks map[*runnerTask]struct{}
+	mutex sync.Mutex
+	wake  chan struct{}
+	done  chan struct{}
+	once  sync.Once
+}
+
+type runnerTask struct {
+	interval time.Duration
+	next     time.Time
+	run      func()
+}
+
+// NewRunner creates a runner. Call Close to stop it.
+func NewRunner() *Runner {
+	r := &Runner{
+		tasks: map[*runnerTask]struct{}{},
+		wake:  make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+	go r.loop()
+	return r
+}
+
+// Close stops the runner.
+func (r *Runner) Close() {
+	r.once.Do(func() { close(r.done) })
+}
+
+func (r *Runner) add(interval time.Duration, run func()) *runnerTask {
+	t := &runnerTask{interval: interval, next: time.Now().Add(interval), run: run}
+	r.mutex.Lock()
+	r.tasks[t] = struct{}{}
+	r.mutex.Unlock()
+	r.notify()
+	return t
+}
+
+func (r *Runner) remove(t *runnerTask) {
+	r.mutex.Lock()
+	delete(r.tasks, t)
+	r.mutex.Unlock()
+	r.notify()
+}
+
+func (r *Runner) notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// due returns tasks due at now, rescheduling them, and the next wake time.
+func (r *Runner) due(now time.Time) ([]*runnerTask, time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var list []*runnerTask
+	var next time.Time
+
+	for t := range r.tasks {
+		if !now.Before(t.next) {
+			list = append(list, t)
+			t.next = now.Add(t.interval)
+		}
+		if next.IsZero() || t.next.Before(next) {
+			next = t.next
+		}
+	}
+
+	return list, next
+}
+
+func (r *Runner) loop() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		list, next := r.due(time.Now())
+
+		for _, t := range list {
+			r.mutex.Lock()
+			_, active := r.tasks[t]
+			r.mutex.Unlock()
+			if active {
+				t.run()
+			}
+		}
+
+		wait := time.Hour // idle
+		if !next.IsZero() {
+			wait = time.Until(next)
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-r.done:
+			return
+		case <-r.wake:
+			if !timer.Stop() {
+				<-timer.C
+			}
+		case <-timer.C:
+		}
+	}
+}
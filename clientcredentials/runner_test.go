@@ -0,0 +1,78 @@
+package clientcredentials
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+func TestRunner(t *testing.T) {
+	r := NewRunner()
+	defer r.Close()
+
+	var fast, slow atomic.Int32
+
+	tFast := r.add(10*time.Millisecond, func() { fast.Add(1) })
+	r.add(40*time.Millisecond, func() { slow.Add(1) })
+
+	time.Sleep(100 * time.Millisecond)
+
+	if n := fast.Load(); n < 5 {
+		t.Errorf("fast task: unexpected run count: %d", n)
+	}
+	if n := slow.Load(); n < 1 || n > 3 {
+		t.Errorf("slow task: unexpected run count: %d", n)
+	}
+
+	r.remove(tFast)
+	time.Sleep(20 * time.Millisecond) // let an in-progress run finish
+	before := fast.Load()
+	time.Sleep(50 * time.Millisecond)
+	if n := fast.Load(); n != before {
+		t.Errorf("removed task still running: %d -> %d", before, n)
+	}
+}
+
+func TestSharedRunner(t *testing.T) {
+	runner := NewRunner()
+	defer runner.Close()
+
+	var summaries atomic.Int32
+
+	newSummaryClient := func() *Client {
+		return New(Options{
+			TokenURL:            "http://localhost:1/token",
+			ClientID:            "clientID",
+			ClientSecret:        "clientSecret",
+			SummaryInterval:     10 * time.Millisecond,
+			Runner:              runner,
+			Logf:                func(string, ...any) { summaries.Add(1) },
+			GroupcacheWorkspace: groupcache.NewWorkspace(),
+		})
+	}
+
+	c1 := newSummaryClient()
+	c2 := newSummaryClient()
+
+	if c1.runner != runner || c2.runner != runner {
+		t.Errorf("clients not using shared runner")
+	}
+
+	time.Sleep(55 * time.Millisecond)
+
+	c1.Close()
+	c2.Close()
+
+	if n := summaries.Load(); n < 6 {
+		t.Errorf("unexpected summary count: %d", n)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	before := summaries.Load()
+	time.Sleep(30 * time.Millisecond)
+	if n := summaries.Load(); n != before {
+		t.Errorf("summary after close: %d -> %d", before, n)
+	}
+}
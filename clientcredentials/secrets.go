@@ -0,0 +1,73 @@
+package clientcredentials
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+)
+
+// clientSecrets tracks the client secret currently in use, with
+// Options.FallbackClientSecrets. It is shared by a root client and
+// its clients derived with WithScope or WithAudience.
+type clientSecrets struct {
+	list    []string
+	current atomic.Int32 // index of the secret that worked last
+}
+
+// newClientSecrets returns nil if there are no fallback secrets.
+func newClientSecrets(primary string, fallback []string) *clientSecrets {
+	if len(fallback) == 0 {
+		return nil
+	}
+	return &clientSecrets{list: append([]string{primary}, fallback...)}
+}
+
+// clientSecret returns the client secret currently in use.
+func (c *Client) clientSecret() string {
+	if c.secrets == nil {
+		return c.options.ClientSecret
+	}
+	return c.secrets.list[c.secrets.current.Load()]
+}
+
+// requestToken performs a token request. With Options.FallbackClientSecrets,
+// secrets rejected by the token server are skipped, starting from the
+// secret that worked last.
+func (c *Client) requestToken(ctx context.Context) (TokenInfo, TokenResponse, error) {
+	s := c.secrets
+	if s == nil || c.hasAssertion() {
+		return c.requestTokenEndpoints(ctx, c.options.ClientSecret)
+	}
+
+	start := int(s.current.Load())
+	n := len(s.list)
+
+	for i := 0; ; i++ {
+		idx := (start + i) % n
+		ti, tr, errTok := c.requestTokenEndpoints(ctx, s.list[idx])
+		if errTok == nil {
+			if idx != start {
+				c.infofCtx(ctx, "client secret rotation: now using secret %d of %d: client_id=%s",
+					idx+1, n, c.options.ClientID)
+				s.current.Store(int32(idx))
+			}
+			return ti, tr, nil
+		}
+		if i == n-1 || !isInvalidClient(errTok) {
+			return ti, tr, errTok
+		}
+		c.warnfCtx(ctx, "client secret %d of %d rejected, trying next: client_id=%s: %v",
+			idx+1, n, c.options.ClientID, errTok)
+		c.fallback(FallbackSecret, c.cacheKey(), errTok)
+	}
+}
+
+// isInvalidClient reports token server errors rejecting the client secret.
+func isInvalidClient(err error) bool {
+	if errors.Is(err, ErrInvalidClient) {
+		return true
+	}
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusUnauthorized
+}
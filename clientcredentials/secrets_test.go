@@ -0,0 +1,120 @@
+package clientcredentials
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/modernprogram/groupcache/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestFallbackClientSecrets(t *testing.T) {
+
+	var fetches []string
+	accepted := "old"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		secret := formParam(r, "client_secret")
+		fetches = append(fetches, secret)
+		if secret != accepted {
+			httpJSON(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		httpJSON(w, `{"access_token":"`+secret+`","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	srv := newServer(&serverStat{}, func(string) bool { return true })
+	defer srv.Close()
+
+	client := New(Options{
+		TokenURL:              ts.URL,
+		ClientID:              "clientID",
+		ClientSecret:          "new",
+		FallbackClientSecrets: []string{"old"},
+		DisableCache:          true,
+		GroupcacheWorkspace:   groupcache.NewWorkspace(),
+	})
+	defer client.Close()
+
+	table := []struct {
+		name     string
+		accepted string
+		expect   string
+	}{
+		{"new secret not deployed yet", "old", "new,old"},
+		{"remember old secret", "old", "old"},
+		{"new secret deployed", "new", "old,new"},
+		{"remember new secret", "new", "new"},
+		{"all secrets rejected", "other", "new,old"},
+	}
+
+	for _, data := range table {
+		accepted = data.accepted
+		fetches = nil
+		_, errSend := send(client, srv.URL)
+		if data.accepted == "other" {
+			if errSend == nil {
+				t.Errorf("%s: unexpected success", data.name)
+			}
+		} else if errSend != nil {
+			t.Errorf("%s: send: %v", data.name, errSend)
+		}
+		if got := strings.Join(fetches, ","); got != data.expect {
+			t.Errorf("%s: expected fetches %s, got %s", data.name, data.expect, got)
+		}
+	}
+
+	count := testutil.ToFloat64(client.metrics.fallback.WithLabelValues(FallbackSecret))
+	if count != 3 {
+		t.Errorf("unexpected fallback secret metric: %v", count)
+	}
+}
+
+func TestFallbackClientSecretsRateLimit(t *testing.T) {
+
+	var fetches int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		fetches++
+		if formParam(r, "client_secret") != "old" {
+			httpJSON(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		httpJSON(w, `{"access_token":"abc","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	var events []FallbackEvent
+
+	client := New(Options{
+		TokenURL:              ts.URL,
+		ClientID:              "clientID",
+		ClientSecret:          "new",
+		FallbackClientSecrets: []string{"old"},
+		TokenFetchRateLimit:   1,
+		GroupcacheWorkspace:   groupcache.NewWorkspace(),
+		OnFallback: func(event FallbackEvent) {
+			events = append(events, event)
+		},
+	})
+	defer client.Close()
+
+	// the fallback secret is a second token request, beyond the limit
+	_, errToken := client.Token(context.TODO())
+
+	var rateErr *RateLimitError
+	if !errors.As(errToken, &rateErr) {
+		t.Errorf("expected RateLimitError, got: %v", errToken)
+	}
+	if fetches != 1 {
+		t.Errorf("expected 1 token request, got %d", fetches)
+	}
+	if len(events) != 1 || events[0].Reason != FallbackSecret {
+		t.Errorf("expected fallback secret event, got: %v", events)
+	}
+}
@@ -0,0 +1,106 @@
+package clientcredentials
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Security event types.
+const (
+	// SecurityTokenIssued reports the token server issued a token.
+	SecurityTokenIssued = "token_issued"
+
+	// SecurityTokenRejected reports the target server refused a token,
+	// rejected per Options.IsBadTokenResponse.
+	SecurityTokenRejected = "token_rejected"
+
+	// SecurityCredentialInvalid reports the token server refused the
+	// client credentials with status 400, 401 or 403.
+	SecurityCredentialInvalid = "credential_invalid"
+)
+
+// SecurityEvent is an authentication event, with field names following
+// the OWASP application logging vocabulary, for SIEM ingestion.
+// Events never carry tokens or secrets.
+type SecurityEvent struct {
+	Datetime    time.Time `json:"datetime"`
+	AppID       string    `json:"appid,omitempty"`
+	Event       string    `json:"event"` // e.g. token_issued:clientID
+	Type        string    `json:"type"`  // one of the Security* constants
+	Level       string    `json:"level"` // INFO or WARN
+	Description string    `json:"description"`
+	ClientID    string    `json:"client_id"`
+	TokenURL    string    `json:"token_url,omitempty"`
+	Status      int       `json:"status,omitempty"`
+}
+
+// SecuritySink receives security events. Implementations must be safe
+// for concurrent use.
+type SecuritySink interface {
+	Emit(event SecurityEvent)
+}
+
+// SecuritySinkFunc adapts a function to SecuritySink.
+type SecuritySinkFunc func(event SecurityEvent)
+
+// Emit calls f.
+func (f SecuritySinkFunc) Emit(event SecurityEvent) {
+	f(event)
+}
+
+// NewJSONSecuritySink creates a SecuritySink writing one JSON event per line.
+func NewJSONSecuritySink(w io.Writer) SecuritySink {
+	return &jsonSecuritySink{w: w}
+}
+
+type jsonSecuritySink struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+func (s *jsonSecuritySink) Emit(event SecurityEvent) {
+	buf, errJSON := json.Marshal(event)
+	if errJSON != nil {
+		return
+	}
+	buf = append(buf, '\n')
+	s.mutex.Lock()
+	s.w.Write(buf)
+	s.mutex.Unlock()
+}
+
+// securityEvent emits a security event to Options.SecurityEvents.
+func (c *Client) securityEvent(eventType string, status int, format string, v ...any) {
+	if c.options.SecurityEvents == nil {
+		return
+	}
+	level := "INFO"
+	if eventType != SecurityTokenIssued {
+		level = "WARN"
+	}
+	c.options.SecurityEvents.Emit(SecurityEvent{
+		Datetime:    time.Now().UTC(),
+		AppID:       c.options.SecurityAppID,
+		Event:       eventType + ":" + c.options.ClientID,
+		Type:        eventType,
+		Level:       level,
+		Description: fmt.Sprintf(format, v...),
+		ClientID:    c.options.ClientID,
+		TokenURL:    c.options.TokenURL,
+		Status:      status,
+	})
+}
+
+// isCredentialInvalid reports whether the token server status
+// means the client credentials were refused.
+func isCredentialInvalid(status int) bool {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package clientcredentials
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+func TestSecurityEvents(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+
+	tokenServerStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, "abc", 60)
+	defer ts.Close()
+
+	serverStat := serverStat{}
+	srv := newServer(&serverStat, func(string) bool { return false }) // reject all
+	defer srv.Close()
+
+	table := []struct {
+		name         string
+		clientSecret string
+		expect       []string
+	}{
+		{"token rejected", clientSecret, []string{SecurityTokenIssued, SecurityTokenRejected}},
+		{"credential invalid", "wrong", []string{SecurityCredentialInvalid}},
+	}
+
+	for _, data := range table {
+		var buf bytes.Buffer
+
+		client := New(Options{
+			TokenURL:            ts.URL,
+			ClientID:            clientID,
+			ClientSecret:        data.clientSecret,
+			SecurityEvents:      NewJSONSecuritySink(&buf),
+			SecurityAppID:       "app1",
+			GroupcacheWorkspace: groupcache.NewWorkspace(),
+		})
+
+		send(client, srv.URL)
+
+		var got []string
+		scanner := bufio.NewScanner(&buf)
+		for scanner.Scan() {
+			var event SecurityEvent
+			if errJSON := json.Unmarshal(scanner.Bytes(), &event); errJSON != nil {
+				t.Fatalf("%s: json: %v", data.name, errJSON)
+			}
+			if event.ClientID != clientID || event.AppID != "app1" ||
+				event.Event != event.Type+":"+clientID {
+				t.Errorf("%s: unexpected event: %+v", data.name, event)
+			}
+			if bytes.Contains(scanner.Bytes(), []byte("abc")) {
+				t.Errorf("%s: event leaks token: %s", data.name, scanner.Text())
+			}
+			got = append(got, event.Type)
+		}
+
+		if len(got) != len(data.expect) {
+			t.Errorf("%s: expected events %v, got %v", data.name, data.expect, got)
+			continue
+		}
+		for i, e := range data.expect {
+			if got[i] != e {
+				t.Errorf("%s: expected events %v, got %v", data.name, data.expect, got)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package clientcredentials
+
+import (
+	"sync"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+// sharedGroups tracks groups created by clients, so clients created with
+// the same workspace and GroupcacheName share the group instead of
+// failing on duplicate group registration. Groups are removed when the
+// last client closes, see leaveGroup.
+var sharedGroups = struct {
+	mutex  sync.Mutex
+	groups map[sharedGroupKey]*sharedGroup
+}{groups: map[sharedGroupKey]*sharedGroup{}}
+
+type sharedGroupKey struct {
+	workspace *groupcache.Workspace
+	name      string
+}
+
+// sharedGroup holds the state shared by all clients using a group.
+// The group load function dispatches on owners, see loadKey.
+type sharedGroup struct {
+	cache        *groupcacheTokenCache
+	derivedCache *MemoryTokenCache // see derive
+	owners       *sync.Map
+	metrics      *metrics
+	clients      int // clients not yet closed
+}
+
+// joinGroup returns the group registered under name in the workspace,
+// creating it with create if missing.
+func joinGroup(workspace *groupcache.Workspace, name string,
+	create func() *sharedGroup) *sharedGroup {
+
+	key := sharedGroupKey{workspace: workspace, name: name}
+
+	sharedGroups.mutex.Lock()
+	defer sharedGroups.mutex.Unlock()
+
+	shared, found := sharedGroups.groups[key]
+	if !found {
+		shared = create()
+		sharedGroups.groups[key] = shared
+	}
+	shared.clients++
+
+	return shared
+}
+
+// leaveGroup releases the group joined with joinGroup, deregistering it
+// from the workspace when the last client leaves.
+func leaveGroup(workspace *groupcache.Workspace, name string) {
+	key := sharedGroupKey{workspace: workspace, name: name}
+
+	sharedGroups.mutex.Lock()
+	defer sharedGroups.mutex.Unlock()
+
+	shared, found := sharedGroups.groups[key]
+	if !found {
+		return
+	}
+	shared.clients--
+	if shared.clients > 0 {
+		return
+	}
+	delete(sharedGroups.groups, key)
+	groupcache.DeregisterGroupWithWorkspace(workspace, name)
+}
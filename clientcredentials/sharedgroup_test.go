@@ -0,0 +1,146 @@
+package clientcredentials
+
+import (
+	"context"
+	"testing"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+func TestSharedGroup(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+
+	tokenServerStat1 := serverStat{}
+	ts1 := newTokenServer(&tokenServerStat1, clientID, clientSecret, "token1", 60)
+	defer ts1.Close()
+
+	tokenServerStat2 := serverStat{}
+	ts2 := newTokenServer(&tokenServerStat2, clientID, clientSecret, "token2", 60)
+	defer ts2.Close()
+
+	workspace := groupcache.NewWorkspace()
+
+	newSharing := func(tokenURL string) *Client {
+		return New(Options{
+			TokenURL:            tokenURL,
+			ClientID:            clientID,
+			ClientSecret:        clientSecret,
+			GroupcacheWorkspace: workspace,
+		})
+	}
+
+	client1 := newSharing(ts1.URL)
+	client2 := newSharing(ts2.URL)
+
+	if client1.group != client2.group {
+		t.Errorf("clients should share the group")
+	}
+	if client1.cacheKey() == client2.cacheKey() {
+		t.Errorf("clients sharing the group should have distinct keys: %s", client1.cacheKey())
+	}
+
+	table := []struct {
+		name   string
+		client *Client
+		expect string
+	}{
+		{"client1", client1, "token1"},
+		{"client2", client2, "token2"},
+		{"client1 cached", client1, "token1"},
+		{"client2 cached", client2, "token2"},
+	}
+
+	for _, data := range table {
+		tok, errTok := data.client.Token(context.TODO())
+		if errTok != nil {
+			t.Errorf("%s: token: %v", data.name, errTok)
+			continue
+		}
+		if tok.AccessToken != data.expect {
+			t.Errorf("%s: expected token %s, got %s", data.name, data.expect, tok.AccessToken)
+		}
+	}
+
+	if tokenServerStat1.count != 1 || tokenServerStat2.count != 1 {
+		t.Errorf("expected one fetch per token server, got %d and %d",
+			tokenServerStat1.count, tokenServerStat2.count)
+	}
+}
+
+func TestSharedGroupKeysOrderIndependent(t *testing.T) {
+
+	newSharing := func(workspace *groupcache.Workspace, tokenURL string) *Client {
+		return New(Options{
+			TokenURL:            tokenURL,
+			ClientID:            "clientID",
+			ClientSecret:        "clientSecret",
+			GroupcacheWorkspace: workspace,
+		})
+	}
+
+	// two processes creating the same clients in different orders
+	ws1 := groupcache.NewWorkspace()
+	a1 := newSharing(ws1, "http://token-a")
+	b1 := newSharing(ws1, "http://token-b")
+	defer a1.Close()
+	defer b1.Close()
+
+	ws2 := groupcache.NewWorkspace()
+	b2 := newSharing(ws2, "http://token-b")
+	a2 := newSharing(ws2, "http://token-a")
+	defer a2.Close()
+	defer b2.Close()
+
+	if a1.cacheKey() != a2.cacheKey() || b1.cacheKey() != b2.cacheKey() {
+		t.Errorf("keys depend on creation order: %s %s %s %s",
+			a1.cacheKey(), a2.cacheKey(), b1.cacheKey(), b2.cacheKey())
+	}
+}
+
+func TestSharedGroupRemovedOnClose(t *testing.T) {
+
+	workspace := groupcache.NewWorkspace()
+	key := sharedGroupKey{workspace: workspace, name: "oauth2"}
+
+	registered := func() bool {
+		sharedGroups.mutex.Lock()
+		defer sharedGroups.mutex.Unlock()
+		_, found := sharedGroups.groups[key]
+		return found
+	}
+
+	newSharing := func() *Client {
+		return New(Options{
+			TokenURL:            "http://token",
+			ClientID:            "clientID",
+			ClientSecret:        "clientSecret",
+			GroupcacheWorkspace: workspace,
+		})
+	}
+
+	client1 := newSharing()
+	client2 := newSharing()
+
+	client1.Close()
+	client1.Close() // closing twice must not release the group twice
+	if !registered() {
+		t.Errorf("group removed while in use")
+	}
+
+	client2.Close()
+	if registered() {
+		t.Errorf("group not removed after last client closed")
+	}
+	if groupcache.GetGroupWithWorkspace(workspace, "oauth2") != nil {
+		t.Errorf("group not deregistered from workspace")
+	}
+
+	// the name can be reused
+	client3 := newSharing()
+	defer client3.Close()
+	if !registered() {
+		t.Errorf("group not registered again")
+	}
+}
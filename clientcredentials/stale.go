@@ -0,0 +1,99 @@
+package clientcredentials
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+// getStale retrieves a stale token if the error indicates the token
+// server is unreachable and the token is within the grace period.
+func (c *Client) getStale(ctx context.Context, key string, errFetch error) (storedToken, bool) {
+	if c.options.StaleTokenGracePeriod <= 0 || !isTokenServerUnreachable(errFetch) {
+		return storedToken{}, false
+	}
+	t, found := c.tokens.get(key)
+	if !found {
+		return storedToken{}, false
+	}
+	if time.Now().After(t.hardExpire.Add(c.options.StaleTokenGracePeriod)) {
+		c.tokens.remove(key)
+		return storedToken{}, false
+	}
+	c.metrics.staleTokenServed.Inc()
+	c.fallback(FallbackStaleToken, key, errFetch)
+	c.logEvent(ctx, slog.LevelWarn, "stale_token", "serving stale token due to token server error",
+		slog.Time("expired_at", t.hardExpire), slog.Any("error", errFetch))
+	return t, true
+}
+
+// getStaleWhileRevalidate retrieves a cache-expired token within the
+// StaleWhileRevalidate period, and renews it in background.
+func (c *Client) getStaleWhileRevalidate(key string) (storedToken, bool) {
+	if c.options.StaleWhileRevalidate <= 0 {
+		return storedToken{}, false
+	}
+	t, found := c.tokens.get(key)
+	if !found || t.cacheExpire.IsZero() {
+		return storedToken{}, false
+	}
+	now := time.Now()
+	if !now.After(t.cacheExpire) {
+		return storedToken{}, false // still cached, use regular path
+	}
+	if now.After(t.cacheExpire.Add(c.options.StaleWhileRevalidate)) || now.After(t.hardExpire) {
+		return storedToken{}, false
+	}
+	c.metrics.staleWhileRevalidate.Inc()
+	c.fallback(FallbackStaleWhileRevalidate, key, nil)
+	c.revalidate(key)
+	return t, true
+}
+
+// revalidate renews the token for key in background, unless a renewal
+// is already in progress.
+func (c *Client) revalidate(key string) {
+	if _, busy := c.renewing.LoadOrStore(key, struct{}{}); busy {
+		return
+	}
+	go func() {
+		defer c.renewing.Delete(key)
+
+		value, cacheExpire, errGet := c.cache.Get(context.Background(), key, c.loadValue)
+		if errGet != nil {
+			c.errorf("stale-while-revalidate: key=%s: %v", key, errGet)
+			return
+		}
+
+		tok, errDecode := c.decodeValue(key, value, cacheExpire)
+		if errDecode != nil {
+			c.errorf("stale-while-revalidate: key=%s: %v", key, errDecode)
+			return
+		}
+
+		c.rememberToken(key, tok)
+	}()
+}
+
+// isTokenServerUnreachable checks if error is network failure or
+// token server 5xx status. Token loads failed on the owner peer are
+// relayed by groupcache as *groupcache.ErrRemoteCall, hiding the cause,
+// thus they also count as unreachable.
+func isTokenServerUnreachable(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	if errors.Is(err, &groupcache.ErrRemoteCall{}) {
+		return true
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+	return false
+}
@@ -0,0 +1,221 @@
+package clientcredentials
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/modernprogram/groupcache/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestStaleTokenGracePeriod(t *testing.T) {
+	testStaleToken(t, 10*time.Second, true)
+}
+
+func TestStaleTokenDisabled(t *testing.T) {
+	testStaleToken(t, 0, false)
+}
+
+func testStaleToken(t *testing.T, grace time.Duration, expectStale bool) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "abc"
+	expireIn := 1
+
+	tokenServerStat := serverStat{}
+	serverStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, token, expireIn)
+
+	validToken := func(t string) bool { return t == token }
+
+	srv := newServer(&serverStat, validToken)
+	defer srv.Close()
+
+	options := Options{
+		TokenURL:              ts.URL,
+		ClientID:              clientID,
+		ClientSecret:          clientSecret,
+		SoftExpireInSeconds:   -1,
+		StaleTokenGracePeriod: grace,
+		GroupcacheWorkspace:   groupcache.NewWorkspace(),
+		MetricsRegisterer:     prometheus.NewRegistry(),
+	}
+
+	client := New(options)
+
+	if _, errSend := send(client, srv.URL); errSend != nil {
+		t.Errorf("send 1: %v", errSend)
+	}
+
+	// token server outage
+	ts.Close()
+
+	time.Sleep(1100 * time.Millisecond) // wait hard expiration
+
+	_, errSend := send(client, srv.URL)
+	if expectStale {
+		if errSend != nil {
+			t.Errorf("send 2: expected stale token: %v", errSend)
+		}
+	} else if errSend == nil {
+		t.Errorf("send 2: unexpected success without stale token")
+	}
+
+	var expectCount float64
+	if expectStale {
+		expectCount = 1
+	}
+	if count := testutil.ToFloat64(client.metrics.staleTokenServed); count != expectCount {
+		t.Errorf("unexpected stale token metric: %v", count)
+	}
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "abc"
+	expireIn := 3
+
+	tokenServerStat := serverStat{}
+	serverStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, token, expireIn)
+	defer ts.Close()
+
+	srv := newServer(&serverStat, func(t string) bool { return t == token })
+	defer srv.Close()
+
+	options := Options{
+		TokenURL:             ts.URL,
+		ClientID:             clientID,
+		ClientSecret:         clientSecret,
+		SoftExpireInSeconds:  2,
+		StaleWhileRevalidate: 1500 * time.Millisecond,
+		GroupcacheWorkspace:  groupcache.NewWorkspace(),
+		MetricsRegisterer:    prometheus.NewRegistry(),
+	}
+
+	client := New(options)
+
+	if _, errSend := send(client, srv.URL); errSend != nil {
+		t.Errorf("send 1: %v", errSend)
+	}
+
+	time.Sleep(1100 * time.Millisecond) // wait cache expiration
+
+	req, errReq := http.NewRequestWithContext(context.TODO(), "GET", srv.URL, nil)
+	if errReq != nil {
+		t.Fatalf("request: %v", errReq)
+	}
+	out, errDo := client.DoWithOutput(req, WithTrace())
+	if errDo != nil {
+		t.Fatalf("send 2: %v", errDo)
+	}
+	out.Response.Body.Close()
+
+	var found bool
+	for _, e := range out.Trace {
+		if e.Step == TraceStaleWhileRevalidate {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("missing stale-while-revalidate trace: %v", out.Trace)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	tokenServerStat.mutex.Lock()
+	count := tokenServerStat.count
+	tokenServerStat.mutex.Unlock()
+	if count != 2 {
+		t.Errorf("unexpected token server access count: %d", count)
+	}
+
+	if v := testutil.ToFloat64(client.metrics.staleWhileRevalidate); v != 1 {
+		t.Errorf("unexpected stale-while-revalidate metric: %v", v)
+	}
+}
+
+func TestStaleTokenMultiPeer(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "abc"
+
+	ts := newTokenServer(&serverStat{}, clientID, clientSecret, token, 1)
+
+	srv := newServer(&serverStat{}, func(t string) bool { return t == token })
+	defer srv.Close()
+
+	var clients []*Client
+	for _, ws := range newPeers(t, 2) {
+		client := New(Options{
+			TokenURL:              ts.URL,
+			ClientID:              clientID,
+			ClientSecret:          clientSecret,
+			SoftExpireInSeconds:   -1,
+			StaleTokenGracePeriod: 10 * time.Second,
+			GroupcacheWorkspace:   ws,
+		})
+		defer client.Close()
+		clients = append(clients, client)
+	}
+
+	for i, client := range clients {
+		if _, errSend := send(client, srv.URL); errSend != nil {
+			t.Errorf("peer %d: send 1: %v", i, errSend)
+		}
+	}
+
+	// token server outage
+	ts.Close()
+
+	time.Sleep(1100 * time.Millisecond) // wait hard expiration
+
+	// the peer not owning the key gets the owner load failure
+	for i, client := range clients {
+		if _, errSend := send(client, srv.URL); errSend != nil {
+			t.Errorf("peer %d: send 2: expected stale token: %v", i, errSend)
+		}
+	}
+}
+
+func TestStaleTokenConcurrent(t *testing.T) {
+
+	ts := newTokenServer(&serverStat{}, "clientID", "clientSecret", "abc", 1)
+
+	srv := newServer(&serverStat{}, func(t string) bool { return t == "abc" })
+	defer srv.Close()
+
+	client := New(Options{
+		TokenURL:              ts.URL,
+		ClientID:              "clientID",
+		ClientSecret:          "clientSecret",
+		SoftExpireInSeconds:   -1,
+		StaleTokenGracePeriod: 10 * time.Second,
+		GroupcacheWorkspace:   groupcache.NewWorkspace(),
+	})
+	defer client.Close()
+
+	if _, errSend := send(client, srv.URL); errSend != nil {
+		t.Fatalf("send: %v", errSend)
+	}
+
+	// token server outage
+	ts.Close()
+
+	time.Sleep(1100 * time.Millisecond) // wait hard expiration
+
+	for _, status := range doConcurrent(t, client, srv.URL) {
+		if status != http.StatusOK {
+			t.Errorf("expected stale token, got status: %d", status)
+		}
+	}
+}
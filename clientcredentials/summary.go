@@ -0,0 +1,96 @@
+package clientcredentials
+
+import (
+	"github.com/modernprogram/groupcache/v2"
+)
+
+// cacheCounters is a snapshot of cumulative groupcache counters.
+type cacheCounters struct {
+	gets       int64
+	hits       int64
+	fetches    int64
+	fetchErrs  int64
+	cacheItems int64
+	cacheBytes int64
+	evictions  int64
+}
+
+func (c *Client) readCacheCounters() cacheCounters {
+	main := c.group.CacheStats(groupcache.MainCache)
+	hot := c.group.CacheStats(groupcache.HotCache)
+	return cacheCounters{
+		gets:       c.group.Stats.Gets.Get(),
+		hits:       c.group.Stats.CacheHits.Get(),
+		fetches:    c.group.Stats.LocalLoads.Get() + c.group.Stats.LocalLoadErrs.Get(),
+		fetchErrs:  c.group.Stats.LocalLoadErrs.Get(),
+		cacheItems: main.Items + hot.Items,
+		cacheBytes: main.Bytes + hot.Bytes,
+		evictions:  main.Evictions + hot.Evictions,
+	}
+}
+
+// Stats holds cumulative cache statistics.
+type Stats struct {
+	// Gets counts cache lookups, including from peers.
+	Gets int64
+
+	// Hits counts lookups served from cache.
+	Hits int64
+
+	// Misses counts lookups not served from cache.
+	Misses int64
+
+	// Fills counts tokens fetched into cache by this instance.
+	Fills int64
+
+	// FillErrors counts failed token fetches by this instance.
+	FillErrors int64
+
+	// Evictions counts items evicted from cache.
+	Evictions int64
+
+	// Items is the current number of cached items.
+	Items int64
+
+	// Bytes is the current cache size.
+	Bytes int64
+}
+
+// Stats returns cache statistics, for services without Prometheus.
+// Stats are available only for the default groupcache TokenCache,
+// otherwise the zero value is returned.
+func (c *Client) Stats() Stats {
+	if c.group == nil {
+		return Stats{}
+	}
+	cur := c.readCacheCounters()
+	return Stats{
+		Gets:       cur.gets,
+		Hits:       cur.hits,
+		Misses:     cur.gets - cur.hits,
+		Fills:      cur.fetches - cur.fetchErrs,
+		FillErrors: cur.fetchErrs,
+		Evictions:  cur.evictions,
+		Items:      cur.cacheItems,
+		Bytes:      cur.cacheBytes,
+	}
+}
+
+// logSummary logs counters since the last summary and returns the current ones.
+func (c *Client) logSummary(last cacheCounters) cacheCounters {
+	cur := c.readCacheCounters()
+
+	gets := cur.gets - last.gets
+	hits := cur.hits - last.hits
+
+	var hitRatio float64
+	if gets > 0 {
+		hitRatio = float64(hits) / float64(gets)
+	}
+
+	c.infof("cache summary: items=%d bytes=%d gets=%d hit_ratio=%.2f token_fetches=%d token_fetch_errors=%d",
+		cur.cacheItems, cur.cacheBytes, gets, hitRatio,
+		cur.fetches-last.fetches, cur.fetchErrs-last.fetchErrs)
+
+	return cur
+}
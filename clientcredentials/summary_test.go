@@ -0,0 +1,105 @@
+package clientcredentials
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+func TestSummaryLog(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "abc"
+	expireIn := 60
+
+	tokenServerStat := serverStat{}
+	serverStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, token, expireIn)
+	defer ts.Close()
+
+	srv := newServer(&serverStat, func(t string) bool { return t == token })
+	defer srv.Close()
+
+	var summaries []string
+	var mutex sync.Mutex
+
+	logf := func(format string, v ...any) {
+		msg := fmt.Sprintf(format, v...)
+		if strings.HasPrefix(msg, "INFO: cache summary:") {
+			mutex.Lock()
+			summaries = append(summaries, msg)
+			mutex.Unlock()
+		}
+	}
+
+	options := Options{
+		TokenURL:            ts.URL,
+		ClientID:            clientID,
+		ClientSecret:        clientSecret,
+		SummaryInterval:     50 * time.Millisecond,
+		Logf:                logf,
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	}
+
+	client := New(options)
+	defer client.Close()
+
+	for i := range 4 {
+		if _, errSend := send(client, srv.URL); errSend != nil {
+			t.Errorf("send %d: %v", i, errSend)
+		}
+	}
+
+	time.Sleep(80 * time.Millisecond)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(summaries) == 0 {
+		t.Fatalf("missing summary log")
+	}
+	expect := "gets=4 hit_ratio=0.75 token_fetches=1 token_fetch_errors=0"
+	if !strings.Contains(summaries[0], "items=1 ") || !strings.Contains(summaries[0], expect) {
+		t.Errorf("expected summary with %q, got: %s", expect, summaries[0])
+	}
+}
+
+func TestStats(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "abc"
+
+	tokenServerStat := serverStat{}
+	serverStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, token, 60)
+	defer ts.Close()
+
+	srv := newServer(&serverStat, func(t string) bool { return t == token })
+	defer srv.Close()
+
+	client := newClient(ts.URL, clientID, clientSecret, 0)
+
+	for range 3 {
+		if _, errSend := send(client, srv.URL); errSend != nil {
+			t.Errorf("send: %v", errSend)
+		}
+	}
+
+	stats := client.Stats()
+
+	expect := Stats{Gets: 3, Hits: 2, Misses: 1, Fills: 1, Items: 1, Bytes: stats.Bytes}
+	if stats != expect {
+		t.Errorf("expected %+v, got %+v", expect, stats)
+	}
+	if stats.Bytes == 0 {
+		t.Errorf("expected non-zero cache bytes")
+	}
+}
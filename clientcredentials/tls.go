@@ -0,0 +1,44 @@
+package clientcredentials
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// InsecureURLError reports a non-HTTPS URL rejected by Options.RequireTLS.
+type InsecureURLError struct {
+	// Role is the URL purpose: token, introspection or target.
+	Role string
+
+	// URL is the rejected URL.
+	URL string
+}
+
+func (e *InsecureURLError) Error() string {
+	return "require tls: insecure " + e.Role + " url: " + e.URL
+}
+
+// checkTLS returns *InsecureURLError if Options.RequireTLS is set
+// and u is neither HTTPS nor an allowed insecure host.
+func (c *Client) checkTLS(role string, u *url.URL) error {
+	if !c.options.RequireTLS || strings.EqualFold(u.Scheme, "https") {
+		return nil
+	}
+	if slices.Contains(c.options.InsecureHostsAllowed, u.Hostname()) {
+		return nil
+	}
+	return &InsecureURLError{Role: role, URL: u.Redacted()}
+}
+
+// checkTLSString parses rawURL for checkTLS.
+func (c *Client) checkTLSString(role, rawURL string) error {
+	if !c.options.RequireTLS || rawURL == "" {
+		return nil
+	}
+	u, errParse := url.Parse(rawURL)
+	if errParse != nil {
+		return &InsecureURLError{Role: role, URL: rawURL}
+	}
+	return c.checkTLS(role, u)
+}
@@ -0,0 +1,74 @@
+package clientcredentials
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+func TestRequireTLSNew(t *testing.T) {
+
+	table := []struct {
+		name        string
+		tokenURL    string
+		allowed     []string
+		expectPanic bool
+	}{
+		{"https", "https://token/oauth/token", nil, false},
+		{"http", "http://token/oauth/token", nil, true},
+		{"http allowed host", "http://localhost:8080/oauth/token", []string{"localhost"}, false},
+		{"http other host", "http://token/oauth/token", []string{"localhost"}, true},
+	}
+
+	for _, data := range table {
+		func() {
+			defer func() {
+				r := recover()
+				if gotPanic := r != nil; gotPanic != data.expectPanic {
+					t.Errorf("%s: expected panic=%t, got: %v", data.name, data.expectPanic, r)
+				}
+				if r != nil {
+					if _, isTLS := r.(*InsecureURLError); !isTLS {
+						t.Errorf("%s: unexpected panic: %v", data.name, r)
+					}
+				}
+			}()
+			New(Options{
+				TokenURL:             data.tokenURL,
+				ClientID:             "clientID",
+				RequireTLS:           true,
+				InsecureHostsAllowed: data.allowed,
+				GroupcacheWorkspace:  groupcache.NewWorkspace(),
+			})
+		}()
+	}
+}
+
+func TestRequireTLSDo(t *testing.T) {
+
+	client := New(Options{
+		TokenURL:             "http://127.0.0.1/oauth/token",
+		ClientID:             "clientID",
+		RequireTLS:           true,
+		InsecureHostsAllowed: []string{"127.0.0.1"},
+		GroupcacheWorkspace:  groupcache.NewWorkspace(),
+	})
+
+	req, errReq := http.NewRequestWithContext(context.TODO(), "GET", "http://target/api", nil)
+	if errReq != nil {
+		t.Fatalf("request: %v", errReq)
+	}
+
+	_, errDo := client.Do(req)
+
+	var errTLS *InsecureURLError
+	if !errors.As(errDo, &errTLS) {
+		t.Fatalf("expected InsecureURLError, got: %v", errDo)
+	}
+	if errTLS.Role != "target" {
+		t.Errorf("unexpected role: %s", errTLS.Role)
+	}
+}
@@ -0,0 +1,61 @@
+package clientcredentials
+
+import (
+	"context"
+	"time"
+)
+
+// Token is an access token returned by Client.Token.
+type Token struct {
+	// AccessToken is the raw access token.
+	AccessToken string
+
+	// TokenType is the token type, e.g. Bearer.
+	TokenType string
+
+	// Expire is the token hard expiration, zero if unknown.
+	Expire time.Time
+
+	// ClientID is the client the token was issued to.
+	ClientID string
+
+	// Scope is the scope granted by the token server, if reported.
+	Scope string
+
+	// ObtainedAt is the time the token was fetched from the token server,
+	// zero if unknown.
+	ObtainedAt time.Time
+}
+
+// Authorization returns the Authorization header value for the token,
+// e.g. for gRPC metadata or websocket handshakes.
+func (t Token) Authorization() string {
+	return t.TokenType + " " + t.AccessToken
+}
+
+// Token returns the cached token, renewing it as necessary, for callers
+// attaching the token to non-HTTP protocols, e.g. AMQP or gRPC metadata.
+// Credentials from ContextWithCredentials or Options.CredentialsProvider,
+// and ContextWithForceRefresh, are honored.
+func (c *Client) Token(ctx context.Context) (Token, error) {
+	c, source, errCreds := c.forRequest(ctx, nil)
+	if errCreds != nil {
+		return Token{}, errCreds
+	}
+	if c.forceRefresh(ctx, nil) {
+		c.evict(ctx, c.cacheKey())
+	}
+	tok, errToken := c.getToken(ctx, c.cacheKey())
+	if errToken != nil {
+		c.invalidCredentials(source, errToken)
+		return Token{}, errToken
+	}
+	return Token{
+		AccessToken: tok.accessToken,
+		TokenType:   tok.tokenType,
+		Expire:      tok.hardExpire,
+		ClientID:    c.options.ClientID,
+		Scope:       tok.scope,
+		ObtainedAt:  tok.obtainedAt,
+	}, nil
+}
@@ -0,0 +1,47 @@
+package clientcredentials
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestToken(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+
+	tokenServerStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, "abc", 60)
+	defer ts.Close()
+
+	client := newClient(ts.URL, clientID, clientSecret, 0)
+
+	begin := time.Now()
+
+	for i := range 2 {
+		tok, errTok := client.Token(context.TODO())
+		if errTok != nil {
+			t.Fatalf("token %d: %v", i, errTok)
+		}
+		if tok.AccessToken != "abc" || tok.ClientID != clientID {
+			t.Errorf("token %d: unexpected token: %+v", i, tok)
+		}
+		if auth := tok.Authorization(); auth != "Bearer abc" {
+			t.Errorf("token %d: unexpected authorization: %q", i, auth)
+		}
+		if ttl := tok.Expire.Sub(begin); ttl < 59*time.Second || ttl > 61*time.Second {
+			t.Errorf("token %d: unexpected expire: %v", i, tok.Expire)
+		}
+	}
+
+	if tokenServerStat.count != 1 {
+		t.Errorf("expected cached token, got %d token requests", tokenServerStat.count)
+	}
+
+	bad := newClient(ts.URL, clientID, "wrong", 0)
+	if _, errTok := bad.Token(context.TODO()); errTok == nil {
+		t.Errorf("expected error for bad credentials")
+	}
+}
@@ -0,0 +1,198 @@
+package clientcredentials
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+// TokenCache stores cached token values. Values are opaque strings
+// built by the client.
+type TokenCache interface {
+	// Get returns the value cached for key and its expiration.
+	// On cache miss, Get calls load and caches its result until expire.
+	// Concurrent misses for the same key should share a single load.
+	Get(ctx context.Context, key string,
+		load func(ctx context.Context) (string, time.Time, error)) (string, time.Time, error)
+
+	// Set replaces the value cached for key.
+	Set(ctx context.Context, key, value string, expire time.Time) error
+
+	// Remove evicts key from the cache.
+	Remove(ctx context.Context, key string) error
+}
+
+// groupcacheTokenCache is the default TokenCache, backed by groupcache.
+// The load function is fixed at group creation, since groupcache
+// may load the value on a peer, hence it receives the key.
+type groupcacheTokenCache struct {
+	group *groupcache.Group
+}
+
+func newGroupcacheTokenCache(options Options, cacheName string,
+	load func(ctx context.Context, key string) (string, time.Time, error)) *groupcacheTokenCache {
+
+	cacheSizeBytes := options.GroupcacheSizeBytes
+	if cacheSizeBytes == 0 {
+		cacheSizeBytes = DefaultGroupCacheSizeBytes
+	}
+
+	o := groupcache.Options{
+		Workspace:       options.GroupcacheWorkspace,
+		Name:            cacheName,
+		PurgeExpired:    !options.DisablePurgeExpired,
+		CacheBytes:      cacheSizeBytes,
+		Getter:          newGetter(load),
+		MainCacheWeight: options.GroupcacheMainCacheWeight,
+		HotCacheWeight:  options.GroupcacheHotCacheWeight,
+	}
+
+	return &groupcacheTokenCache{group: groupcache.NewGroupWithWorkspace(o)}
+}
+
+// newGetter adapts a load function to groupcache.Getter.
+func newGetter(load func(ctx context.Context, key string) (string, time.Time, error)) groupcache.Getter {
+	return groupcache.GetterFunc(
+		func(ctx context.Context, key string, dest groupcache.Sink) error {
+			value, expire, errFetch := load(ctx, key)
+			if errFetch != nil {
+				return &peerLoadError{err: errFetch}
+			}
+			return dest.SetString(value, expire)
+		})
+}
+
+// Getter returns the groupcache getter loading tokens for this client
+// and clients derived from it, for groups provided with
+// Options.GroupcacheGroup.
+func (c *Client) Getter() groupcache.Getter {
+	return newGetter(c.loadKey)
+}
+
+func (gc *groupcacheTokenCache) Get(ctx context.Context, key string,
+	_ func(ctx context.Context) (string, time.Time, error)) (string, time.Time, error) {
+	var view groupcache.ByteView
+	if errGet := gc.group.Get(ctx, key, groupcache.ByteViewSink(&view)); errGet != nil {
+		return "", time.Time{}, peerError(errGet)
+	}
+	return view.String(), view.Expire(), nil
+}
+
+func (gc *groupcacheTokenCache) Set(ctx context.Context, key, value string, expire time.Time) error {
+	return gc.group.Set(ctx, key, []byte(value), expire, true)
+}
+
+func (gc *groupcacheTokenCache) Remove(ctx context.Context, key string) error {
+	return gc.group.Remove(ctx, key)
+}
+
+// MemoryTokenCache is a process-local TokenCache, for deployments
+// without groupcache peering.
+type MemoryTokenCache struct {
+	entries map[string]memoryEntry
+	loading map[string]*memoryLoad
+	mutex   sync.Mutex
+}
+
+type memoryEntry struct {
+	value  string
+	expire time.Time
+}
+
+// memoryLoad is a load in progress, shared by concurrent misses.
+type memoryLoad struct {
+	done  chan struct{}
+	entry memoryEntry
+	err   error
+
+	// canceled reports the load failed with the context of its caller
+	// done, an error other callers should not share.
+	canceled bool
+}
+
+// NewMemoryTokenCache creates a process-local token cache.
+func NewMemoryTokenCache() *MemoryTokenCache {
+	return &MemoryTokenCache{
+		entries: map[string]memoryEntry{},
+		loading: map[string]*memoryLoad{},
+	}
+}
+
+// Get returns the cached value, loading it on miss. Concurrent misses
+// wait for the load of the first caller; if that load fails because
+// the first caller's context is done, waiters with a live context
+// retry instead of sharing the error.
+func (m *MemoryTokenCache) Get(ctx context.Context, key string,
+	load func(ctx context.Context) (string, time.Time, error)) (string, time.Time, error) {
+
+	for {
+		value, expire, retry, err := m.get(ctx, key, load)
+		if !retry {
+			return value, expire, err
+		}
+	}
+}
+
+// get returns retry=true if it waited for a load canceled by its caller.
+func (m *MemoryTokenCache) get(ctx context.Context, key string,
+	load func(ctx context.Context) (string, time.Time, error)) (string, time.Time, bool, error) {
+
+	m.mutex.Lock()
+	if e, found := m.entries[key]; found {
+		if e.expire.IsZero() || time.Now().Before(e.expire) {
+			m.mutex.Unlock()
+			return e.value, e.expire, false, nil
+		}
+		delete(m.entries, key)
+	}
+	if l, found := m.loading[key]; found {
+		m.mutex.Unlock()
+		select {
+		case <-l.done:
+			if l.canceled && ctx.Err() == nil {
+				return "", time.Time{}, true, nil
+			}
+			return l.entry.value, l.entry.expire, false, l.err
+		case <-ctx.Done():
+			return "", time.Time{}, false, ctx.Err()
+		}
+	}
+	l := &memoryLoad{done: make(chan struct{})}
+	m.loading[key] = l
+	m.mutex.Unlock()
+
+	value, expire, errLoad := load(ctx)
+
+	l.entry = memoryEntry{value: value, expire: expire}
+	l.err = errLoad
+	l.canceled = errLoad != nil && ctx.Err() != nil
+
+	m.mutex.Lock()
+	delete(m.loading, key)
+	if errLoad == nil {
+		m.entries[key] = l.entry
+	}
+	m.mutex.Unlock()
+
+	close(l.done)
+
+	return value, expire, false, errLoad
+}
+
+// Set replaces the cached value.
+func (m *MemoryTokenCache) Set(_ context.Context, key, value string, expire time.Time) error {
+	m.mutex.Lock()
+	m.entries[key] = memoryEntry{value: value, expire: expire}
+	m.mutex.Unlock()
+	return nil
+}
+
+// Remove evicts the key.
+func (m *MemoryTokenCache) Remove(_ context.Context, key string) error {
+	m.mutex.Lock()
+	delete(m.entries, key)
+	m.mutex.Unlock()
+	return nil
+}
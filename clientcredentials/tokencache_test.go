@@ -0,0 +1,230 @@
+package clientcredentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/modernprogram/groupcache/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMemoryTokenCache(t *testing.T) {
+	cache := NewMemoryTokenCache()
+
+	ctx := context.TODO()
+
+	var loads atomic.Int32
+	load := func(context.Context) (string, time.Time, error) {
+		loads.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		return "value", time.Now().Add(50 * time.Millisecond), nil
+	}
+
+	// concurrent misses share one load
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if value, _, errGet := cache.Get(ctx, "key", load); errGet != nil || value != "value" {
+				t.Errorf("get: value=%q error=%v", value, errGet)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := loads.Load(); n != 1 {
+		t.Errorf("unexpected load count: %d", n)
+	}
+
+	// expiration
+
+	time.Sleep(60 * time.Millisecond)
+
+	cache.Get(ctx, "key", load)
+	if n := loads.Load(); n != 2 {
+		t.Errorf("unexpected load count after expiration: %d", n)
+	}
+
+	// errors are not cached
+
+	errLoad := errors.New("load failure")
+	failLoad := func(context.Context) (string, time.Time, error) {
+		return "", time.Time{}, errLoad
+	}
+	if _, _, errGet := cache.Get(ctx, "other", failLoad); !errors.Is(errGet, errLoad) {
+		t.Errorf("unexpected error: %v", errGet)
+	}
+	if value, _, _ := cache.Get(ctx, "other", load); value != "value" {
+		t.Errorf("failed load was cached: %q", value)
+	}
+}
+
+func TestMemoryTokenCacheLeaderCanceled(t *testing.T) {
+	cache := NewMemoryTokenCache()
+
+	started := make(chan struct{})
+	var loads atomic.Int32
+	load := func(ctx context.Context) (string, time.Time, error) {
+		if loads.Add(1) == 1 {
+			close(started)
+			<-ctx.Done()
+			return "", time.Time{}, fmt.Errorf("fetch: %v", ctx.Err()) // wrapped without %w
+		}
+		return "value", time.Now().Add(time.Minute), nil
+	}
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, _, errGet := cache.Get(leaderCtx, "key", load)
+		leaderErr <- errGet
+	}()
+	<-started
+
+	// waiter joins the load in progress, then the leader gives up
+
+	waiterValue := make(chan string, 1)
+	go func() {
+		value, _, errGet := cache.Get(context.Background(), "key", load)
+		if errGet != nil {
+			t.Errorf("waiter: unexpected error: %v", errGet)
+		}
+		waiterValue <- value
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	if errGet := <-leaderErr; errGet == nil {
+		t.Errorf("leader: expected error")
+	}
+	if value := <-waiterValue; value != "value" {
+		t.Errorf("waiter: unexpected value: %q", value)
+	}
+	if n := loads.Load(); n != 2 {
+		t.Errorf("expected 2 loads, got %d", n)
+	}
+}
+
+func TestClientWithMemoryTokenCache(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "abc"
+	expireIn := 60
+
+	tokenServerStat := serverStat{}
+	serverStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, token, expireIn)
+	defer ts.Close()
+
+	srv := newServer(&serverStat, func(t string) bool { return t == token })
+	defer srv.Close()
+
+	client := New(Options{
+		TokenURL:     ts.URL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		TokenCache:   NewMemoryTokenCache(),
+	})
+
+	for i := range 2 {
+		if _, errSend := send(client, srv.URL); errSend != nil {
+			t.Errorf("send %d: %v", i, errSend)
+		}
+	}
+	if tokenServerStat.count != 1 {
+		t.Errorf("unexpected token server access count: %d", tokenServerStat.count)
+	}
+	if client.MetricsExporter() != nil {
+		t.Errorf("unexpected groupcache exporter with memory cache")
+	}
+}
+
+func TestGroupcacheGroup(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+
+	tokenServerStat := serverStat{}
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, "abc", 60)
+	defer ts.Close()
+
+	var client *Client
+
+	group := groupcache.NewGroupWithWorkspace(groupcache.Options{
+		Workspace:  groupcache.NewWorkspace(),
+		Name:       "app-tokens",
+		CacheBytes: 1_000_000,
+		Getter: groupcache.GetterFunc(func(ctx context.Context, key string, dest groupcache.Sink) error {
+			return client.Getter().Get(ctx, key, dest)
+		}),
+	})
+
+	client = New(Options{
+		TokenURL:        ts.URL,
+		ClientID:        clientID,
+		ClientSecret:    clientSecret,
+		GroupcacheGroup: group,
+	})
+
+	if client.group != group {
+		t.Errorf("expected injected group")
+	}
+
+	for range 2 {
+		tok, errTok := client.Token(context.TODO())
+		if errTok != nil {
+			t.Fatalf("token: %v", errTok)
+		}
+		if tok.AccessToken != "abc" {
+			t.Errorf("unexpected token: %s", tok.AccessToken)
+		}
+	}
+
+	if tokenServerStat.count != 1 {
+		t.Errorf("expected cached token, got %d token requests", tokenServerStat.count)
+	}
+}
+
+func TestGroupcacheGroupSharedMetrics(t *testing.T) {
+
+	ts := newTokenServer(&serverStat{}, "clientID", "clientSecret", "abc", 60)
+	defer ts.Close()
+
+	group := groupcache.NewGroupWithWorkspace(groupcache.Options{
+		Workspace:  groupcache.NewWorkspace(),
+		Name:       "app-tokens",
+		CacheBytes: 1_000_000,
+		Getter: groupcache.GetterFunc(func(context.Context, string, groupcache.Sink) error {
+			return errors.New("unused")
+		}),
+	})
+
+	registry := prometheus.NewRegistry()
+
+	var clients []*Client
+	for range 2 {
+		client := New(Options{
+			TokenURL:          ts.URL,
+			ClientID:          "clientID",
+			ClientSecret:      "clientSecret",
+			GroupcacheGroup:   group,
+			MetricsRegisterer: registry,
+		})
+		defer client.Close()
+		clients = append(clients, client)
+	}
+
+	if clients[0].metrics != clients[1].metrics {
+		t.Errorf("expected shared metrics")
+	}
+}
@@ -0,0 +1,72 @@
+package clientcredentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// TokenError reports failure to obtain a token, returned by Do and
+// DoWithOutput. The underlying error is available with errors.As,
+// e.g. *StatusError.
+type TokenError struct {
+	Err error
+
+	// SuggestedStatus is the HTTP status suggested for gateways
+	// reporting the failure downstream:
+	// 401 if the token server rejected the client credentials,
+	// 504 on timeout, 502 otherwise.
+	// Failures relayed by the groupcache peer owning the token
+	// are mapped the same way, see peerError.
+	SuggestedStatus int
+}
+
+func (e *TokenError) Error() string {
+	return "token: " + e.Err.Error()
+}
+
+func (e *TokenError) Unwrap() error {
+	return e.Err
+}
+
+func newTokenError(err error) *TokenError {
+	return &TokenError{Err: err, SuggestedStatus: suggestStatus(err)}
+}
+
+// suggestStatus maps token retrieval errors to downstream HTTP status.
+func suggestStatus(err error) int {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden:
+			return http.StatusUnauthorized
+		case http.StatusGatewayTimeout:
+			return http.StatusGatewayTimeout
+		}
+		return http.StatusBadGateway
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return http.StatusGatewayTimeout
+	}
+
+	return http.StatusBadGateway
+}
+
+// ShortLifetimeError reports a token with lifetime below Options.MinTokenLifetime.
+type ShortLifetimeError struct {
+	ExpiresIn        time.Duration
+	MinTokenLifetime time.Duration
+}
+
+func (e *ShortLifetimeError) Error() string {
+	return fmt.Sprintf("token lifetime %v below minimum %v", e.ExpiresIn, e.MinTokenLifetime)
+}
@@ -0,0 +1,206 @@
+package clientcredentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+type suggestStatusTestCase struct {
+	name   string
+	err    error
+	expect int
+}
+
+var suggestStatusTestTable = []suggestStatusTestCase{
+	{"invalid client", &StatusError{StatusCode: 401}, http.StatusUnauthorized},
+	{"bad request", &StatusError{StatusCode: 400}, http.StatusUnauthorized},
+	{"token server down", &StatusError{StatusCode: 503}, http.StatusBadGateway},
+	{"token server timeout", &StatusError{StatusCode: 504}, http.StatusGatewayTimeout},
+	{"deadline", fmt.Errorf("post: %w", context.DeadlineExceeded), http.StatusGatewayTimeout},
+	{"other", errors.New("parse token"), http.StatusBadGateway},
+	{"peer invalid client", relayPeerError(&StatusError{StatusCode: 401}), http.StatusUnauthorized},
+	{"peer deadline", relayPeerError(context.DeadlineExceeded), http.StatusGatewayTimeout},
+	{"peer token server down", relayPeerError(&StatusError{StatusCode: 503}), http.StatusBadGateway},
+}
+
+// relayPeerError returns err as received from the owner peer.
+func relayPeerError(err error) error {
+	return peerError(&groupcache.ErrRemoteCall{Msg: (&peerLoadError{err: err}).Error()})
+}
+
+func TestSuggestStatus(t *testing.T) {
+	for _, data := range suggestStatusTestTable {
+		if got := suggestStatus(data.err); got != data.expect {
+			t.Errorf("%s: expected=%d got=%d", data.name, data.expect, got)
+		}
+	}
+}
+
+func TestTokenError(t *testing.T) {
+
+	tokenServerStat := serverStat{}
+	serverStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, "clientID", "clientSecret", "abc", 60)
+	defer ts.Close()
+
+	srv := newServer(&serverStat, func(t string) bool { return t == "abc" })
+	defer srv.Close()
+
+	client := newClient(ts.URL, "clientID", "wrongSecret", 0)
+
+	req, errReq := http.NewRequestWithContext(context.TODO(), "GET", srv.URL, nil)
+	if errReq != nil {
+		t.Fatalf("request: %v", errReq)
+	}
+
+	_, errDo := client.Do(req)
+
+	var tokenErr *TokenError
+	if !errors.As(errDo, &tokenErr) {
+		t.Fatalf("expected TokenError, got: %v", errDo)
+	}
+	if tokenErr.SuggestedStatus != http.StatusUnauthorized {
+		t.Errorf("unexpected suggested status: %d", tokenErr.SuggestedStatus)
+	}
+
+	var statusErr *StatusError
+	if !errors.As(errDo, &statusErr) || statusErr.StatusCode != 401 {
+		t.Errorf("expected wrapped StatusError, got: %v", errDo)
+	}
+}
+
+func TestTokenErrorMultiPeer(t *testing.T) {
+
+	ts := newTokenServer(&serverStat{}, "clientID", "clientSecret", "abc", 60)
+	defer ts.Close()
+
+	srv := newServer(&serverStat{}, func(t string) bool { return t == "abc" })
+	defer srv.Close()
+
+	var clients []*Client
+	for _, ws := range newPeers(t, 2) {
+		client := New(Options{
+			TokenURL:            ts.URL,
+			ClientID:            "clientID",
+			ClientSecret:        "wrongSecret",
+			GroupcacheWorkspace: ws,
+		})
+		defer client.Close()
+		clients = append(clients, client)
+	}
+
+	// the peer not owning the key gets the error relayed by the owner
+	for i, client := range clients {
+		req, errReq := http.NewRequestWithContext(context.TODO(), "GET", srv.URL, nil)
+		if errReq != nil {
+			t.Fatalf("request: %v", errReq)
+		}
+
+		_, errDo := client.Do(req)
+
+		var tokenErr *TokenError
+		if !errors.As(errDo, &tokenErr) {
+			t.Errorf("peer %d: expected TokenError, got: %v", i, errDo)
+			continue
+		}
+		if tokenErr.SuggestedStatus != http.StatusUnauthorized {
+			t.Errorf("peer %d: unexpected suggested status: %d", i, tokenErr.SuggestedStatus)
+		}
+	}
+}
+
+func TestMinTokenLifetime(t *testing.T) {
+
+	tokenServerStat := serverStat{}
+	serverStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, "clientID", "clientSecret", "abc", 30)
+	defer ts.Close()
+
+	srv := newServer(&serverStat, func(t string) bool { return t == "abc" })
+	defer srv.Close()
+
+	client := New(Options{
+		TokenURL:            ts.URL,
+		ClientID:            "clientID",
+		ClientSecret:        "clientSecret",
+		MinTokenLifetime:    time.Minute,
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+
+	req, errReq := http.NewRequestWithContext(context.TODO(), "GET", srv.URL, nil)
+	if errReq != nil {
+		t.Fatalf("request: %v", errReq)
+	}
+
+	_, errDo := client.Do(req)
+
+	var shortErr *ShortLifetimeError
+	if !errors.As(errDo, &shortErr) {
+		t.Errorf("expected ShortLifetimeError, got: %v", errDo)
+	}
+}
+
+func TestLifetimeShorterThanSoftExpire(t *testing.T) {
+
+	tokenServerStat := serverStat{}
+	serverStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, "clientID", "clientSecret", "abc", 2)
+	defer ts.Close()
+
+	srv := newServer(&serverStat, func(t string) bool { return t == "abc" })
+	defer srv.Close()
+
+	client := newClient(ts.URL, "clientID", "clientSecret", 0) // default soft expire 10s
+
+	for i := range 2 {
+		if _, errSend := send(client, srv.URL); errSend != nil {
+			t.Errorf("send %d: %v", i, errSend)
+		}
+	}
+	if tokenServerStat.count != 1 {
+		t.Errorf("unexpected token server access count: %d", tokenServerStat.count)
+	}
+}
+
+func TestMaxTokenLifetime(t *testing.T) {
+
+	tokenServerStat := serverStat{}
+	serverStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, "clientID", "clientSecret", "abc", 3600)
+	defer ts.Close()
+
+	srv := newServer(&serverStat, func(t string) bool { return t == "abc" })
+	defer srv.Close()
+
+	client := New(Options{
+		TokenURL:            ts.URL,
+		ClientID:            "clientID",
+		ClientSecret:        "clientSecret",
+		SoftExpireInSeconds: -1,
+		MaxTokenLifetime:    time.Second,
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+
+	if _, errSend := send(client, srv.URL); errSend != nil {
+		t.Errorf("send 1: %v", errSend)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+
+	if _, errSend := send(client, srv.URL); errSend != nil {
+		t.Errorf("send 2: %v", errSend)
+	}
+	if tokenServerStat.count != 2 {
+		t.Errorf("unexpected token server access count: %d", tokenServerStat.count)
+	}
+}
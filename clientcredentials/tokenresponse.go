@@ -0,0 +1,73 @@
+package clientcredentials
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// TokenResponse describes a raw token server response passed to
+// Options.OnTokenResponse and Options.TokenTTLFunc.
+type TokenResponse struct {
+	// StatusCode is the HTTP status code.
+	StatusCode int
+
+	// Header holds the response headers, e.g. rate-limit headers.
+	Header http.Header
+
+	// Body is the response body with secret fields redacted.
+	// Non-JSON bodies are kept only for non-Ok status codes,
+	// since they could carry the token in unknown form.
+	Body string
+
+	// Elapsed is the token request duration.
+	Elapsed time.Duration
+}
+
+// redacted replaces secret values in sanitized token response bodies.
+const redacted = "REDACTED"
+
+// tokenSecretFields lists token response fields holding secrets.
+var tokenSecretFields = []string{"access_token", "refresh_token", "id_token"}
+
+// sanitizeTokenBody redacts secret fields from a JSON token response.
+// ok reports whether the status code is accepted as Ok.
+func sanitizeTokenBody(body []byte, ok bool) string {
+	var data map[string]json.RawMessage
+	if errJSON := json.Unmarshal(body, &data); errJSON != nil {
+		if ok {
+			return ""
+		}
+		return string(body)
+	}
+	for _, f := range tokenSecretFields {
+		if _, found := data[f]; found {
+			data[f] = json.RawMessage(`"` + redacted + `"`)
+		}
+	}
+	buf, errMarshal := json.Marshal(data)
+	if errMarshal != nil {
+		return ""
+	}
+	return string(buf)
+}
+
+// notifyTokenResponse calls Options.OnTokenResponse, if defined.
+// It returns the TokenResponse for Options.TokenTTLFunc, or the
+// zero value when no hook is defined.
+func (c *Client) notifyTokenResponse(resp *http.Response, body []byte, elapsed time.Duration) TokenResponse {
+	if c.options.OnTokenResponse == nil && c.options.TokenTTLFunc == nil {
+		return TokenResponse{}
+	}
+	ok := resp.StatusCode >= c.options.HTTPStatusOkMin && resp.StatusCode <= c.options.HTTPStatusOkMax
+	tr := TokenResponse{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Body:       sanitizeTokenBody(body, ok),
+		Elapsed:    elapsed,
+	}
+	if c.options.OnTokenResponse != nil {
+		c.options.OnTokenResponse(tr)
+	}
+	return tr
+}
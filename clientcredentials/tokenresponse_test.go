@@ -0,0 +1,130 @@
+package clientcredentials
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+type sanitizeTestCase struct {
+	name   string
+	body   string
+	ok     bool
+	expect string
+}
+
+var sanitizeTestTable = []sanitizeTestCase{
+	{"redact token", `{"access_token":"abc","expires_in":60}`, true, `{"access_token":"REDACTED","expires_in":60}`},
+	{"redact all secrets", `{"access_token":"abc","id_token":"x","refresh_token":"y"}`, true, `{"access_token":"REDACTED","id_token":"REDACTED","refresh_token":"REDACTED"}`},
+	{"error json", `{"error":"invalid_client"}`, false, `{"error":"invalid_client"}`},
+	{"ok non-json", `access_token=abc`, true, ``},
+	{"error non-json", `bad gateway`, false, `bad gateway`},
+}
+
+func TestSanitizeTokenBody(t *testing.T) {
+	for _, data := range sanitizeTestTable {
+		got := sanitizeTokenBody([]byte(data.body), data.ok)
+		if got != data.expect {
+			t.Errorf("%s: expected=%q got=%q", data.name, data.expect, got)
+		}
+	}
+}
+
+func TestOnTokenResponse(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ /*r*/ *http.Request) {
+		w.Header().Set("X-Ratelimit-Remaining", "99")
+		httpJSON(w, `{"access_token":"abc","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	serverStat := serverStat{}
+	srv := newServer(&serverStat, func(t string) bool { return t == "abc" })
+	defer srv.Close()
+
+	var responses []TokenResponse
+
+	options := Options{
+		TokenURL:            ts.URL,
+		ClientID:            "clientID",
+		ClientSecret:        "clientSecret",
+		OnTokenResponse:     func(resp TokenResponse) { responses = append(responses, resp) },
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	}
+
+	client := New(options)
+
+	if _, errSend := send(client, srv.URL); errSend != nil {
+		t.Errorf("send: %v", errSend)
+	}
+
+	if len(responses) != 1 {
+		t.Fatalf("unexpected token response count: %d", len(responses))
+	}
+
+	resp := responses[0]
+
+	if resp.StatusCode != 200 {
+		t.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+	if v := resp.Header.Get("X-Ratelimit-Remaining"); v != "99" {
+		t.Errorf("unexpected rate-limit header: %q", v)
+	}
+	if strings.Contains(resp.Body, "abc") {
+		t.Errorf("token leaked in body: %s", resp.Body)
+	}
+}
+
+func TestTokenTTLFunc(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-Tier", "admin")
+		httpJSON(w, `{"access_token":"abc","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	table := []struct {
+		name      string
+		ttl       time.Duration
+		expectTTL time.Duration
+	}{
+		{"default", 0, 50 * time.Second},
+		{"shorter", 5 * time.Second, 5 * time.Second},
+		{"capped at lifetime", 2 * time.Minute, 60 * time.Second},
+	}
+
+	for _, data := range table {
+		client := New(Options{
+			TokenURL:            ts.URL,
+			ClientID:            "clientID",
+			ClientSecret:        "clientSecret",
+			GroupcacheWorkspace: groupcache.NewWorkspace(),
+			TokenTTLFunc: func(clientID string, resp TokenResponse) time.Duration {
+				if clientID != "clientID" || resp.Header.Get("X-Tier") != "admin" {
+					t.Errorf("%s: unexpected hook input: %s %v", data.name, clientID, resp.Header)
+				}
+				if strings.Contains(resp.Body, "abc") {
+					t.Errorf("%s: body leaks token: %s", data.name, resp.Body)
+				}
+				return data.ttl
+			},
+		})
+
+		begin := time.Now()
+		_, expire, errFetch := client.fetchValue(context.TODO())
+		if errFetch != nil {
+			t.Errorf("%s: fetch: %v", data.name, errFetch)
+			continue
+		}
+
+		ttl := expire.Sub(begin)
+		if ttl < data.expectTTL-time.Second || ttl > data.expectTTL+time.Second {
+			t.Errorf("%s: expected cache ttl %v, got %v", data.name, data.expectTTL, ttl)
+		}
+	}
+}
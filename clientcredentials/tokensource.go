@@ -0,0 +1,38 @@
+package clientcredentials
+
+import (
+	"context"
+
+	"golang.org/x/oauth2"
+)
+
+// TokenSource returns an oauth2.TokenSource backed by the client cache,
+// for libraries accepting an oauth2.TokenSource. Tokens are retrieved
+// with ctx.
+func (c *Client) TokenSource(ctx context.Context) oauth2.TokenSource {
+	return &tokenSource{ctx: ctx, client: c}
+}
+
+// TokenSourceFor returns an oauth2.TokenSource for another tenant,
+// backed by the shared cache. See WithCredentials.
+func (c *Client) TokenSourceFor(ctx context.Context, clientID, clientSecret string) oauth2.TokenSource {
+	return c.WithCredentials(clientID, clientSecret).TokenSource(ctx)
+}
+
+type tokenSource struct {
+	ctx    context.Context
+	client *Client
+}
+
+// Token implements oauth2.TokenSource.
+func (ts *tokenSource) Token() (*oauth2.Token, error) {
+	tok, errToken := ts.client.Token(ts.ctx)
+	if errToken != nil {
+		return nil, errToken
+	}
+	return &oauth2.Token{
+		AccessToken: tok.AccessToken,
+		TokenType:   tok.TokenType,
+		Expiry:      tok.Expire,
+	}, nil
+}
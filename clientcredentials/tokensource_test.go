@@ -0,0 +1,97 @@
+package clientcredentials
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestTokenSource(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+
+	tokenServerStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, "abc", 60)
+	defer ts.Close()
+
+	serverStat := serverStat{}
+	srv := newServer(&serverStat, func(t string) bool { return t == "abc" })
+	defer srv.Close()
+
+	client := newClient(ts.URL, clientID, clientSecret, 0)
+
+	httpClient := oauth2.NewClient(context.TODO(), client.TokenSource(context.TODO()))
+
+	for i := range 2 {
+		resp, errGet := httpClient.Get(srv.URL)
+		if errGet != nil {
+			t.Fatalf("get %d: %v", i, errGet)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != 200 {
+			t.Errorf("get %d: unexpected status: %d", i, resp.StatusCode)
+		}
+	}
+
+	if tokenServerStat.count != 1 {
+		t.Errorf("expected cached token, got %d token requests", tokenServerStat.count)
+	}
+}
+
+func TestTokenSourceFor(t *testing.T) {
+
+	tokenServerStat := serverStat{}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenServerStat.inc()
+		r.ParseForm()
+		id := formParam(r, "client_id")
+		if formParam(r, "client_secret") != "secret-"+id {
+			httpJSON(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		httpJSON(w, `{"access_token":"token-`+id+`","expires_in":60}`, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	root := newClient(ts.URL, "root", "secret-root", 0)
+
+	table := []struct {
+		clientID     string
+		clientSecret string
+		expectToken  string
+	}{
+		{"tenant1", "secret-tenant1", "token-tenant1"},
+		{"tenant2", "secret-tenant2", "token-tenant2"},
+		{"tenant1", "secret-tenant1", "token-tenant1"}, // cached
+	}
+
+	for _, data := range table {
+		tok, errTok := root.TokenSourceFor(context.TODO(), data.clientID, data.clientSecret).Token()
+		if errTok != nil {
+			t.Errorf("%s: token: %v", data.clientID, errTok)
+			continue
+		}
+		if tok.AccessToken != data.expectToken {
+			t.Errorf("%s: expected token %q, got %q", data.clientID, data.expectToken, tok.AccessToken)
+		}
+	}
+
+	if tokenServerStat.count != 2 {
+		t.Errorf("expected 2 token requests, got %d", tokenServerStat.count)
+	}
+
+	// rotated secret replaces the derived client
+
+	if _, errTok := root.TokenSourceFor(context.TODO(), "tenant3", "wrong").Token(); errTok == nil {
+		t.Errorf("expected error for wrong secret")
+	}
+	if _, errTok := root.TokenSourceFor(context.TODO(), "tenant3", "secret-tenant3").Token(); errTok != nil {
+		t.Errorf("rotated secret: %v", errTok)
+	}
+}
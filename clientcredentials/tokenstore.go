@@ -0,0 +1,69 @@
+package clientcredentials
+
+import (
+	"sync"
+	"time"
+)
+
+// storedToken records the last good token for a cache key, used by
+// features that need to track tokens beyond the cache: stale token
+// grace and token introspection.
+type storedToken struct {
+	authToken
+	hardExpire  time.Time
+	refreshAt   time.Time // set only with Options.RefreshAhead
+	cacheExpire time.Time // not cached, taken from cache entry
+	fetched     bool      // not cached, token fetched by the request
+}
+
+type tokenStore struct {
+	tokens map[string]storedToken
+	mutex  sync.Mutex
+}
+
+func newTokenStore() *tokenStore {
+	return &tokenStore{tokens: map[string]storedToken{}}
+}
+
+func (s *tokenStore) put(key string, t storedToken) {
+	s.mutex.Lock()
+	s.tokens[key] = t
+	s.mutex.Unlock()
+}
+
+func (s *tokenStore) get(key string) (storedToken, bool) {
+	s.mutex.Lock()
+	t, found := s.tokens[key]
+	s.mutex.Unlock()
+	return t, found
+}
+
+func (s *tokenStore) remove(key string) {
+	s.mutex.Lock()
+	delete(s.tokens, key)
+	s.mutex.Unlock()
+}
+
+// snapshot returns a copy of stored tokens.
+func (s *tokenStore) snapshot() map[string]storedToken {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	m := make(map[string]storedToken, len(s.tokens))
+	for k, v := range s.tokens {
+		m[k] = v
+	}
+	return m
+}
+
+// rememberToken records the token for stale usage, stale-while-revalidate
+// and introspection.
+func (c *Client) rememberToken(key string, t storedToken) {
+	if c.options.StaleTokenGracePeriod <= 0 && c.options.StaleWhileRevalidate <= 0 &&
+		c.options.IntrospectionURL == "" {
+		return
+	}
+	if t.hardExpire.IsZero() {
+		return
+	}
+	c.tokens.put(key, t)
+}
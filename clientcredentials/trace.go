@@ -0,0 +1,159 @@
+package clientcredentials
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Trace steps recorded in Output.Trace when WithTrace is used.
+const (
+	// TraceCacheGet marks the start of token retrieval from the cache.
+	TraceCacheGet = "cache_get"
+
+	// TraceCacheHit reports the token was obtained without a fetch by this
+	// request: from the local cache, from a peer, or from a concurrent fetch.
+	TraceCacheHit = "cache_hit"
+
+	// TraceLocalCacheHit reports the token was served from the
+	// in-process cache enabled by Options.LocalCache.
+	TraceLocalCacheHit = "local_cache_hit"
+
+	// TraceTokenFetch reports the token was fetched from the token server.
+	TraceTokenFetch = "token_fetch"
+
+	// TracePersistedToken reports the token was restored from Options.PersistDir.
+	TracePersistedToken = "persisted_token"
+
+	// TraceTokenFetchError reports a token retrieval failure.
+	TraceTokenFetchError = "token_fetch_error"
+
+	// TraceStaleToken reports an expired token was served within the grace period.
+	TraceStaleToken = "stale_token"
+
+	// TraceStaleWhileRevalidate reports an expired token was served
+	// while being renewed in background.
+	TraceStaleWhileRevalidate = "stale_while_revalidate"
+
+	// TraceRefreshAhead reports the cached token was served while
+	// being renewed in background.
+	TraceRefreshAhead = "refresh_ahead"
+
+	// TracePreservedAuthorization reports the request was sent with its own
+	// Authorization header, without token retrieval.
+	TracePreservedAuthorization = "preserved_authorization"
+
+	// TraceTokenRejected reports the target server refused the token,
+	// which was then evicted from the cache, unless introspection
+	// reported it as active.
+	TraceTokenRejected = "token_rejected"
+
+	// TraceForceRefresh reports the cached token was evicted before
+	// retrieval, see ContextWithForceRefresh.
+	TraceForceRefresh = "force_refresh"
+
+	// TraceRequestRetry reports the request was sent again with a fresh
+	// token after rejection. See Options.RetryOnUnauthorized.
+	TraceRequestRetry = "request_retry"
+)
+
+// TraceEvent is one step in the token decision path.
+type TraceEvent struct {
+	Time   time.Time
+	Step   string
+	Detail string
+}
+
+// RequestOption customizes a single DoWithOutput call.
+type RequestOption func(*requestOptions)
+
+type requestOptions struct {
+	trace                 bool
+	preserveAuthorization bool
+}
+
+// WithTrace records the token decision path into Output.Trace.
+func WithTrace() RequestOption {
+	return func(o *requestOptions) {
+		o.trace = true
+	}
+}
+
+// WithPreserveAuthorization skips token injection if the request already
+// carries an Authorization header, like Options.PreserveAuthorization.
+func WithPreserveAuthorization() RequestOption {
+	return func(o *requestOptions) {
+		o.preserveAuthorization = true
+	}
+}
+
+// tracer collects trace events. A nil tracer discards events.
+type tracer struct {
+	events []TraceEvent
+	mutex  sync.Mutex
+}
+
+func (t *tracer) add(step, detail string) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	t.events = append(t.events, TraceEvent{Time: time.Now(), Step: step, Detail: detail})
+	t.mutex.Unlock()
+}
+
+func (t *tracer) list() []TraceEvent {
+	if t == nil {
+		return nil
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([]TraceEvent(nil), t.events...)
+}
+
+// has checks if the step has been recorded.
+func (t *tracer) has(step string) bool {
+	if t == nil {
+		return false
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, e := range t.events {
+		if e.Step == step {
+			return true
+		}
+	}
+	return false
+}
+
+type tracerKey struct{}
+
+func withTracer(ctx context.Context, t *tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, t)
+}
+
+// tracerFrom retrieves the tracer from context, or nil.
+func tracerFrom(ctx context.Context) *tracer {
+	t, _ := ctx.Value(tracerKey{}).(*tracer)
+	return t
+}
+
+// fetchMark records whether the token load ran for the request, reported
+// as Output.TokenFetched. Loads shared by concurrent requests run with
+// the context of a single request.
+type fetchMark struct {
+	fetched bool
+}
+
+type fetchMarkKey struct{}
+
+func withFetchMark(ctx context.Context, m *fetchMark) context.Context {
+	return context.WithValue(ctx, fetchMarkKey{}, m)
+}
+
+// markFetched flags the fetchMark from context, if any.
+func markFetched(ctx context.Context) {
+	if m, found := ctx.Value(fetchMarkKey{}).(*fetchMark); found {
+		m.fetched = true
+	}
+}
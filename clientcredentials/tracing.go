@@ -0,0 +1,102 @@
+package clientcredentials
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies spans emitted with Options.TracerProvider.
+const tracerName = "github.com/udhos/groupcache_oauth2/clientcredentials"
+
+// newTracer returns nil if tp is nil, thus spans are skipped
+// without cost.
+func newTracer(tp trace.TracerProvider) trace.Tracer {
+	if tp == nil {
+		return nil
+	}
+	return tp.Tracer(tracerName)
+}
+
+// doWithSpan wraps DoWithOutput in a span, with the token cache hit
+// reported as the oauth2.cache_hit attribute. The span context is
+// propagated to the token fetch and to the request sent to the target
+// server.
+func (c *Client) doWithSpan(req *http.Request, do func(*http.Request) (Output, error)) (Output, error) {
+	if c.tracer == nil {
+		return do(req)
+	}
+
+	attrs := []attribute.KeyValue{attribute.String("http.request.method", req.Method)}
+	if req.URL != nil {
+		attrs = append(attrs, attribute.String("server.address", req.URL.Host))
+	}
+
+	ctx, span := c.tracer.Start(req.Context(), "clientcredentials.Do",
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	defer span.End()
+
+	out, err := do(req.WithContext(ctx))
+
+	if out.ClientID != "" {
+		span.SetAttributes(
+			attribute.String("oauth2.client_id", out.ClientID),
+			attribute.Bool("oauth2.cache_hit", !out.TokenFetched),
+		)
+	}
+	if out.Response != nil {
+		span.SetAttributes(attribute.Int("http.response.status_code", out.Response.StatusCode))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return out, err
+}
+
+// requestTokenURL performs a single token request to tokenURL,
+// in a span with Options.TracerProvider.
+func (c *Client) requestTokenURL(ctx context.Context, tokenURL, clientSecret string) (TokenInfo, TokenResponse, error) {
+	if c.tracer == nil {
+		return c.sendTokenRequest(ctx, tokenURL, clientSecret)
+	}
+
+	ctx, span := c.tracer.Start(ctx, "clientcredentials.TokenRequest",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("url.full", redactURL(tokenURL)),
+			attribute.String("oauth2.client_id", c.options.ClientID),
+		))
+	defer span.End()
+
+	ti, tr, errTok := c.sendTokenRequest(ctx, tokenURL, clientSecret)
+
+	if errTok != nil {
+		span.RecordError(errTok)
+		span.SetStatus(codes.Error, errTok.Error())
+	}
+
+	return ti, tr, errTok
+}
+
+// spanStatus records the token response status in the token request span.
+func (c *Client) spanStatus(ctx context.Context, status int) {
+	if c.tracer == nil {
+		return
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("http.response.status_code", status))
+}
+
+// redactURL hides the password in URLs with user info.
+func redactURL(rawURL string) string {
+	u, errParse := url.Parse(rawURL)
+	if errParse != nil {
+		return ""
+	}
+	return u.Redacted()
+}
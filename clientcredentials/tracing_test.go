@@ -0,0 +1,81 @@
+package clientcredentials
+
+import (
+	"testing"
+
+	"github.com/modernprogram/groupcache/v2"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracerProvider(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+	token := "abc"
+
+	ts := newTokenServer(&serverStat{}, clientID, clientSecret, token, 60)
+	defer ts.Close()
+
+	srv := newServer(&serverStat{}, func(t string) bool { return t == token })
+	defer srv.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	client := New(Options{
+		TokenURL:            ts.URL,
+		ClientID:            clientID,
+		ClientSecret:        clientSecret,
+		TracerProvider:      tp,
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+	defer client.Close()
+
+	for i := range 2 {
+		if _, errSend := send(client, srv.URL); errSend != nil {
+			t.Fatalf("send %d: %v", i, errSend)
+		}
+	}
+
+	spans := exporter.GetSpans()
+
+	var names []string
+	for _, s := range spans {
+		names = append(names, s.Name)
+	}
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %v", names)
+	}
+
+	fetch, first, second := spans[0], spans[1], spans[2]
+
+	table := []struct {
+		name   string
+		span   tracetest.SpanStub
+		expect string
+		attr   attribute.KeyValue
+	}{
+		{"token request", fetch, "clientcredentials.TokenRequest", attribute.Int("http.response.status_code", 200)},
+		{"first do", first, "clientcredentials.Do", attribute.Bool("oauth2.cache_hit", false)},
+		{"second do", second, "clientcredentials.Do", attribute.Bool("oauth2.cache_hit", true)},
+	}
+
+	for _, data := range table {
+		if data.span.Name != data.expect {
+			t.Errorf("%s: expected span %s, got %s", data.name, data.expect, data.span.Name)
+		}
+		found := false
+		for _, a := range data.span.Attributes {
+			found = found || a == data.attr
+		}
+		if !found {
+			t.Errorf("%s: missing attribute %v in %v", data.name, data.attr, data.span.Attributes)
+		}
+	}
+
+	if fetch.Parent.SpanID() != first.SpanContext.SpanID() {
+		t.Errorf("token request span should be a child of the first do span")
+	}
+}
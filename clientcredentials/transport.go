@@ -0,0 +1,53 @@
+package clientcredentials
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Transport returns an http.RoundTripper that sends requests with Do,
+// for libraries accepting only an *http.Client:
+//
+//	httpClient := &http.Client{Transport: client.Transport()}
+//
+// The returned http.Client must not be used as Options.HTTPClient of
+// the same Client, since Do sends requests with Options.HTTPClient.
+func (c *Client) Transport() http.RoundTripper {
+	return &transport{doer: c}
+}
+
+type transport struct {
+	doer HTTPClientDoer
+}
+
+// RoundTrip implements http.RoundTripper. As required by
+// http.RoundTripper, Do does not modify the caller's request, and the
+// request body is closed, even on errors, e.g. a failed token fetch
+// before the request is sent.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return t.doer.Do(req)
+	}
+	body := &onceCloseBody{ReadCloser: req.Body}
+	r := req.WithContext(req.Context()) // shallow copy, keep caller's request
+	r.Body = body
+	resp, err := t.doer.Do(r)
+	if err != nil {
+		body.Close()
+	}
+	return resp, err
+}
+
+// onceCloseBody closes the request body once, whether closed by the
+// inner transport or by RoundTrip on errors.
+type onceCloseBody struct {
+	io.ReadCloser
+	once sync.Once
+	err  error
+}
+
+func (b *onceCloseBody) Close() error {
+	b.once.Do(func() { b.err = b.ReadCloser.Close() })
+	return b.err
+}
@@ -0,0 +1,117 @@
+package clientcredentials
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTransport(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+
+	tokenServerStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, "abc", 60)
+	defer ts.Close()
+
+	serverStat := serverStat{}
+	srv := newServer(&serverStat, func(t string) bool { return t == "abc" })
+	defer srv.Close()
+
+	client := newClient(ts.URL, clientID, clientSecret, 0)
+
+	httpClient := &http.Client{Transport: client.Transport()}
+
+	for i := range 2 {
+		req, errReq := http.NewRequest("GET", srv.URL, nil)
+		if errReq != nil {
+			t.Fatalf("request %d: %v", i, errReq)
+		}
+		resp, errDo := httpClient.Do(req)
+		if errDo != nil {
+			t.Fatalf("do %d: %v", i, errDo)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != 200 {
+			t.Errorf("do %d: unexpected status: %d", i, resp.StatusCode)
+		}
+		if auth := req.Header.Get("Authorization"); auth != "" {
+			t.Errorf("do %d: caller request modified: Authorization=%q", i, auth)
+		}
+	}
+
+	if tokenServerStat.count != 1 {
+		t.Errorf("expected 1 token fetch, got %d", tokenServerStat.count)
+	}
+	if serverStat.count != 2 {
+		t.Errorf("expected 2 server requests, got %d", serverStat.count)
+	}
+}
+
+// closeCounter counts Close calls on a request body.
+type closeCounter struct {
+	io.Reader
+	closes atomic.Int32
+}
+
+func (b *closeCounter) Close() error {
+	b.closes.Add(1)
+	return nil
+}
+
+func TestTransportClosesBody(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+
+	tokenServerStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, "abc", 60)
+	defer ts.Close()
+
+	tsBroken := newTokenServerBroken(&serverStat{})
+	defer tsBroken.Close()
+
+	serverStat := serverStat{}
+	srv := newServer(&serverStat, func(t string) bool { return t == "abc" })
+	defer srv.Close()
+
+	table := []struct {
+		name        string
+		tokenURL    string
+		expectError bool
+	}{
+		{"sent", ts.URL, false},
+		{"token fetch failed", tsBroken.URL, true},
+	}
+
+	for _, data := range table {
+		client := newClient(data.tokenURL, clientID, clientSecret, 0)
+
+		body := &closeCounter{Reader: strings.NewReader("payload")}
+		req, errReq := http.NewRequest("POST", srv.URL, body)
+		if errReq != nil {
+			t.Fatalf("%s: request: %v", data.name, errReq)
+		}
+
+		resp, errDo := client.Transport().RoundTrip(req)
+		if gotError := errDo != nil; gotError != data.expectError {
+			t.Errorf("%s: expected error=%t, got: %v", data.name, data.expectError, errDo)
+		}
+		if errDo == nil {
+			resp.Body.Close()
+		}
+		client.Close()
+
+		if n := body.closes.Load(); n != 1 {
+			t.Errorf("%s: expected body closed once, got %d", data.name, n)
+		}
+		if req.Body != body {
+			t.Errorf("%s: caller request body replaced", data.name)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package clientcredentials
+
+import "time"
+
+// CacheTTLPolicy decides how long a token is kept in cache, independently
+// of how long it is valid, e.g. for compliance-driven retention rules.
+type CacheTTLPolicy interface {
+	// CacheTTL returns the maximum cache retention for the token.
+	// Zero or negative means tokens are kept until due for renewal.
+	CacheTTL(info TokenInfo) time.Duration
+}
+
+// CacheTTLPolicyFunc adapts a function to CacheTTLPolicy.
+type CacheTTLPolicyFunc func(info TokenInfo) time.Duration
+
+// CacheTTL calls f.
+func (f CacheTTLPolicyFunc) CacheTTL(info TokenInfo) time.Duration {
+	return f(info)
+}
+
+// limitCacheTTL applies Options.CacheTTLPolicy to the cache expiration.
+func (c *Client) limitCacheTTL(now time.Time, info TokenInfo, expire time.Time) time.Time {
+	if c.options.CacheTTLPolicy == nil {
+		return expire
+	}
+	ttl := c.options.CacheTTLPolicy.CacheTTL(info)
+	if ttl <= 0 {
+		return expire
+	}
+	if limit := now.Add(ttl); expire.IsZero() || limit.Before(expire) {
+		return limit
+	}
+	return expire
+}
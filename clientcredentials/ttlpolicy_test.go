@@ -0,0 +1,61 @@
+package clientcredentials
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+func TestCacheTTLPolicy(t *testing.T) {
+
+	clientID := "clientID"
+	clientSecret := "clientSecret"
+
+	tokenServerStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, clientID, clientSecret, "abc", 60)
+	defer ts.Close()
+
+	table := []struct {
+		name         string
+		refreshAhead bool
+		ttl          time.Duration
+		expectTTL    time.Duration
+	}{
+		{"no limit", false, 0, 50 * time.Second},
+		{"limit", false, 5 * time.Second, 5 * time.Second},
+		{"limit above soft expire", false, 55 * time.Second, 50 * time.Second},
+		{"refresh ahead no limit", true, 0, 60 * time.Second},
+		{"refresh ahead limit", true, 5 * time.Second, 5 * time.Second},
+	}
+
+	for _, data := range table {
+		client := New(Options{
+			TokenURL:            ts.URL,
+			ClientID:            clientID,
+			ClientSecret:        clientSecret,
+			RefreshAhead:        data.refreshAhead,
+			GroupcacheWorkspace: groupcache.NewWorkspace(),
+			CacheTTLPolicy: CacheTTLPolicyFunc(func(info TokenInfo) time.Duration {
+				if info.ExpiresIn != 60*time.Second {
+					t.Errorf("%s: unexpected expires_in: %v", data.name, info.ExpiresIn)
+				}
+				return data.ttl
+			}),
+		})
+
+		begin := time.Now()
+		_, expire, errFetch := client.fetchValue(context.TODO())
+		if errFetch != nil {
+			t.Errorf("%s: fetch: %v", data.name, errFetch)
+			continue
+		}
+
+		ttl := expire.Sub(begin)
+		if ttl < data.expectTTL-time.Second || ttl > data.expectTTL+time.Second {
+			t.Errorf("%s: expected cache ttl %v, got %v", data.name, data.expectTTL, ttl)
+		}
+	}
+}
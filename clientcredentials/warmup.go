@@ -0,0 +1,47 @@
+package clientcredentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// WarmUp retrieves the token into the cache, so the first request
+// does not pay for the token round-trip.
+func (c *Client) WarmUp(ctx context.Context) error {
+	_, err := c.getToken(ctx, c.cacheKey())
+	return err
+}
+
+// WarmUp warms up the tokens for clients, e.g. one client per known tenant,
+// running at most parallelism fetches at once. If parallelism is less than
+// 1, all clients are warmed up at once. The returned error joins the errors
+// from every failed client.
+func WarmUp(ctx context.Context, parallelism int, clients ...*Client) error {
+	if parallelism < 1 {
+		parallelism = len(clients)
+	}
+
+	sem := make(chan struct{}, parallelism)
+	errs := make([]error, len(clients))
+	var wg sync.WaitGroup
+
+	for i, c := range clients {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := c.WarmUp(ctx); err != nil {
+				errs[i] = fmt.Errorf("warm up: client_id=%s: %w", c.options.ClientID, err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,60 @@
+package clientcredentials
+
+import (
+	"context"
+	"testing"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+func TestWarmUp(t *testing.T) {
+
+	clientSecret := "clientSecret"
+	token := "abc"
+
+	tokenServerStat := serverStat{}
+
+	ts := newTokenServer(&tokenServerStat, "clientID", clientSecret, token, 60)
+	defer ts.Close()
+
+	workspace := groupcache.NewWorkspace()
+
+	newTenant := func(name, clientID string) *Client {
+		return New(Options{
+			TokenURL:            ts.URL,
+			ClientID:            clientID,
+			ClientSecret:        clientSecret,
+			GroupcacheName:      name,
+			GroupcacheWorkspace: workspace,
+		})
+	}
+
+	good1 := newTenant("tenant1", "clientID")
+	good2 := newTenant("tenant2", "clientID")
+	bad := newTenant("tenant3", "wrongID")
+
+	errWarm := WarmUp(context.TODO(), 2, good1, good2, bad)
+	if errWarm == nil {
+		t.Errorf("expected error from bad tenant")
+	}
+
+	if tokenServerStat.count != 3 {
+		t.Errorf("expected 3 token requests, got %d", tokenServerStat.count)
+	}
+
+	// warm tokens are served from cache
+
+	serverStat := serverStat{}
+	srv := newServer(&serverStat, func(t string) bool { return t == token })
+	defer srv.Close()
+
+	for _, c := range []*Client{good1, good2} {
+		if _, errSend := send(c, srv.URL); errSend != nil {
+			t.Errorf("send: %v", errSend)
+		}
+	}
+
+	if tokenServerStat.count != 3 {
+		t.Errorf("unexpected token requests after warm up: %d", tokenServerStat.count)
+	}
+}
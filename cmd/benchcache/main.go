@@ -0,0 +1,222 @@
+// Package main implements the tool.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/modernprogram/groupcache/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/udhos/groupcache_oauth2/clientcredentials"
+	"github.com/udhos/groupcache_oauth2/rediscache"
+)
+
+type application struct {
+	backends    string
+	redisAddr   string
+	tenants     int
+	concurrency int
+	rps         int
+	duration    time.Duration
+	expireIn    int
+}
+
+type result struct {
+	backend      string
+	requests     int
+	errors       int
+	elapsed      time.Duration
+	latencies    []time.Duration
+	tokenFetches int64
+}
+
+func main() {
+
+	app := application{}
+
+	flag.StringVar(&app.backends, "backends", "groupcache,memory,redis", "comma-separated cache backends to benchmark")
+	flag.StringVar(&app.redisAddr, "redisAddr", "", "redis address, e.g. localhost:6379; redis backend is skipped if empty")
+	flag.IntVar(&app.tenants, "tenants", 100, "number of distinct client credentials")
+	flag.IntVar(&app.concurrency, "concurrency", 8, "concurrent workers")
+	flag.IntVar(&app.rps, "rps", 0, "target requests per second, 0 means unlimited")
+	flag.DurationVar(&app.duration, "duration", 5*time.Second, "duration for each backend")
+	flag.IntVar(&app.expireIn, "expireIn", 3600, "token expires_in seconds issued by the local token server")
+
+	flag.Parse()
+
+	var tokenFetches atomic.Int64
+
+	// local token server issuing one token per client_id
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenFetches.Add(1)
+		r.ParseForm()
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%s","expires_in":%d}`,
+			r.Form.Get("client_id"), app.expireIn)
+	}))
+	defer ts.Close()
+
+	var results []result
+
+	for _, backend := range strings.Split(app.backends, ",") {
+		backend = strings.TrimSpace(backend)
+
+		cache, skip := newCache(&app, backend)
+		if skip {
+			continue
+		}
+
+		log.Printf("benchmarking backend=%s tenants=%d concurrency=%d rps=%d duration=%v",
+			backend, app.tenants, app.concurrency, app.rps, app.duration)
+
+		before := tokenFetches.Load()
+		res := run(&app, ts.URL, cache)
+		res.backend = backend
+		res.tokenFetches = tokenFetches.Load() - before
+
+		results = append(results, res)
+	}
+
+	report(results)
+}
+
+// newCache creates the TokenCache for backend. Nil means the default groupcache.
+func newCache(app *application, backend string) (clientcredentials.TokenCache, bool) {
+	switch backend {
+	case "groupcache":
+		return nil, false
+	case "memory":
+		return clientcredentials.NewMemoryTokenCache(), false
+	case "redis":
+		if app.redisAddr == "" {
+			log.Printf("skipping backend=redis: -redisAddr is empty")
+			return nil, true
+		}
+		client := redis.NewClient(&redis.Options{Addr: app.redisAddr})
+		if errPing := client.Ping(context.TODO()).Err(); errPing != nil {
+			log.Fatalf("redis ping: %s: %v", app.redisAddr, errPing)
+		}
+		return rediscache.New(rediscache.Options{
+			Client:    client,
+			KeyPrefix: fmt.Sprintf("benchcache:%d:", time.Now().UnixNano()),
+		}), false
+	}
+	log.Fatalf("unknown backend: %s", backend)
+	return nil, true
+}
+
+func run(app *application, tokenURL string, cache clientcredentials.TokenCache) result {
+
+	root := clientcredentials.New(clientcredentials.Options{
+		TokenURL:            tokenURL,
+		ClientID:            "tenant-0",
+		ClientSecret:        "secret",
+		TokenCache:          cache,
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+		Logf:                func(string, ...any) {},
+	})
+	defer root.Close()
+
+	tenants := make([]*clientcredentials.Client, app.tenants)
+	tenants[0] = root
+	for i := 1; i < app.tenants; i++ {
+		tenants[i] = root.WithCredentials(fmt.Sprintf("tenant-%d", i), "secret")
+	}
+
+	var tick <-chan time.Time
+	if app.rps > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(app.rps))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), app.duration)
+	defer cancel()
+
+	var next atomic.Int64
+	var mutex sync.Mutex
+	var res result
+	var wg sync.WaitGroup
+
+	begin := time.Now()
+
+	for range app.concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var latencies []time.Duration
+			var errs int
+			for {
+				if tick != nil {
+					select {
+					case <-tick:
+					case <-ctx.Done():
+					}
+				}
+				if ctx.Err() != nil {
+					break
+				}
+				c := tenants[int(next.Add(1))%len(tenants)]
+				start := time.Now()
+				if _, errTok := c.Token(ctx); errTok != nil {
+					if ctx.Err() != nil {
+						break
+					}
+					errs++
+				}
+				latencies = append(latencies, time.Since(start))
+			}
+			mutex.Lock()
+			res.latencies = append(res.latencies, latencies...)
+			res.errors += errs
+			mutex.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	res.elapsed = time.Since(begin)
+	res.requests = len(res.latencies)
+
+	return res
+}
+
+func report(results []result) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "backend\trequests\terrors\treq/s\tp50\tp90\tp99\tmax\ttoken_fetches\t")
+	for _, r := range results {
+		slices.Sort(r.latencies)
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.0f\t%v\t%v\t%v\t%v\t%d\t\n",
+			r.backend, r.requests, r.errors,
+			float64(r.requests)/r.elapsed.Seconds(),
+			percentile(r.latencies, 50),
+			percentile(r.latencies, 90),
+			percentile(r.latencies, 99),
+			percentile(r.latencies, 100),
+			r.tokenFetches)
+	}
+	w.Flush()
+}
+
+// percentile returns the p-th percentile of sorted latencies.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := (len(sorted)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
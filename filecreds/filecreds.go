@@ -0,0 +1,168 @@
+// Package filecreds implements a clientcredentials.CredentialsProvider
+// reading client credentials from files, e.g. a mounted Kubernetes Secret,
+// watching them so secret rotation is picked up without restarting.
+package filecreds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Options define provider options.
+type Options struct {
+	// ClientIDFile is the required file holding the client ID,
+	// e.g. /etc/oauth2/client_id.
+	ClientIDFile string
+
+	// ClientSecretFile is the required file holding the client secret,
+	// e.g. /etc/oauth2/client_secret.
+	ClientSecretFile string
+
+	// Logf provides logging function, if undefined defaults to log.Printf
+	Logf func(format string, v ...any)
+}
+
+// Provider returns client credentials read from files. The directories
+// holding the files are watched, since Kubernetes updates mounted Secrets
+// by swapping a symlink, and the files are read again on any change.
+// When the client secret changes, clientcredentials evicts tokens cached
+// for the previous secret once the token server accepts the new one.
+// It implements clientcredentials.CredentialsProvider.
+type Provider struct {
+	options Options
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+
+	mutex        sync.RWMutex
+	clientID     string
+	clientSecret string
+}
+
+// New creates a file credentials provider, reading the files and
+// starting to watch them. Call Close to stop watching.
+func New(options Options) (*Provider, error) {
+	if options.ClientIDFile == "" || options.ClientSecretFile == "" {
+		return nil, errors.New("credentials file names are empty")
+	}
+	if options.Logf == nil {
+		options.Logf = log.Printf
+	}
+
+	p := &Provider{
+		options: options,
+		done:    make(chan struct{}),
+	}
+
+	if errRead := p.read(); errRead != nil {
+		return nil, errRead
+	}
+
+	watcher, errWatcher := fsnotify.NewWatcher()
+	if errWatcher != nil {
+		return nil, fmt.Errorf("watcher: %w", errWatcher)
+	}
+
+	dirs := map[string]bool{
+		filepath.Dir(options.ClientIDFile):     true,
+		filepath.Dir(options.ClientSecretFile): true,
+	}
+	for dir := range dirs {
+		if errAdd := watcher.Add(dir); errAdd != nil {
+			watcher.Close()
+			return nil, fmt.Errorf("watch %s: %w", dir, errAdd)
+		}
+	}
+
+	p.watcher = watcher
+
+	go p.watch()
+
+	return p, nil
+}
+
+// Close stops watching the files.
+func (p *Provider) Close() error {
+	errClose := p.watcher.Close()
+	<-p.done
+	return errClose
+}
+
+// Credentials returns the client credentials last read from the files.
+// req is ignored.
+func (p *Provider) Credentials(_ context.Context, _ *http.Request) (string, string, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.clientID, p.clientSecret, nil
+}
+
+func (p *Provider) watch() {
+	defer close(p.done)
+	for {
+		select {
+		case _, ok := <-p.watcher.Events:
+			if !ok {
+				return
+			}
+			if errRead := p.read(); errRead != nil {
+				// files may be briefly missing during updates:
+				// keep the previous credentials until the next event.
+				p.options.Logf("ERROR: filecreds: keeping previous credentials: %v", errRead)
+			}
+		case errWatch, ok := <-p.watcher.Errors:
+			if !ok {
+				return
+			}
+			p.options.Logf("ERROR: filecreds: watcher: %v", errWatch)
+		}
+	}
+}
+
+func (p *Provider) read() error {
+	clientID, errID := readFile(p.options.ClientIDFile)
+	if errID != nil {
+		return errID
+	}
+	clientSecret, errSecret := readFile(p.options.ClientSecretFile)
+	if errSecret != nil {
+		return errSecret
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.clientID == clientID && p.clientSecret == clientSecret {
+		return nil
+	}
+
+	if p.clientID != "" {
+		p.options.Logf("INFO: filecreds: credentials changed: client_id=%s", clientID)
+	}
+
+	p.clientID = clientID
+	p.clientSecret = clientSecret
+
+	return nil
+}
+
+// readFile reads a credential, ignoring surrounding whitespace,
+// e.g. the trailing newline of files edited by hand.
+func readFile(name string) (string, error) {
+	data, errRead := os.ReadFile(name)
+	if errRead != nil {
+		return "", errRead
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "" {
+		return "", fmt.Errorf("empty credentials file: %s", name)
+	}
+	return value, nil
+}
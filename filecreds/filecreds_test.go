@@ -0,0 +1,113 @@
+package filecreds
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeVersion creates a Kubernetes-like Secret volume version,
+// atomically swapping the ..data symlink.
+func writeVersion(t *testing.T, dir, version, clientID, clientSecret string) {
+	t.Helper()
+
+	versionDir := filepath.Join(dir, version)
+	if err := os.Mkdir(versionDir, 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(versionDir, "client_id"), []byte(clientID+"\n"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(versionDir, "client_secret"), []byte(clientSecret), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	tmp := filepath.Join(dir, "..data_tmp")
+	if err := os.Symlink(version, tmp); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, "..data")); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+}
+
+func waitSecret(t *testing.T, p *Provider, expect string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, secret, _ := p.Credentials(context.TODO(), nil)
+		if secret == expect {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected secret %q, got %q", expect, secret)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestProviderKubernetesSecret(t *testing.T) {
+
+	dir := t.TempDir()
+
+	writeVersion(t, dir, "..v1", "app", "s1")
+	for _, name := range []string{"client_id", "client_secret"} {
+		if err := os.Symlink(filepath.Join("..data", name), filepath.Join(dir, name)); err != nil {
+			t.Fatalf("symlink: %v", err)
+		}
+	}
+
+	p, errNew := New(Options{
+		ClientIDFile:     filepath.Join(dir, "client_id"),
+		ClientSecretFile: filepath.Join(dir, "client_secret"),
+	})
+	if errNew != nil {
+		t.Fatalf("new: %v", errNew)
+	}
+	defer p.Close()
+
+	id, secret, errCreds := p.Credentials(context.TODO(), nil)
+	if errCreds != nil {
+		t.Fatalf("credentials: %v", errCreds)
+	}
+	if id != "app" || secret != "s1" {
+		t.Errorf("unexpected credentials: %s/%s", id, secret)
+	}
+
+	writeVersion(t, dir, "..v2", "app", "s2")
+
+	waitSecret(t, p, "s2")
+}
+
+func TestProviderPlainFiles(t *testing.T) {
+
+	dir := t.TempDir()
+	idFile := filepath.Join(dir, "id")
+	secretFile := filepath.Join(dir, "secret")
+
+	os.WriteFile(idFile, []byte("app"), 0o600)
+	os.WriteFile(secretFile, []byte("s1"), 0o600)
+
+	p, errNew := New(Options{ClientIDFile: idFile, ClientSecretFile: secretFile})
+	if errNew != nil {
+		t.Fatalf("new: %v", errNew)
+	}
+	defer p.Close()
+
+	os.WriteFile(secretFile, []byte("s2"), 0o600)
+
+	waitSecret(t, p, "s2")
+}
+
+func TestProviderMissingFile(t *testing.T) {
+	dir := t.TempDir()
+	_, errNew := New(Options{
+		ClientIDFile:     filepath.Join(dir, "id"),
+		ClientSecretFile: filepath.Join(dir, "secret"),
+	})
+	if errNew == nil {
+		t.Errorf("expected error")
+	}
+}
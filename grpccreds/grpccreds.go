@@ -0,0 +1,60 @@
+// Package grpccreds implements gRPC credentials.PerRPCCredentials backed by
+// clientcredentials.Client, so outbound gRPC calls reuse the distributed
+// token cache shared with HTTP calls.
+package grpccreds
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/udhos/groupcache_oauth2/clientcredentials"
+	"google.golang.org/grpc/credentials"
+)
+
+// Options define per-RPC credentials options.
+type Options struct {
+	// AllowInsecure allows sending tokens over connections without
+	// transport security, e.g. for tests or service meshes terminating TLS
+	// in a sidecar. By default, gRPC refuses to use the credentials
+	// on insecure connections.
+	AllowInsecure bool
+}
+
+// PerRPCCredentials attaches the token from a clientcredentials.Client to
+// the "authorization" metadata of every RPC. The RPC context is passed to
+// Client.Token, thus per-call credentials and scope from
+// clientcredentials.ContextWithCredentials and
+// clientcredentials.ContextWithScope are honored.
+// It implements credentials.PerRPCCredentials.
+type PerRPCCredentials struct {
+	client  *clientcredentials.Client
+	options Options
+}
+
+// New creates per-RPC credentials for the client, e.g. for
+// grpc.WithPerRPCCredentials.
+func New(client *clientcredentials.Client, options Options) *PerRPCCredentials {
+	return &PerRPCCredentials{client: client, options: options}
+}
+
+// GetRequestMetadata retrieves the token for the RPC, renewing it as
+// necessary.
+func (p *PerRPCCredentials) GetRequestMetadata(ctx context.Context, _ ...string) (map[string]string, error) {
+	if !p.options.AllowInsecure {
+		ri, _ := credentials.RequestInfoFromContext(ctx)
+		if errSec := credentials.CheckSecurityLevel(ri.AuthInfo, credentials.PrivacyAndIntegrity); errSec != nil {
+			return nil, fmt.Errorf("grpccreds: transport security required: %w", errSec)
+		}
+	}
+	tok, errToken := p.client.Token(ctx)
+	if errToken != nil {
+		return nil, fmt.Errorf("grpccreds: token: %w", errToken)
+	}
+	return map[string]string{"authorization": tok.Authorization()}, nil
+}
+
+// RequireTransportSecurity reports whether the credentials require
+// transport security, unless Options.AllowInsecure is set.
+func (p *PerRPCCredentials) RequireTransportSecurity() bool {
+	return !p.options.AllowInsecure
+}
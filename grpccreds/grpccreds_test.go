@@ -0,0 +1,106 @@
+package grpccreds
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/modernprogram/groupcache/v2"
+	"github.com/udhos/groupcache_oauth2/clientcredentials"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var _ credentials.PerRPCCredentials = (*PerRPCCredentials)(nil)
+
+func TestPerRPCCredentials(t *testing.T) {
+
+	var fetches int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		r.ParseForm()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"` + r.Form.Get("client_id") + `","expires_in":60}`))
+	}))
+	defer ts.Close()
+
+	client := clientcredentials.New(clientcredentials.Options{
+		TokenURL:            ts.URL,
+		ClientID:            "clientID",
+		ClientSecret:        "clientSecret",
+		GroupcacheWorkspace: groupcache.NewWorkspace(),
+	})
+	defer client.Close()
+
+	var gotAuth []string
+	interceptor := func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		gotAuth = md.Get("authorization")
+		return handler(ctx, req)
+	}
+
+	lis := bufconn.Listen(1 << 16)
+	srv := grpc.NewServer(grpc.UnaryInterceptor(interceptor))
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, errDial := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithPerRPCCredentials(New(client, Options{AllowInsecure: true})),
+	)
+	if errDial != nil {
+		t.Fatalf("dial: %v", errDial)
+	}
+	defer conn.Close()
+
+	health := healthpb.NewHealthClient(conn)
+
+	table := []struct {
+		name   string
+		ctx    context.Context
+		expect string
+	}{
+		{"fetch", context.TODO(), "Bearer clientID"},
+		{"cached", context.TODO(), "Bearer clientID"},
+		{"per-call credentials", clientcredentials.ContextWithCredentials(context.TODO(), "tenant", "secret"), "Bearer tenant"},
+	}
+
+	for _, data := range table {
+		if _, errCheck := health.Check(data.ctx, &healthpb.HealthCheckRequest{}); errCheck != nil {
+			t.Fatalf("%s: check: %v", data.name, errCheck)
+		}
+		if len(gotAuth) != 1 || gotAuth[0] != data.expect {
+			t.Errorf("%s: expected authorization %q, got %q", data.name, data.expect, gotAuth)
+		}
+	}
+
+	if fetches != 2 {
+		t.Errorf("expected 2 token fetches, got %d", fetches)
+	}
+}
+
+func TestRequireTransportSecurity(t *testing.T) {
+
+	creds := New(nil, Options{})
+	if !creds.RequireTransportSecurity() {
+		t.Errorf("transport security should be required by default")
+	}
+
+	conn, errDial := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithPerRPCCredentials(creds),
+	)
+	if errDial == nil {
+		conn.Close()
+		t.Errorf("expected dial error for insecure connection")
+	}
+}
@@ -0,0 +1,62 @@
+// Package peering keeps groupcache pool membership in sync with peer
+// discovery, e.g. Kubernetes pods watched by kubegroup.
+package peering
+
+import (
+	"context"
+	"sort"
+)
+
+// Pooler is the groupcache pool receiving peer updates.
+// *groupcache.HTTPPool satisfies Pooler.
+type Pooler interface {
+	Set(peers ...string)
+}
+
+// PeerUpdater watches peer membership and calls update with the full
+// list of peer URLs on every change, until ctx is done.
+type PeerUpdater interface {
+	Watch(ctx context.Context, update func(peers []string)) error
+}
+
+// PeerUpdaterFunc adapts a function to PeerUpdater.
+type PeerUpdaterFunc func(ctx context.Context, update func(peers []string)) error
+
+// Watch calls f(ctx, update).
+func (f PeerUpdaterFunc) Watch(ctx context.Context, update func(peers []string)) error {
+	return f(ctx, update)
+}
+
+// Static is a PeerUpdater reporting a fixed peer list once.
+type Static []string
+
+// Watch reports the peer list, then waits for ctx.
+func (s Static) Watch(ctx context.Context, update func(peers []string)) error {
+	update(s)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// Run propagates peer updates into pool until ctx is done or the
+// updater fails. The self URL is always kept in the pool, since
+// groupcache expects it among the peers. Duplicates are dropped
+// and peers are sorted, so every instance sees the same list.
+func Run(ctx context.Context, pool Pooler, self string, updater PeerUpdater) error {
+	return updater.Watch(ctx, func(peers []string) {
+		pool.Set(normalize(self, peers)...)
+	})
+}
+
+func normalize(self string, peers []string) []string {
+	seen := map[string]struct{}{self: {}}
+	list := []string{self}
+	for _, p := range peers {
+		if _, found := seen[p]; found {
+			continue
+		}
+		seen[p] = struct{}{}
+		list = append(list, p)
+	}
+	sort.Strings(list)
+	return list
+}
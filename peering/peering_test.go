@@ -0,0 +1,69 @@
+package peering
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/modernprogram/groupcache/v2"
+)
+
+var _ Pooler = (*groupcache.HTTPPool)(nil)
+
+type fakePool struct {
+	sets [][]string
+}
+
+func (p *fakePool) Set(peers ...string) {
+	p.sets = append(p.sets, peers)
+}
+
+func TestRun(t *testing.T) {
+
+	updates := [][]string{
+		{"http://b:5000"},
+		{"http://c:5000", "http://a:5000", "http://c:5000"},
+		{},
+	}
+
+	updater := PeerUpdaterFunc(func(_ context.Context, update func(peers []string)) error {
+		for _, u := range updates {
+			update(u)
+		}
+		return nil
+	})
+
+	pool := &fakePool{}
+
+	if err := Run(context.TODO(), pool, "http://a:5000", updater); err != nil {
+		t.Errorf("run: %v", err)
+	}
+
+	expect := [][]string{
+		{"http://a:5000", "http://b:5000"},
+		{"http://a:5000", "http://c:5000"},
+		{"http://a:5000"},
+	}
+
+	if !reflect.DeepEqual(pool.sets, expect) {
+		t.Errorf("expected %v, got %v", expect, pool.sets)
+	}
+}
+
+func TestStatic(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+
+	pool := &fakePool{}
+
+	if err := Run(ctx, pool, "http://a:5000", Static{"http://b:5000"}); err != context.Canceled {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	expect := [][]string{{"http://a:5000", "http://b:5000"}}
+
+	if !reflect.DeepEqual(pool.sets, expect) {
+		t.Errorf("expected %v, got %v", expect, pool.sets)
+	}
+}
@@ -0,0 +1,168 @@
+// Package rediscache implements a Redis token cache for clientcredentials.
+package rediscache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Options define cache options.
+type Options struct {
+	// Client is the required Redis client.
+	Client redis.UniversalClient
+
+	// KeyPrefix prefixes Redis keys. If unspecified, defaults to "oauth2:".
+	KeyPrefix string
+
+	// Logf provides logging function, if undefined defaults to log.Printf
+	Logf func(format string, v ...any)
+}
+
+// Cache is a token cache backed by Redis, shared by all instances using
+// the same Redis. It implements clientcredentials.TokenCache.
+// Concurrent misses for the same key are deduplicated only within
+// this instance.
+type Cache struct {
+	options Options
+	loading map[string]*load
+	mutex   sync.Mutex
+}
+
+// load is a load in progress, shared by concurrent misses.
+type load struct {
+	done   chan struct{}
+	value  string
+	expire time.Time
+	err    error
+}
+
+// entry is the value stored in Redis. The expiration is stored along
+// the value since the Redis TTL is not returned by GET.
+type entry struct {
+	Value  string `json:"v"`
+	Expire int64  `json:"e,omitempty"` // unix milliseconds
+}
+
+// New creates a Redis token cache.
+func New(options Options) *Cache {
+	if options.Client == nil {
+		panic("redis client is nil")
+	}
+	if options.KeyPrefix == "" {
+		options.KeyPrefix = "oauth2:"
+	}
+	if options.Logf == nil {
+		options.Logf = log.Printf
+	}
+	return &Cache{
+		options: options,
+		loading: map[string]*load{},
+	}
+}
+
+// Get returns the cached value, loading it on miss. Failure to store
+// the loaded value is logged, the loaded value is returned anyway.
+func (c *Cache) Get(ctx context.Context, key string,
+	loadFunc func(ctx context.Context) (string, time.Time, error)) (string, time.Time, error) {
+
+	value, expire, found, errGet := c.get(ctx, key)
+	if errGet != nil {
+		return "", time.Time{}, errGet
+	}
+	if found {
+		return value, expire, nil
+	}
+
+	c.mutex.Lock()
+	if l, found := c.loading[key]; found {
+		c.mutex.Unlock()
+		select {
+		case <-l.done:
+			return l.value, l.expire, l.err
+		case <-ctx.Done():
+			return "", time.Time{}, ctx.Err()
+		}
+	}
+	l := &load{done: make(chan struct{})}
+	c.loading[key] = l
+	c.mutex.Unlock()
+
+	l.value, l.expire, l.err = loadFunc(ctx)
+	if l.err == nil {
+		if errSet := c.Set(ctx, key, l.value, l.expire); errSet != nil {
+			c.options.Logf("ERROR: rediscache: key=%s: %v", key, errSet)
+		}
+	}
+
+	c.mutex.Lock()
+	delete(c.loading, key)
+	c.mutex.Unlock()
+
+	close(l.done)
+
+	return l.value, l.expire, l.err
+}
+
+func (c *Cache) get(ctx context.Context, key string) (string, time.Time, bool, error) {
+	buf, errGet := c.options.Client.Get(ctx, c.options.KeyPrefix+key).Bytes()
+	if errors.Is(errGet, redis.Nil) {
+		return "", time.Time{}, false, nil
+	}
+	if errGet != nil {
+		return "", time.Time{}, false, fmt.Errorf("redis get: %w", errGet)
+	}
+
+	var e entry
+	if errJSON := json.Unmarshal(buf, &e); errJSON != nil {
+		return "", time.Time{}, false, fmt.Errorf("redis entry: %v", errJSON)
+	}
+
+	var expire time.Time
+	if e.Expire != 0 {
+		expire = time.UnixMilli(e.Expire)
+		if !time.Now().Before(expire) {
+			return "", time.Time{}, false, nil
+		}
+	}
+
+	return e.Value, expire, true, nil
+}
+
+// Set replaces the cached value.
+func (c *Cache) Set(ctx context.Context, key, value string, expire time.Time) error {
+	e := entry{Value: value}
+	var ttl time.Duration
+	if !expire.IsZero() {
+		e.Expire = expire.UnixMilli()
+		ttl = time.Until(expire)
+		if ttl <= 0 {
+			return nil // already expired
+		}
+	}
+
+	buf, errJSON := json.Marshal(e)
+	if errJSON != nil {
+		return errJSON
+	}
+
+	if errSet := c.options.Client.Set(ctx, c.options.KeyPrefix+key, buf, ttl).Err(); errSet != nil {
+		return fmt.Errorf("redis set: %w", errSet)
+	}
+
+	return nil
+}
+
+// Remove evicts the key.
+func (c *Cache) Remove(ctx context.Context, key string) error {
+	if errDel := c.options.Client.Del(ctx, c.options.KeyPrefix+key).Err(); errDel != nil {
+		return fmt.Errorf("redis del: %w", errDel)
+	}
+	return nil
+}
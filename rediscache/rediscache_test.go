@@ -0,0 +1,134 @@
+package rediscache
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/udhos/groupcache_oauth2/clientcredentials"
+)
+
+func newCache(t *testing.T) (*Cache, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return New(Options{Client: client}), mr
+}
+
+func TestCache(t *testing.T) {
+	cache, mr := newCache(t)
+
+	ctx := context.TODO()
+
+	var loads int
+	load := func(context.Context) (string, time.Time, error) {
+		loads++
+		return fmt.Sprintf("value%d", loads), time.Now().Add(time.Minute), nil
+	}
+
+	for range 2 {
+		value, _, errGet := cache.Get(ctx, "key1", load)
+		if errGet != nil {
+			t.Fatalf("get: %v", errGet)
+		}
+		if value != "value1" {
+			t.Errorf("unexpected value: %q", value)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("unexpected load count: %d", loads)
+	}
+
+	if ttl := mr.TTL("oauth2:key1"); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("unexpected redis ttl: %v", ttl)
+	}
+
+	if errRemove := cache.Remove(ctx, "key1"); errRemove != nil {
+		t.Fatalf("remove: %v", errRemove)
+	}
+
+	if value, _, _ := cache.Get(ctx, "key1", load); value != "value2" {
+		t.Errorf("unexpected value after remove: %q", value)
+	}
+}
+
+func TestCacheSetFailure(t *testing.T) {
+	cache, mr := newCache(t)
+
+	var logs []string
+	cache.options.Logf = func(format string, v ...any) {
+		logs = append(logs, fmt.Sprintf(format, v...))
+	}
+
+	load := func(context.Context) (string, time.Time, error) {
+		mr.SetError("redis down") // store fails after the load
+		return "value1", time.Now().Add(time.Minute), nil
+	}
+
+	value, _, errGet := cache.Get(context.TODO(), "key1", load)
+	if errGet != nil {
+		t.Fatalf("get: %v", errGet)
+	}
+	if value != "value1" {
+		t.Errorf("unexpected value: %q", value)
+	}
+	if len(logs) != 1 || !strings.Contains(logs[0], "redis down") {
+		t.Errorf("expected logged set failure, got: %v", logs)
+	}
+}
+
+func TestClientWithRedisCache(t *testing.T) {
+	cache, _ := newCache(t)
+
+	var tokenRequests atomic.Int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		tokenRequests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"abc","expires_in":60}`)
+	}))
+	defer ts.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") != "abc" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	newClient := func() *clientcredentials.Client {
+		return clientcredentials.New(clientcredentials.Options{
+			TokenURL:     ts.URL,
+			ClientID:     "clientID",
+			ClientSecret: "clientSecret",
+			TokenCache:   cache,
+		})
+	}
+
+	// two clients share tokens through redis
+	for _, client := range []*clientcredentials.Client{newClient(), newClient()} {
+		req, errReq := http.NewRequestWithContext(context.TODO(), "GET", srv.URL, nil)
+		if errReq != nil {
+			t.Fatalf("request: %v", errReq)
+		}
+		resp, errDo := client.Do(req)
+		if errDo != nil {
+			t.Fatalf("do: %v", errDo)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != 200 {
+			t.Errorf("unexpected status: %d", resp.StatusCode)
+		}
+	}
+
+	if n := tokenRequests.Load(); n != 1 {
+		t.Errorf("unexpected token request count: %d", n)
+	}
+}
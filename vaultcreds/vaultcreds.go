@@ -0,0 +1,273 @@
+// Package vaultcreds implements a clientcredentials.CredentialsProvider
+// reading client credentials from a HashiCorp Vault KV secret.
+package vaultcreds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options define provider options.
+type Options struct {
+	// Address is the required Vault address, e.g. https://vault:8200.
+	Address string
+
+	// Token is the required Vault token.
+	Token string
+
+	// Namespace optionally sets the Vault Enterprise namespace.
+	Namespace string
+
+	// Mount is the KV secrets engine mount. If unspecified, defaults to "secret".
+	Mount string
+
+	// Path is the required secret path within the mount.
+	Path string
+
+	// KVVersion selects the KV secrets engine version, 1 or 2.
+	// If unspecified, defaults to 2.
+	KVVersion int
+
+	// ClientIDField is the secret field holding the client ID.
+	// If unspecified, defaults to "client_id".
+	ClientIDField string
+
+	// ClientSecretField is the secret field holding the client secret.
+	// If unspecified, defaults to "client_secret".
+	ClientSecretField string
+
+	// RefreshInterval is the period between secret reads. With KV version 1,
+	// a shorter lease_duration takes precedence.
+	// If unspecified, defaults to 1 minute.
+	RefreshInterval time.Duration
+
+	// RenewToken renews the Vault token lease, with renew-self, when half
+	// of its lease has elapsed, so long-running services keep access.
+	RenewToken bool
+
+	// HTTPClient provides the HTTP client for Vault requests.
+	// If unspecified, defaults to http.DefaultClient.
+	HTTPClient *http.Client
+
+	// Logf provides logging function, if undefined defaults to log.Printf
+	Logf func(format string, v ...any)
+}
+
+// Provider reads client credentials from Vault, refreshing them lazily
+// after RefreshInterval. When the secret version changes, the new
+// credentials are returned, and clientcredentials evicts tokens cached
+// for the previous client secret once the token server accepts the new one.
+// It implements clientcredentials.CredentialsProvider.
+type Provider struct {
+	options Options
+
+	mutex        sync.Mutex
+	clientID     string
+	clientSecret string
+	version      int
+	loaded       bool
+	nextRead     time.Time
+	nextRenew    time.Time // zero until the first renewal
+}
+
+// New creates a Vault credentials provider.
+func New(options Options) *Provider {
+	if options.Address == "" {
+		panic("vault address is empty")
+	}
+	if options.Token == "" {
+		panic("vault token is empty")
+	}
+	if options.Path == "" {
+		panic("vault secret path is empty")
+	}
+	if options.Mount == "" {
+		options.Mount = "secret"
+	}
+	switch options.KVVersion {
+	case 0:
+		options.KVVersion = 2
+	case 1, 2:
+	default:
+		panic(fmt.Sprintf("invalid vault kv version: %d", options.KVVersion))
+	}
+	if options.ClientIDField == "" {
+		options.ClientIDField = "client_id"
+	}
+	if options.ClientSecretField == "" {
+		options.ClientSecretField = "client_secret"
+	}
+	if options.RefreshInterval <= 0 {
+		options.RefreshInterval = time.Minute
+	}
+	if options.HTTPClient == nil {
+		options.HTTPClient = http.DefaultClient
+	}
+	if options.Logf == nil {
+		options.Logf = log.Printf
+	}
+	options.Address = strings.TrimSuffix(options.Address, "/")
+	return &Provider{options: options}
+}
+
+// Credentials returns the client credentials read from Vault. If a refresh
+// fails, the last credentials read are returned and the error is logged.
+// req is ignored.
+func (p *Provider) Credentials(ctx context.Context, _ *http.Request) (string, string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := time.Now()
+
+	if p.options.RenewToken && !now.Before(p.nextRenew) {
+		if errRenew := p.renew(ctx, now); errRenew != nil {
+			p.options.Logf("ERROR: vaultcreds: token renewal: %v", errRenew)
+		}
+	}
+
+	if !p.loaded || !now.Before(p.nextRead) {
+		if errRead := p.read(ctx, now); errRead != nil {
+			if !p.loaded {
+				return "", "", errRead
+			}
+			p.options.Logf("ERROR: vaultcreds: keeping previous credentials: %v", errRead)
+		}
+	}
+
+	return p.clientID, p.clientSecret, nil
+}
+
+// Version returns the secret version of the current credentials,
+// zero for KV version 1 or before the first read.
+func (p *Provider) Version() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.version
+}
+
+type kvResponse struct {
+	LeaseDuration int             `json:"lease_duration"` // seconds
+	Data          json.RawMessage `json:"data"`
+}
+
+type kv2Data struct {
+	Data     map[string]any `json:"data"`
+	Metadata struct {
+		Version int `json:"version"`
+	} `json:"metadata"`
+}
+
+func (p *Provider) read(ctx context.Context, now time.Time) error {
+	var path string
+	if p.options.KVVersion == 2 {
+		path = "/v1/" + p.options.Mount + "/data/" + p.options.Path
+	} else {
+		path = "/v1/" + p.options.Mount + "/" + p.options.Path
+	}
+
+	var resp kvResponse
+	if errCall := p.call(ctx, "GET", path, &resp); errCall != nil {
+		return errCall
+	}
+
+	var fields map[string]any
+	var version int
+
+	if p.options.KVVersion == 2 {
+		var d kv2Data
+		if errJSON := json.Unmarshal(resp.Data, &d); errJSON != nil {
+			return fmt.Errorf("decode secret: %w", errJSON)
+		}
+		fields = d.Data
+		version = d.Metadata.Version
+	} else if errJSON := json.Unmarshal(resp.Data, &fields); errJSON != nil {
+		return fmt.Errorf("decode secret: %w", errJSON)
+	}
+
+	clientID, _ := fields[p.options.ClientIDField].(string)
+	clientSecret, _ := fields[p.options.ClientSecretField].(string)
+	if clientID == "" || clientSecret == "" {
+		return fmt.Errorf("secret %s: missing fields %s or %s", p.options.Path,
+			p.options.ClientIDField, p.options.ClientSecretField)
+	}
+
+	if p.loaded && version != p.version {
+		p.options.Logf("INFO: vaultcreds: secret %s version changed: %d => %d",
+			p.options.Path, p.version, version)
+	}
+
+	p.clientID = clientID
+	p.clientSecret = clientSecret
+	p.version = version
+	p.loaded = true
+
+	interval := p.options.RefreshInterval
+	if lease := time.Duration(resp.LeaseDuration) * time.Second; lease > 0 && lease < interval {
+		interval = lease
+	}
+	p.nextRead = now.Add(interval)
+
+	return nil
+}
+
+type renewResponse struct {
+	Auth struct {
+		LeaseDuration int  `json:"lease_duration"` // seconds
+		Renewable     bool `json:"renewable"`
+	} `json:"auth"`
+}
+
+func (p *Provider) renew(ctx context.Context, now time.Time) error {
+	var resp renewResponse
+	if errCall := p.call(ctx, "POST", "/v1/auth/token/renew-self", &resp); errCall != nil {
+		p.nextRenew = now.Add(p.options.RefreshInterval) // retry later
+		return errCall
+	}
+	lease := time.Duration(resp.Auth.LeaseDuration) * time.Second
+	if !resp.Auth.Renewable || lease <= 0 {
+		// non-renewable or non-expiring token: stop renewing.
+		p.options.RenewToken = false
+		return nil
+	}
+	p.nextRenew = now.Add(lease / 2)
+	return nil
+}
+
+func (p *Provider) call(ctx context.Context, method, path string, out any) error {
+	req, errReq := http.NewRequestWithContext(ctx, method, p.options.Address+path, nil)
+	if errReq != nil {
+		return errReq
+	}
+	req.Header.Set("X-Vault-Token", p.options.Token)
+	if p.options.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.options.Namespace)
+	}
+
+	resp, errDo := p.options.HTTPClient.Do(req)
+	if errDo != nil {
+		return errDo
+	}
+	defer resp.Body.Close()
+
+	body, errBody := io.ReadAll(resp.Body)
+	if errBody != nil {
+		return errBody
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("vault %s %s: status:%d body:%s", method, path, resp.StatusCode, string(body))
+	}
+
+	if errJSON := json.Unmarshal(body, out); errJSON != nil {
+		return fmt.Errorf("vault %s %s: decode: %w", method, path, errJSON)
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package vaultcreds
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeVault struct {
+	mutex    sync.Mutex
+	version  int
+	secret   string
+	fail     bool
+	renewals int
+	token    string
+}
+
+func (v *fakeVault) handler(w http.ResponseWriter, r *http.Request) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if r.Header.Get("X-Vault-Token") != "root-token" {
+		http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+		return
+	}
+
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/v1/auth/token/renew-self":
+		v.renewals++
+		fmt.Fprint(w, `{"auth":{"lease_duration":3600,"renewable":true}}`)
+	case v.fail:
+		http.Error(w, `{"errors":["unavailable"]}`, http.StatusServiceUnavailable)
+	case r.URL.Path == "/v1/secret/data/app/oauth2":
+		fmt.Fprintf(w, `{"data":{"data":{"client_id":"app","client_secret":%q},"metadata":{"version":%d}}}`,
+			v.secret, v.version)
+	case r.URL.Path == "/v1/kv/app/oauth2":
+		fmt.Fprintf(w, `{"lease_duration":60,"data":{"id":"app","secret":%q}}`, v.secret)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (v *fakeVault) set(version int, secret string, fail bool) {
+	v.mutex.Lock()
+	v.version, v.secret, v.fail = version, secret, fail
+	v.mutex.Unlock()
+}
+
+func TestProviderKV2(t *testing.T) {
+
+	vault := &fakeVault{version: 1, secret: "s1"}
+	srv := httptest.NewServer(http.HandlerFunc(vault.handler))
+	defer srv.Close()
+
+	p := New(Options{
+		Address:         srv.URL,
+		Token:           "root-token",
+		Path:            "app/oauth2",
+		RefreshInterval: 10 * time.Millisecond,
+		RenewToken:      true,
+	})
+
+	table := []struct {
+		name          string
+		version       int
+		secret        string
+		fail          bool
+		wait          time.Duration
+		expectSecret  string
+		expectVersion int
+	}{
+		{"first read", 1, "s1", false, 0, "s1", 1},
+		{"cached before refresh", 2, "s2", false, 0, "s1", 1},
+		{"new version after refresh", 2, "s2", false, 20 * time.Millisecond, "s2", 2},
+		{"vault failure keeps previous", 3, "s3", true, 20 * time.Millisecond, "s2", 2},
+		{"recovered", 3, "s3", false, 20 * time.Millisecond, "s3", 3},
+	}
+
+	for _, data := range table {
+		vault.set(data.version, data.secret, data.fail)
+		time.Sleep(data.wait)
+		id, secret, errCreds := p.Credentials(context.TODO(), nil)
+		if errCreds != nil {
+			t.Fatalf("%s: credentials: %v", data.name, errCreds)
+		}
+		if id != "app" || secret != data.expectSecret {
+			t.Errorf("%s: unexpected credentials: %s/%s", data.name, id, secret)
+		}
+		if v := p.Version(); v != data.expectVersion {
+			t.Errorf("%s: expected version %d, got %d", data.name, data.expectVersion, v)
+		}
+	}
+
+	if vault.renewals != 1 {
+		t.Errorf("expected 1 token renewal, got %d", vault.renewals)
+	}
+}
+
+func TestProviderKV1(t *testing.T) {
+
+	vault := &fakeVault{secret: "s1"}
+	srv := httptest.NewServer(http.HandlerFunc(vault.handler))
+	defer srv.Close()
+
+	p := New(Options{
+		Address:           srv.URL,
+		Token:             "root-token",
+		Mount:             "kv",
+		Path:              "app/oauth2",
+		KVVersion:         1,
+		ClientIDField:     "id",
+		ClientSecretField: "secret",
+	})
+
+	id, secret, errCreds := p.Credentials(context.TODO(), nil)
+	if errCreds != nil {
+		t.Fatalf("credentials: %v", errCreds)
+	}
+	if id != "app" || secret != "s1" {
+		t.Errorf("unexpected credentials: %s/%s", id, secret)
+	}
+}
+
+func TestProviderErrors(t *testing.T) {
+
+	vault := &fakeVault{secret: "s1"}
+	srv := httptest.NewServer(http.HandlerFunc(vault.handler))
+	defer srv.Close()
+
+	table := []struct {
+		name    string
+		options Options
+	}{
+		{"bad token", Options{Address: srv.URL, Token: "bad", Path: "app/oauth2"}},
+		{"missing secret", Options{Address: srv.URL, Token: "root-token", Path: "missing"}},
+		{"missing fields", Options{Address: srv.URL, Token: "root-token", Path: "app/oauth2", ClientIDField: "missing"}},
+	}
+
+	for _, data := range table {
+		p := New(data.options)
+		if _, _, errCreds := p.Credentials(context.TODO(), nil); errCreds == nil {
+			t.Errorf("%s: expected error", data.name)
+		}
+	}
+}